@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Hide a task from the default task list without deleting it or touching its status
+func archiveTask(c *gin.Context) {
+	setArchived(c, true)
+}
+
+// Bring an archived task back into the default task list
+func unarchiveTask(c *gin.Context) {
+	setArchived(c, false)
+}
+
+func setArchived(c *gin.Context, archived bool) {
+	task, ok := loadOwnedTask(c, false)
+	if !ok {
+		return
+	}
+	if task.Archived == archived {
+		if archived {
+			respondError(c, http.StatusConflict, codeConflict, "Task is already archived")
+		} else {
+			respondError(c, http.StatusConflict, codeConflict, "Task is not archived")
+		}
+		return
+	}
+	updated := task
+	updated.Archived = archived
+	updated.UpdatedBy = currentUser(c).ID
+	updated, err := tasks.Update(task.ID, updated)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	recordAudit(c, AuditUpdate, AuditResourceTask, task.ID, task, updated)
+	notifyTaskEvent(EventTaskUpdated, updated)
+	respondTask(c, http.StatusOK, updated)
+}
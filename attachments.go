@@ -0,0 +1,250 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Attachment limits used when the ATTACHMENT_* variables are not set
+const (
+	defaultAttachmentDir          = "attachments"
+	defaultAttachmentMaxBytes     = 10 << 20
+	defaultAttachmentTaskMaxBytes = 50 << 20
+)
+
+// File types accepted when ATTACHMENT_TYPES is not set. Types are sniffed from
+// the content, never taken from the client.
+var defaultAttachmentTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp",
+	"application/pdf", "application/zip", "text/plain",
+}
+
+// Metadata of a file attached to a task. The file itself lives on disk.
+type Attachment struct {
+	ID          string    `json:"id"`
+	TaskID      string    `json:"task_id"`
+	UserID      string    `json:"user_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Where attachments are kept and what is accepted
+type attachmentConfig struct {
+	dir          string
+	maxFileBytes int64
+	maxTaskBytes int64
+	allowedTypes map[string]bool
+}
+
+// Read ATTACHMENT_DIR, ATTACHMENT_MAX_BYTES (per file), ATTACHMENT_TASK_MAX_BYTES
+// (all files of one task) and the comma-separated ATTACHMENT_TYPES
+func attachmentSettings() (attachmentConfig, error) {
+	cfg := attachmentConfig{
+		dir:          os.Getenv("ATTACHMENT_DIR"),
+		maxFileBytes: defaultAttachmentMaxBytes,
+		maxTaskBytes: defaultAttachmentTaskMaxBytes,
+		allowedTypes: make(map[string]bool),
+	}
+	if cfg.dir == "" {
+		cfg.dir = defaultAttachmentDir
+	}
+	for name, limit := range map[string]*int64{
+		"ATTACHMENT_MAX_BYTES":      &cfg.maxFileBytes,
+		"ATTACHMENT_TASK_MAX_BYTES": &cfg.maxTaskBytes,
+	} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 1 {
+				return attachmentConfig{}, fmt.Errorf("%s %q must be a positive integer", name, v)
+			}
+			*limit = n
+		}
+	}
+	types := defaultAttachmentTypes
+	if v := os.Getenv("ATTACHMENT_TYPES"); v != "" {
+		types = strings.Split(v, ",")
+	}
+	for _, t := range types {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			cfg.allowedTypes[t] = true
+		}
+	}
+	return cfg, nil
+}
+
+// Where the file of an attachment is stored: one directory per task, one file per attachment ID
+func (cfg attachmentConfig) path(taskID, id string) string {
+	return filepath.Join(cfg.dir, taskID, id)
+}
+
+// Build the handler for POST /tasks/:id/attachments, which stores the multipart
+// "file" field as an attachment of a task the caller can see
+func uploadAttachment(cfg attachmentConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		task, ok := loadVisibleTask(c, false)
+		if !ok {
+			return
+		}
+		// Leave room for the multipart envelope around the file itself
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.maxFileBytes+multipartOverhead)
+		header, err := c.FormFile("file")
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) || (err == nil && header.Size > cfg.maxFileBytes) {
+			respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("File must not be larger than %d bytes", cfg.maxFileBytes))
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "Expected a file upload in the \"file\" form field")
+			return
+		}
+		existing, err := attachments.ListByTask(task.ID)
+		if err != nil {
+			respondStoreError(c, err, "Task not found")
+			return
+		}
+		used := int64(0)
+		for _, a := range existing {
+			used += a.Size
+		}
+		if used+header.Size > cfg.maxTaskBytes {
+			respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge,
+				fmt.Sprintf("Attachments of a task must not add up to more than %d bytes", cfg.maxTaskBytes))
+			return
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "Failed to read the uploaded file")
+			return
+		}
+		defer file.Close()
+		sniff := make([]byte, 512)
+		n, err := io.ReadFull(file, sniff)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "Failed to read the uploaded file")
+			return
+		}
+		contentType, _, _ := mime.ParseMediaType(http.DetectContentType(sniff[:n]))
+		if !cfg.allowedTypes[contentType] {
+			respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Files of type "+contentType+" cannot be attached")
+			return
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "Failed to read the uploaded file")
+			return
+		}
+
+		attachment := Attachment{
+			ID:          uuid.NewString(),
+			TaskID:      task.ID,
+			UserID:      currentUser(c).ID,
+			Filename:    attachmentFilename(header.Filename),
+			ContentType: contentType,
+			Size:        header.Size,
+		}
+		path := cfg.path(task.ID, attachment.ID)
+		if err := saveFile(path, file); err != nil {
+			log.Printf("Failed to store attachment of task %s: %v", task.ID, err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to store attachment")
+			return
+		}
+		attachment, err = attachments.Create(attachment)
+		if err != nil {
+			os.Remove(path)
+			respondStoreError(c, err, "Task not found")
+			return
+		}
+		c.JSON(http.StatusCreated, attachment)
+	}
+}
+
+// Write the file to path, creating its directory, so that a failed write never leaves a partial file
+func saveFile(path string, src io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Keep only the base name of an uploaded file, without control characters
+func attachmentFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// List the attachments of a task the caller can see, oldest first
+func getAttachments(c *gin.Context) {
+	task, ok := loadVisibleTask(c, false)
+	if !ok {
+		return
+	}
+	list, err := attachments.ListByTask(task.ID)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Build the handler for GET /tasks/:id/attachments/:aid, which sends the file back
+// with its original name
+func downloadAttachment(cfg attachmentConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		task, ok := loadVisibleTask(c, false)
+		if !ok {
+			return
+		}
+		aid, err := uuid.Parse(c.Param("aid"))
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "Invalid attachment id: must be a UUID")
+			return
+		}
+		attachment, err := attachments.GetByID(aid.String())
+		if err == nil && attachment.TaskID != task.ID {
+			err = errNotFound
+		}
+		if err != nil {
+			respondStoreError(c, err, "Attachment not found")
+			return
+		}
+		c.Header("Content-Type", attachment.ContentType)
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.File(cfg.path(task.ID, attachment.ID))
+	}
+}
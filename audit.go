@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// What an audit entry records being done to a resource
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// Kinds of resource the audit log covers
+const (
+	AuditResourceUser = "user"
+	AuditResourceTask = "task"
+)
+
+// Fields left out of audit diffs because every write changes them
+var auditIgnoredFields = map[string]bool{"updated_at": true, "updated_by": true, "version": true}
+
+// One field's value before and after a change, as JSON. From is absent for
+// creates and To for deletes; both are absent for secret fields such as passwords.
+type auditChange struct {
+	From json.RawMessage `json:"from,omitempty"`
+	To   json.RawMessage `json:"to,omitempty"`
+}
+
+// One mutation in the audit log
+type AuditEntry struct {
+	ID uint `json:"id"`
+	// ActorID is the authenticated user that made the change, nil for registrations
+	ActorID      *string                `json:"actor_id"`
+	Action       string                 `json:"action"`
+	ResourceType string                 `json:"resource_type"`
+	ResourceID   string                 `json:"resource_id"`
+	Changes      map[string]auditChange `json:"changes"`
+	CreatedAt    time.Time              `json:"created_at"`
+}
+
+// Which audit entries to list; zero fields match everything
+type auditFilter struct {
+	ActorID      string
+	ResourceType string
+	ResourceID   string
+}
+
+func (f auditFilter) matches(entry AuditEntry) bool {
+	if f.ActorID != "" && (entry.ActorID == nil || *entry.ActorID != f.ActorID) {
+		return false
+	}
+	if f.ResourceType != "" && entry.ResourceType != f.ResourceType {
+		return false
+	}
+	return f.ResourceID == "" || entry.ResourceID == f.ResourceID
+}
+
+// Record that the authenticated user changed a resource from before to after,
+// either of which is nil for creates and deletes. Secret fields that changed are
+// named in redacted and recorded without their values. The change itself is
+// already saved by now, so a failure is logged rather than reported.
+func recordAudit(c *gin.Context, action, resourceType string, id string, before, after interface{}, redacted ...string) {
+	changes, err := auditDiff(before, after)
+	if err == nil {
+		for _, name := range redacted {
+			changes[name] = auditChange{}
+		}
+		entry := AuditEntry{Action: action, ResourceType: resourceType, ResourceID: id, Changes: changes}
+		if user := currentUser(c); user != nil {
+			entry.ActorID = &user.ID
+		}
+		_, err = audit.Create(entry)
+	}
+	if err != nil {
+		log.Printf("Failed to audit %s of %s %s: %v", action, resourceType, id, err)
+	}
+}
+
+// Compare two versions of a resource field by field, through their JSON
+func auditDiff(before, after interface{}) (map[string]auditChange, error) {
+	from, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]auditChange{}
+	for name, value := range from {
+		if !auditIgnoredFields[name] && string(value) != string(to[name]) {
+			changes[name] = auditChange{From: value, To: to[name]}
+		}
+	}
+	for name, value := range to {
+		if _, ok := from[name]; !ok && !auditIgnoredFields[name] {
+			changes[name] = auditChange{To: value}
+		}
+	}
+	return changes, nil
+}
+
+// The JSON fields of a value, none for nil
+func jsonFields(v interface{}) (map[string]json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	return fields, json.Unmarshal(b, &fields)
+}
+
+// List audit entries, oldest first, filtered by ?actor_id=, ?resource_type= and ?resource_id=; admin only
+func getAuditLog(c *gin.Context) {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	var filter auditFilter
+	if v := c.Query("actor_id"); v != "" {
+		id, ok := parseUUID(v)
+		if !ok {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "actor_id must be a UUID")
+			return
+		}
+		filter.ActorID = id
+	}
+	switch filter.ResourceType = c.Query("resource_type"); filter.ResourceType {
+	case "", AuditResourceUser, AuditResourceTask:
+	default:
+		respondError(c, http.StatusBadRequest, codeBadRequest, "resource_type must be user or task")
+		return
+	}
+	if v := c.Query("resource_id"); v != "" {
+		id, ok := parseUUID(v)
+		if !ok {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "resource_id must be a UUID")
+			return
+		}
+		filter.ResourceID = id
+	}
+	list, err := audit.List(c.Request.Context(), filter)
+	if err != nil {
+		respondStoreError(c, err, "Audit entry not found")
+		return
+	}
+	setTotalCount(c, len(list))
+	c.JSON(http.StatusOK, newPage(c, paginate(list, limit, offset), len(list), limit, offset))
+}
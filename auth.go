@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Lifetimes of issued tokens. Access tokens authenticate requests and are
+// short-lived; refresh tokens are only good for getting new access tokens.
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// Values of the typ claim that tell the two kinds of token apart
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+)
+
+// Claims carried by every issued token; the ID is what revocation keys on
+type tokenClaims struct {
+	Type string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// Key used to sign and verify tokens, set from the config in main
+var jwtSecret []byte
+
+func mustRandomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+type loginRequest struct {
+	Email    string `json:"email" normalize:"trim"`
+	Password string `json:"password"`
+}
+
+// Exchange an email and password for a signed token
+func login(c *gin.Context) {
+	var req loginRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	// Locked emails are refused before the password is even checked
+	locked, retryAfter, err := loginAttempts.locked(req.Email)
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	if locked {
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		writeError(c, http.StatusTooManyRequests, apiError{
+			Code:    codeRateLimited,
+			Message: "Too many failed login attempts; try again later",
+			Details: gin.H{"retry_after": seconds},
+		})
+		return
+	}
+	// Unknown email and wrong password get the same answer so emails can't be probed
+	user, err := users.GetByEmail(req.Email)
+	if err != nil && !errors.Is(err, errNotFound) {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	if err != nil || user.DeletedAt != nil || !checkPassword(user, req.Password) {
+		if err := loginAttempts.fail(req.Email); err != nil {
+			log.Printf("Failed to count a failed login: %v", err)
+		}
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "Invalid email or password")
+		return
+	}
+	if err := loginAttempts.reset(req.Email); err != nil {
+		log.Printf("Failed to forget failed logins: %v", err)
+	}
+	if !checkActive(c, user) {
+		return
+	}
+	token, expiresAt, err := issueToken(user, tokenTypeAccess, accessTokenTTL)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to issue token")
+		return
+	}
+	refreshToken, refreshExpiresAt, err := issueToken(user, tokenTypeRefresh, refreshTokenTTL)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to issue token")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":              token,
+		"expires_at":         expiresAt,
+		"refresh_token":      refreshToken,
+		"refresh_expires_at": refreshExpiresAt,
+	})
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Exchange a refresh token for a new access token
+func refresh(c *gin.Context) {
+	var req refreshRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	user, err := userFromToken(req.RefreshToken, tokenTypeRefresh)
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, fmt.Sprintf("Unauthorized: %v", err))
+		return
+	}
+	if !checkActive(c, *user) {
+		return
+	}
+	token, expiresAt, err := issueToken(*user, tokenTypeAccess, accessTokenTTL)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to issue token")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expiresAt,
+	})
+}
+
+// Revoke a refresh token, along with the access token presented alongside it, if any
+func logout(c *gin.Context) {
+	var req refreshRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	claims, err := parseToken(req.RefreshToken, tokenTypeRefresh)
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, fmt.Sprintf("Unauthorized: %v", err))
+		return
+	}
+	if err := revokedTokens.Revoke(claims.ID, claims.ExpiresAt.Time); err != nil {
+		respondStoreError(c, err, "Token not found")
+		return
+	}
+	if access, err := parseToken(bearerToken(c), tokenTypeAccess); err == nil && access.Subject == claims.Subject {
+		if err := revokedTokens.Revoke(access.ID, access.ExpiresAt.Time); err != nil {
+			respondStoreError(c, err, "Token not found")
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// Sign a token of the given type carrying the user ID as its subject
+func issueToken(user User, typ string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := tokenClaims{
+		Type: typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// Get the token from the Authorization header, empty when there is none
+func bearerToken(c *gin.Context) string {
+	return strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+}
+
+// Middleware to authenticate requests
+func authMiddleware(c *gin.Context) {
+	token := bearerToken(c)
+	if token == "" {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, "Unauthorized: Missing token")
+		c.Abort()
+		return
+	}
+
+	// Validate the token
+	userInfo, err := userFromToken(token, tokenTypeAccess)
+	if err != nil {
+		respondError(c, http.StatusUnauthorized, codeUnauthorized, fmt.Sprintf("Unauthorized: %v", err))
+		c.Abort()
+		return
+	}
+	if !checkActive(c, *userInfo) {
+		c.Abort()
+		return
+	}
+
+	// Set user info in the context for downstream handlers to access
+	c.Set("userInfo", userInfo)
+
+	c.Next()
+}
+
+// Validate a signed, unrevoked token of the given type and return its claims
+func parseToken(token, typ string) (*tokenClaims, error) {
+	claims := &tokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, errors.New("token expired")
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return nil, errors.New("invalid token signature")
+	case err != nil:
+		return nil, errors.New("malformed token")
+	case claims.Type != typ:
+		return nil, errors.New("wrong token type")
+	}
+	revoked, err := revokedTokens.IsRevoked(claims.ID)
+	if err != nil {
+		log.Printf("Failed to check token revocation: %v", err)
+		return nil, errors.New("could not check the token")
+	}
+	if revoked {
+		return nil, errors.New("token revoked")
+	}
+	return claims, nil
+}
+
+// Validate a token of the given type and fetch the user it was issued to
+func userFromToken(token, typ string) (*User, error) {
+	claims, err := parseToken(token, typ)
+	if err != nil {
+		return nil, err
+	}
+	id, ok := parseUUID(claims.Subject)
+	if !ok {
+		return nil, errors.New("invalid token subject")
+	}
+	user, err := users.GetByID(id)
+	if errors.Is(err, errNotFound) || (err == nil && user.DeletedAt != nil) {
+		return nil, errors.New("user no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Claims carry whole seconds, so a token issued in the second
+	// the password changed still counts as issued after it
+	if changed := user.PasswordChangedAt; changed != nil &&
+		(claims.IssuedAt == nil || claims.IssuedAt.Time.Before(changed.Truncate(time.Second))) {
+		return nil, errors.New("token issued before the password changed")
+	}
+	return &user, nil
+}
+
+// Hash a plaintext password for storage
+func hashPassword(plaintext string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Give the user a new password, refusing the tokens issued before it
+func setPassword(user *User, plaintext string) error {
+	hash, err := hashPassword(plaintext)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	user.Password = hash
+	user.PasswordChangedAt = &now
+	return nil
+}
+
+// Check a plaintext password against the user's stored hash
+func checkPassword(user User, plaintext string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(plaintext)) == nil
+}
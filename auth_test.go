@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestLoginRefusesBadCredentials(t *testing.T) {
+	srv := newTestServer(t)
+	srv.signup("Ada", "ada@example.com")
+
+	for _, tc := range []struct {
+		name, email, password string
+	}{
+		{"wrong password", "ada@example.com", "not the password"},
+		{"unknown email", "nobody@example.com", testPassword},
+	} {
+		status, body := srv.do(http.MethodPost, "/v1/login", "", gin.H{"email": tc.email, "password": tc.password})
+		if status != http.StatusUnauthorized {
+			t.Fatalf("%s: status = %d, want 401", tc.name, status)
+		}
+		// Both get the same answer, so emails can't be probed
+		if refused := responseError(t, body); refused.Message != "Invalid email or password" {
+			t.Errorf("%s: error = %q, want the shared message", tc.name, refused.Message)
+		}
+	}
+}
+
+func TestSignupRequiresAPassword(t *testing.T) {
+	srv := newTestServer(t)
+	for name, body := range map[string]gin.H{
+		"empty password":   {"name": "Ada", "email": "ada@example.com", "password": ""},
+		"missing password": {"name": "Ada", "email": "ada@example.com"},
+	} {
+		status, data := srv.do(http.MethodPost, "/v1/users", "", body)
+		if status != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400; body %s", name, status, data)
+		}
+		if refused := responseError(t, data); refused.Code != codeValidationFailed || refused.Fields["password"] == "" {
+			t.Errorf("%s: error = %+v, want a validation error on password", name, refused)
+		}
+	}
+	// The email is still free, so nobody was registered
+	srv.signup("Ada", "ada@example.com")
+}
+
+// Replacing a user without a password keeps the one they have
+func TestUserUpdateKeepsThePasswordWhenNoneIsGiven(t *testing.T) {
+	srv := newTestServer(t)
+	user, token := srv.signup("Ada", "ada@example.com")
+	srv.expect(http.StatusOK, http.MethodPut, "/v1/users/"+user.ID, token,
+		gin.H{"name": "Ada Lovelace", "email": "ada@example.com", "password": ""}, nil)
+	srv.login("ada@example.com")
+}
+
+func TestLoginIssuesATokenForTheUser(t *testing.T) {
+	srv := newTestServer(t)
+	user, token := srv.signup("Ada", "ada@example.com")
+
+	claims := &jwt.RegisteredClaims{}
+	if _, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != user.ID || claims.ExpiresAt == nil {
+		t.Errorf("token claims = %+v, want subject %s and an expiry", claims, user.ID)
+	}
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks", token, nil, nil)
+}
+
+// Sign claims for the user with the given key, valid until expiresAt
+func signedToken(t *testing.T, user User, key []byte, expiresAt time.Time) string {
+	t.Helper()
+	claims := jwt.RegisteredClaims{
+		Subject:   user.ID,
+		IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestAuthMiddlewareChecksTheToken(t *testing.T) {
+	srv := newTestServer(t)
+	user, token := srv.signup("Ada", "ada@example.com")
+
+	task := srv.createTask(token, gin.H{"title": "Task"})
+	if task.UserID != user.ID {
+		t.Errorf("task created with a token of user %s belongs to %s", user.ID, task.UserID)
+	}
+
+	for _, tc := range []struct {
+		name, token, error string
+	}{
+		{"missing", "", "Unauthorized: Missing token"},
+		{"expired", signedToken(t, user, jwtSecret, time.Now().Add(-time.Minute)), "Unauthorized: token expired"},
+		{"bad signature", signedToken(t, user, []byte("some other secret"), time.Now().Add(time.Hour)), "Unauthorized: invalid token signature"},
+		{"malformed", "not.a.token", "Unauthorized: malformed token"},
+	} {
+		status, body := srv.do(http.MethodGet, "/v1/tasks", tc.token, nil)
+		if status != http.StatusUnauthorized {
+			t.Fatalf("%s token: status = %d, want 401", tc.name, status)
+		}
+		if refused := responseError(t, body); refused.Code != codeUnauthorized || refused.Message != tc.error {
+			t.Errorf("%s token: error = %+v, want %s %q", tc.name, refused, codeUnauthorized, tc.error)
+		}
+	}
+}
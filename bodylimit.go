@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// Largest request body accepted when MAX_BODY_BYTES is not set
+const defaultMaxBodyBytes = 1 << 20
+
+// Room allowed on top of an upload for the multipart envelope around the file
+const multipartOverhead = 64 << 10
+
+// Read MAX_BODY_BYTES
+func maxBodyBytes() (int64, error) {
+	v := os.Getenv("MAX_BODY_BYTES")
+	if v == "" {
+		return defaultMaxBodyBytes, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("MAX_BODY_BYTES %q must be a positive integer", v)
+	}
+	return n, nil
+}
+
+// Middleware to cap request bodies at maxBody bytes, or at maxUpload for
+// multipart uploads. A declared length over the cap is refused with 413 up front;
+// otherwise reads past the cap fail, which bindJSON turns into a 413.
+func bodyLimitMiddleware(maxBody, maxUpload int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := maxBody
+		if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			limit = maxUpload + multipartOverhead
+		}
+		if c.Request.ContentLength > limit {
+			respondBodyTooLarge(c, limit)
+			c.Abort()
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+func respondBodyTooLarge(c *gin.Context, limit int64) {
+	respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", limit))
+}
+
+// Decode the JSON body into v and check its binding tags, answering 415 for a
+// body that is not JSON, 413 for an oversized one and 400 for anything else
+// that fails, listing every invalid field. Decoder errors are reworded so
+// clients never see Go type names. An empty PATCH body
+// leaves v untouched. On failure the error response has already been written.
+func bindJSON(c *gin.Context, v interface{}) bool {
+	emptyPatch := c.Request.Method == http.MethodPatch
+	if emptyPatch && c.Request.ContentLength == 0 {
+		return true
+	}
+	if c.Request.ContentLength != 0 && !isJSONContentType(c.GetHeader("Content-Type")) {
+		respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Content-Type must be application/json")
+		return false
+	}
+	err := c.ShouldBindJSON(v)
+	if err == nil || emptyPatch && errors.Is(err, io.EOF) {
+		return true
+	}
+	var (
+		tooLarge  *http.MaxBytesError
+		syntax    *json.SyntaxError
+		wrongType *json.UnmarshalTypeError
+		badTime   *time.ParseError
+		invalid   validator.ValidationErrors
+	)
+	switch {
+	case errors.As(err, &tooLarge):
+		respondBodyTooLarge(c, tooLarge.Limit)
+	case errors.Is(err, io.EOF):
+		respondError(c, http.StatusBadRequest, codeBadRequest, "Request body must not be empty")
+	case errors.As(err, &syntax), errors.Is(err, io.ErrUnexpectedEOF):
+		respondError(c, http.StatusBadRequest, codeBadRequest, "Request body is not valid JSON")
+	case errors.As(err, &wrongType) && wrongType.Field != "":
+		respondFieldError(c, wrongType.Field, "must be "+jsonTypeName(wrongType.Type))
+	case errors.As(err, &badTime):
+		respondError(c, http.StatusBadRequest, codeValidationFailed, "Timestamps must be RFC 3339, like 2006-01-02T15:04:05Z")
+	case errors.As(err, &invalid):
+		respondInvalid(c, validationFieldErrors(invalid))
+	default:
+		respondError(c, http.StatusBadRequest, codeBadRequest, "Request body does not match the expected shape")
+	}
+	return false
+}
+
+// Report whether a Content-Type header names JSON, ignoring case and
+// parameters such as charset
+func isJSONContentType(header string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	return err == nil && mediaType == "application/json"
+}
+
+// Describe a Go type the way a JSON client would know it
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a non-negative integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Most tasks accepted by one bulk request
+const maxBulkTasks = 100
+
+// Create a batch of tasks owned by the caller. The whole batch is validated
+// first and rejected if any item is invalid, so either all tasks are created or none.
+func createTasksBulk(c *gin.Context) {
+	var batch []Task
+	if !bindJSON(c, &batch) {
+		return
+	}
+	if len(batch) == 0 {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "Batch must contain at least one task")
+		return
+	}
+	if len(batch) > maxBulkTasks {
+		respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("Batch must not contain more than %d tasks", maxBulkTasks))
+		return
+	}
+
+	userID := currentUser(c).ID
+	for i := range batch {
+		if err := prepareNewTask(&batch[i]); err != nil {
+			e := apiError{
+				Code:    codeValidationFailed,
+				Message: fmt.Sprintf("Task at index %d: %v", i, err),
+				Details: gin.H{"index": i},
+			}
+			var fields fieldErrors
+			if errors.As(err, &fields) {
+				e.Fields = fields
+			}
+			writeError(c, http.StatusBadRequest, e)
+			return
+		}
+		exists, err := assigneeExists(batch[i].AssigneeID)
+		if err != nil {
+			respondStoreError(c, err, "Assignee not found")
+			return
+		}
+		if !exists {
+			writeError(c, http.StatusNotFound, apiError{
+				Code:    codeNotFound,
+				Message: fmt.Sprintf("Task at index %d: Assignee not found", i),
+				Details: gin.H{"index": i},
+			})
+			return
+		}
+		batch[i].UserID = userID
+		batch[i].CreatedBy, batch[i].UpdatedBy = userID, userID
+		// Parents and blockers must already exist; a batch cannot refer to its own tasks
+		status, message, err := parentProblem("", userID, batch[i].ParentID)
+		if err == nil && status == 0 {
+			status, message, err = blockerProblem("", userID, batch[i].BlockedBy)
+		}
+		if err != nil {
+			respondStoreError(c, err, "Task not found")
+			return
+		}
+		if status != 0 {
+			code := codeNotFound
+			if status == http.StatusBadRequest {
+				code = codeValidationFailed
+			}
+			writeError(c, status, apiError{
+				Code:    code,
+				Message: fmt.Sprintf("Task at index %d: %s", i, message),
+				Details: gin.H{"index": i},
+			})
+			return
+		}
+	}
+
+	if !checkTaskQuota(c, len(batch)) {
+		return
+	}
+	created, err := tasks.CreateMany(batch)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	for _, task := range created {
+		recordAudit(c, AuditCreate, AuditResourceTask, task.ID, nil, task)
+		notifyTaskEvent(EventTaskCreated, task)
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// Request body for fetching many tasks at once
+type batchGetRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// Fetch many tasks by ID in one round trip. Tasks come back in the order
+// asked for; IDs of tasks that don't exist, are deleted or that the caller
+// cannot see are listed in missing instead.
+func getTasksBatch(c *gin.Context) {
+	var req batchGetRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if len(req.IDs) == 0 {
+		respondFieldError(c, "ids", "must contain at least one task ID")
+		return
+	}
+	if len(req.IDs) > maxBulkTasks {
+		respondFieldError(c, "ids", fmt.Sprintf("must not contain more than %d task IDs", maxBulkTasks))
+		return
+	}
+
+	user := currentUser(c)
+	found := []Task{}
+	missing := []string{}
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		task, err := tasks.GetByID(id)
+		if err != nil && !errors.Is(err, errNotFound) {
+			respondStoreError(c, err, "Task not found")
+			return
+		}
+		if err != nil || task.DeletedAt != nil || !canViewTask(user, task) {
+			missing = append(missing, id)
+			continue
+		}
+		found = append(found, task)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": found, "missing": missing})
+}
+
+// Request body for moving many tasks to one status
+type bulkStatusRequest struct {
+	IDs    []string `json:"ids"`
+	Status string   `json:"status"`
+}
+
+// The outcome for one task of a bulk status update: the saved task, or why it was skipped
+type bulkStatusResult struct {
+	ID       string    `json:"id"`
+	OK       bool      `json:"ok"`
+	Task     *Task     `json:"task,omitempty"`
+	NextTask *Task     `json:"next_task,omitempty"`
+	Error    *apiError `json:"error,omitempty"`
+}
+
+// Move many of the caller's tasks to one status. Each task is checked and
+// saved on its own, against the same rules as a single update, and the
+// response reports the outcome for every ID in the order given.
+func updateTasksStatusBulk(c *gin.Context) {
+	var req bulkStatusRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if len(req.IDs) == 0 {
+		respondFieldError(c, "ids", "must contain at least one task ID")
+		return
+	}
+	if len(req.IDs) > maxBulkTasks {
+		respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("Batch must not contain more than %d tasks", maxBulkTasks))
+		return
+	}
+	if !isValidStatus(req.Status) {
+		respondFieldError(c, "status", invalidStatusMessage(req.Status))
+		return
+	}
+
+	results := make([]bulkStatusResult, 0, len(req.IDs))
+	updated := 0
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result := setTaskStatus(c, id, req.Status)
+		if result.OK {
+			updated++
+		}
+		results = append(results, result)
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": updated, "results": results})
+}
+
+// Move one task of a bulk request to the status, notifying and recording the
+// change like a single update would
+func setTaskStatus(c *gin.Context, id string, status string) bulkStatusResult {
+	fail := func(code, message string, details gin.H) bulkStatusResult {
+		return bulkStatusResult{ID: id, Error: &apiError{Code: code, Message: message, Details: details}}
+	}
+	task, err := tasks.GetByID(id)
+	if errors.Is(err, errNotFound) || err == nil && task.DeletedAt != nil {
+		return fail(codeNotFound, "Task not found", nil)
+	}
+	if err != nil {
+		log.Printf("Failed to load task %s: %v", id, err)
+		return fail(codeInternal, "Internal server error", nil)
+	}
+	if !ownsTask(currentUser(c), task) {
+		return fail(codeForbidden, "Forbidden: task belongs to another user", nil)
+	}
+	from := task.Status
+	if from == status {
+		return bulkStatusResult{ID: id, OK: true, Task: &task}
+	}
+	if !canTransition(from, status) {
+		return fail(codeInvalidTransition, fmt.Sprintf("Invalid status transition from %s to %s", from, status),
+			gin.H{"from": from, "to": status})
+	}
+	before := task
+	task.Status = status
+	trackCompletion(&task, from)
+	task.UpdatedBy = currentUser(c).ID
+	problem, err := completionProblem(from, task)
+	if err != nil {
+		log.Printf("Failed to load blockers of task %s: %v", id, err)
+		return fail(codeInternal, "Internal server error", nil)
+	}
+	if problem != nil {
+		return bulkStatusResult{ID: id, Error: problem}
+	}
+	problem, err = occurrenceQuotaProblem(c.Request.Context(), from, task)
+	if err != nil {
+		log.Printf("Failed to check the quota for the next occurrence of task %s: %v", id, err)
+		return fail(codeInternal, "Internal server error", nil)
+	}
+	if problem != nil {
+		return bulkStatusResult{ID: id, Error: problem}
+	}
+	task, err = tasks.Update(id, task)
+	if errors.Is(err, errVersionConflict) {
+		return fail(codeVersionConflict, "Task was modified by someone else; retry", nil)
+	}
+	if err != nil {
+		log.Printf("Failed to update task %s: %v", id, err)
+		return fail(codeInternal, "Internal server error", nil)
+	}
+	recordStatusChange(c, id, from, task.Status)
+	recordAudit(c, AuditUpdate, AuditResourceTask, id, before, task)
+	notifyTaskEvent(EventTaskUpdated, task)
+	result := bulkStatusResult{ID: id, OK: true, Task: &task}
+	next, err := createNextOccurrence(from, task)
+	if err != nil {
+		log.Printf("Failed to create the next occurrence of task %s: %v", id, err)
+	} else if next != nil {
+		recordAudit(c, AuditCreate, AuditResourceTask, next.ID, nil, *next)
+		notifyTaskEvent(EventTaskCreated, *next)
+		result.NextTask = next
+	}
+	return result
+}
+
+// Request body for deleting many tasks at once
+type batchDeleteRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// The outcome for one task of a batch delete
+type batchDeleteResult struct {
+	ID    string    `json:"id"`
+	OK    bool      `json:"ok"`
+	Error *apiError `json:"error,omitempty"`
+}
+
+// Delete many of the caller's tasks, as a "clear completed" button does. Each
+// task is soft-deleted on its own, like a single delete with the same
+// ?cascade=, and the response reports the outcome for every ID in the order
+// given: deleted, not found, or not the caller's to delete. With
+// ?dry_run=true nothing is deleted; what would be is reported instead.
+func deleteTasksBatch(c *gin.Context) {
+	cascade, ok := boolParam(c, "cascade")
+	if !ok {
+		return
+	}
+	dryRun, ok := dryRunParam(c)
+	if !ok {
+		return
+	}
+	var req batchDeleteRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if len(req.IDs) == 0 {
+		respondFieldError(c, "ids", "must contain at least one task ID")
+		return
+	}
+	if len(req.IDs) > maxBulkTasks {
+		respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("Batch must not contain more than %d tasks", maxBulkTasks))
+		return
+	}
+
+	user := currentUser(c)
+	if dryRun {
+		previewTasksBatch(c, user, req.IDs, cascade)
+		return
+	}
+	results := make([]batchDeleteResult, 0, len(req.IDs))
+	deleted := 0
+	seen := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		result := batchDeleteResult{ID: id}
+		task, err := apiLoadTask(user, id, ownsTask)
+		if err == nil {
+			err = apiDeleteTask(c, task, cascade)
+		}
+		var e apiError
+		switch {
+		case err == nil:
+			result.OK = true
+			deleted++
+		case errors.As(err, &e):
+			if e.Code == codeBadRequest {
+				// An ID that isn't a UUID names no task
+				e = apiError{Code: codeNotFound, Message: "Task not found"}
+			}
+			result.Error = &e
+		default:
+			log.Printf("Failed to delete task %s: %v", id, err)
+			result.Error = &apiError{Code: codeInternal, Message: "Internal server error"}
+		}
+		results = append(results, result)
+	}
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted, "results": results})
+}
+
+// Report the tasks deleteTasksBatch would delete, in the order it would
+// delete them, without touching any. Tasks it would refuse are left out, as
+// are ones an earlier task of the batch would already have taken with it.
+func previewTasksBatch(c *gin.Context, user *User, ids []string, cascade bool) {
+	var taskIDs []string
+	gone := map[string]bool{}
+	for _, id := range ids {
+		task, err := apiLoadTask(user, id, ownsTask)
+		var e apiError
+		if errors.As(err, &e) && e.Code == codeInternal {
+			respondError(c, http.StatusInternalServerError, codeInternal, "Internal server error")
+			return
+		}
+		if err != nil || gone[task.ID] {
+			continue
+		}
+		descendants, err := liveDescendants(c.Request.Context(), task.ID)
+		if err != nil {
+			respondStoreError(c, err, "Task not found")
+			return
+		}
+		descendants = filterTasks(descendants, func(t Task) bool { return !gone[t.ID] })
+		if len(descendants) > 0 && !cascade {
+			continue
+		}
+		for _, descendant := range descendants {
+			taskIDs = append(taskIDs, descendant.ID)
+			gone[descendant.ID] = true
+		}
+		taskIDs = append(taskIDs, task.ID)
+		gone[task.ID] = true
+	}
+	respondDeletePreview(c, nil, taskIDs)
+}
@@ -0,0 +1,16 @@
+package main
+
+import "regexp"
+
+// A task color is a hex code such as #1E90FF
+var colorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// Whether color is a #RRGGBB hex code; the empty string, meaning no color, is valid too
+func isValidColor(color string) bool {
+	return color == "" || colorPattern.MatchString(color)
+}
+
+// Error message shared by handlers that reject a color
+func invalidColorMessage(color string) string {
+	return "Invalid color \"" + color + "\": must be a hex code such as #1E90FF"
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Comment struct {
+	ID        uint      `json:"id"`
+	TaskID    string    `json:"task_id"`
+	UserID    string    `json:"user_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type commentRequest struct {
+	Body string `json:"body"`
+}
+
+// Comment on a task the caller can see
+func createComment(c *gin.Context) {
+	task, ok := loadVisibleTask(c, false)
+	if !ok {
+		return
+	}
+	var req commentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		respondFieldError(c, "body", "Comment body must not be empty")
+		return
+	}
+	comment, err := comments.Create(Comment{
+		TaskID: task.ID,
+		UserID: currentUser(c).ID,
+		Body:   req.Body,
+	})
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	c.JSON(http.StatusCreated, comment)
+}
+
+// List the comments on a task the caller can see, oldest first
+func getComments(c *gin.Context) {
+	task, ok := loadVisibleTask(c, false)
+	if !ok {
+		return
+	}
+	list, err := comments.ListByTask(task.ID)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Responses smaller than this are sent uncompressed; gzip would barely shrink them
+const gzipMinBytes = 1024
+
+// Content types worth compressing. Attachments such as images and PDFs are
+// already compressed and stream-based SSE must not be held back.
+var compressibleTypes = map[string]bool{
+	"application/json": true,
+	"text/csv":         true,
+	"text/plain":       true,
+}
+
+// Middleware that gzips responses for clients sending Accept-Encoding: gzip.
+// Bodies are buffered until gzipMinBytes is reached, so small responses go
+// out as they are, with a Content-Length.
+func gzipMiddleware(c *gin.Context) {
+	c.Header("Vary", "Accept-Encoding")
+	if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		c.Next()
+		return
+	}
+	w := &gzipWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+	w.finish()
+}
+
+// Whether an Accept-Encoding header lists gzip (or *) without q=0
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "gzip" && name != "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			if p = strings.TrimSpace(p); strings.HasPrefix(p, "q=") {
+				q, _ = strconv.ParseFloat(p[len("q="):], 64)
+			}
+		}
+		return q > 0
+	}
+	return false
+}
+
+// gzipWriter holds the start of the body back until it knows whether to compress
+type gzipWriter struct {
+	gin.ResponseWriter
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+	decided bool
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf.Write(b)
+	if w.buf.Len() >= gzipMinBytes {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends whatever is buffered, so streamed responses keep streaming
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Settle on compressing or not, then write out the buffered start of the body
+func (w *gzipWriter) decide() error {
+	w.decided = true
+	h := w.Header()
+	contentType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	// A handler that set its own length or encoding (such as a file download) is left alone
+	if compressibleTypes[contentType] && h.Get("Content-Encoding") == "" && h.Get("Content-Length") == "" {
+		h.Set("Content-Encoding", "gzip")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+		_, err := w.gz.Write(w.buf.Bytes())
+		return err
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
+
+// Write out a body that stayed small, or end the gzip stream
+func (w *gzipWriter) finish() {
+	if w.decided {
+		if w.gz != nil {
+			w.gz.Close()
+		}
+		return
+	}
+	if w.buf.Len() > 0 {
+		w.Header().Set("Content-Length", strconv.Itoa(w.buf.Len()))
+		w.ResponseWriter.Write(w.buf.Bytes())
+	}
+}
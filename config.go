@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// File read for settings when CONFIG_FILE is not set, if it exists
+const defaultConfigFile = ".env"
+
+// Config holds every setting read at startup
+type Config struct {
+	Addr string
+	// GRPCAddr is where the gRPC server listens
+	GRPCAddr  string
+	JWTSecret []byte
+	// Storage is "memory", "sqlite" or "redis"; DatabasePath is only used by
+	// sqlite and Redis by redis
+	Storage            string
+	DatabasePath       string
+	Redis              redisConfig
+	Snapshots          snapshotConfig
+	RateLimitPerMinute int
+	DefaultPageSize    int
+	MaxPageSize        int
+	CORSOrigins        []string
+	MaxBodyBytes       int64
+	ImportMaxBytes     int64
+	Attachments        attachmentConfig
+	LoginMaxAttempts   int
+	LoginLockoutWindow time.Duration
+	IdempotencyTTL     time.Duration
+	TaskQuota          int
+	Reminders          reminderConfig
+	SMTP               smtpConfig
+	PasswordReset      passwordResetConfig
+	ReadyMaxLatency    time.Duration
+	RequestTimeout     time.Duration
+	Timezone           *time.Location
+}
+
+// configError lists every problem found in the configuration, so they can
+// all be fixed in one go
+type configError []string
+
+func (e configError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e, "\n  - ")
+}
+
+// Load the configuration from the environment, after filling in variables
+// that are not set from the optional config file.
+// JWT_SECRET is required in release mode; elsewhere a random secret is used.
+func loadConfig() (Config, error) {
+	var problems configError
+	check := func(err error) {
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	check(loadConfigFile())
+	// gin read GIN_MODE before the config file could set it
+	switch mode := os.Getenv("GIN_MODE"); mode {
+	case "":
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+		gin.SetMode(mode)
+	default:
+		problems = append(problems, fmt.Sprintf("GIN_MODE %q must be debug, release or test", mode))
+	}
+
+	var cfg Config
+	var err error
+	cfg.Addr, err = listenAddr()
+	check(err)
+	cfg.GRPCAddr, err = grpcListenAddr()
+	check(err)
+	cfg.Storage, cfg.DatabasePath, err = storageSettings()
+	check(err)
+	cfg.Redis, err = redisSettings()
+	check(err)
+	cfg.Snapshots, err = snapshotSettings()
+	check(err)
+	if cfg.Snapshots.path != "" && (cfg.Storage == "sqlite" || cfg.Storage == "redis") {
+		problems = append(problems, "SNAPSHOT_PATH only applies when STORAGE is memory")
+	}
+	cfg.RateLimitPerMinute, err = rateLimitPerMinute()
+	check(err)
+	cfg.DefaultPageSize, cfg.MaxPageSize, err = pageSizeSettings()
+	check(err)
+	cfg.CORSOrigins = corsOrigins()
+	cfg.MaxBodyBytes, err = maxBodyBytes()
+	check(err)
+	cfg.ImportMaxBytes, err = importMaxBytes()
+	check(err)
+	cfg.Attachments, err = attachmentSettings()
+	check(err)
+	cfg.LoginMaxAttempts, cfg.LoginLockoutWindow, err = loginLockoutConfig()
+	check(err)
+	cfg.IdempotencyTTL, err = idempotencyTTL()
+	check(err)
+	cfg.TaskQuota, err = taskQuotaSetting()
+	check(err)
+	cfg.Reminders, err = reminderSettings()
+	check(err)
+	cfg.SMTP, err = smtpSettings()
+	check(err)
+	cfg.PasswordReset, err = passwordResetSettings()
+	check(err)
+	cfg.ReadyMaxLatency, err = readyMaxLatency()
+	check(err)
+	cfg.RequestTimeout, err = requestTimeout()
+	check(err)
+	cfg.Timezone, err = timezoneSetting()
+	check(err)
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		cfg.JWTSecret = []byte(secret)
+	} else if gin.Mode() == gin.ReleaseMode {
+		problems = append(problems, "JWT_SECRET is required when GIN_MODE is release")
+	}
+
+	if problems != nil {
+		return Config{}, problems
+	}
+	if cfg.JWTSecret == nil {
+		// Tokens simply stop working on restart instead of being forgeable
+		log.Println("JWT_SECRET is not set, using a random secret; tokens will not survive a restart")
+		cfg.JWTSecret = mustRandomBytes(32)
+	}
+	return cfg, nil
+}
+
+// Set the variables named in CONFIG_FILE, or in .env when it exists, that the
+// environment doesn't already set. Files ending in .yaml or .yml hold a
+// mapping of variable names to values; any other file has KEY=value lines.
+func loadConfigFile() error {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		if _, err := os.Stat(defaultConfigFile); err != nil {
+			return nil
+		}
+		path = defaultConfigFile
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("CONFIG_FILE: %v", err)
+	}
+	var values map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		values, err = parseYAMLConfig(data)
+	default:
+		values, err = parseEnvFile(string(data))
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %v", path, err)
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); !set {
+			os.Setenv(key, value)
+		}
+	}
+	return nil
+}
+
+// Parse KEY=value lines, skipping blank lines and # comments. Values may be
+// quoted and lines may start with "export ".
+func parseEnvFile(data string) (map[string]string, error) {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		text = strings.TrimPrefix(text, "export ")
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("line %d: expected KEY=value", line)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// Parse a YAML mapping of variable names to scalars. A list becomes a
+// comma-separated value, as used by CORS_ALLOWED_ORIGINS and ADMIN_EMAILS.
+func parseYAMLConfig(data []byte) (map[string]string, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(raw))
+	for key, v := range raw {
+		switch v := v.(type) {
+		case nil:
+			values[key] = ""
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s must be a value or a list, not a mapping", key)
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
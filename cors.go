@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Read the comma-separated CORS_ALLOWED_ORIGINS list. Empty disables CORS.
+func corsOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// Response headers browser clients may read
+var exposedHeaders = []string{requestIDHeader, "Retry-After", "ETag", apiVersionHeader, "Deprecation", "Link", idempotentReplayHeader, totalCountHeader}
+
+// Middleware to allow browser clients from the given origins.
+// A "*" entry allows any origin, but then credentials are never allowed,
+// as browsers reject wildcard responses to credentialed requests.
+func corsMiddleware(allowed []string) gin.HandlerFunc {
+	wildcard := false
+	allowedSet := make(map[string]bool, len(allowed))
+	for _, origin := range allowed {
+		if origin == "*" {
+			wildcard = true
+		}
+		allowedSet[origin] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if origin != "" {
+			header := c.Writer.Header()
+			header.Add("Vary", "Origin")
+			switch {
+			case allowedSet[origin]:
+				header.Set("Access-Control-Allow-Origin", origin)
+				header.Set("Access-Control-Allow-Credentials", "true")
+			case wildcard:
+				header.Set("Access-Control-Allow-Origin", "*")
+			}
+			header.Set("Access-Control-Expose-Headers", strings.Join(exposedHeaders, ", "))
+			if preflight && header.Get("Access-Control-Allow-Origin") != "" {
+				header.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+				header.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, Idempotency-Key")
+				header.Set("Access-Control-Max-Age", "600")
+			}
+		}
+
+		// Preflights are answered here, whether or not the origin was allowed
+		if preflight {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Send a browser's preflight for a POST /v1/tasks from origin
+func preflight(srv *testServer, origin string) *http.Response {
+	srv.t.Helper()
+	req, err := http.NewRequest(http.MethodOptions, srv.URL+"/v1/tasks", nil)
+	if err != nil {
+		srv.t.Fatal(err)
+	}
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		srv.t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestCORSPreflight(t *testing.T) {
+	srv := newTestServer(t, "CORS_ALLOWED_ORIGINS", "https://app.example.com")
+
+	resp := preflight(srv, "https://evil.example.com")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("disallowed origin: status = %d, want 204", resp.StatusCode)
+	}
+	for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers"} {
+		if v := resp.Header.Get(name); v != "" {
+			t.Errorf("disallowed origin: %s = %q, want none", name, v)
+		}
+	}
+
+	resp = preflight(srv, "https://app.example.com")
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("allowed origin: status = %d, want 204", resp.StatusCode)
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Origin"); v != "https://app.example.com" {
+		t.Errorf("allowed origin: Access-Control-Allow-Origin = %q", v)
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Credentials"); v != "true" {
+		t.Errorf("allowed origin: Access-Control-Allow-Credentials = %q, want true", v)
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Headers"); !strings.Contains(v, "Authorization") {
+		t.Errorf("allowed origin: Access-Control-Allow-Headers = %q, want Authorization among them", v)
+	}
+}
+
+func TestCORSWildcardNeverAllowsCredentials(t *testing.T) {
+	srv := newTestServer(t, "CORS_ALLOWED_ORIGINS", "*")
+
+	resp := preflight(srv, "https://anywhere.example.com")
+	if v := resp.Header.Get("Access-Control-Allow-Origin"); v != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", v)
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Credentials"); v != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want none", v)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Count the caller's tasks, honouring the same filters as GET /tasks
+func countTasks(c *gin.Context) {
+	list, ok := queryTasks(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"count": len(list)})
+}
+
+// Count the users that are not deleted
+func countUsers(c *gin.Context) {
+	n, err := users.Count()
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"count": n})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deactivation offboards a user without deleting anything: they can no
+// longer log in or use their tokens, and the tasks they own are hidden from
+// their assignees, but everything is kept for when they are activated again.
+
+const accountDeactivatedMessage = "Account is deactivated"
+
+// Respond with 403 unless the user is active.
+// On failure the error response has already been written.
+func checkActive(c *gin.Context, user User) bool {
+	if user.Active {
+		return true
+	}
+	respondError(c, http.StatusForbidden, codeAccountDeactivated, accountDeactivatedMessage)
+	return false
+}
+
+// Report whether the user is active, for deciding whether others may see
+// their tasks. Users that can't be loaded count as inactive.
+func userActive(id string) bool {
+	user, err := users.GetByID(id)
+	if err != nil {
+		log.Printf("Failed to load user %s: %v", id, err)
+		return false
+	}
+	return user.Active
+}
+
+// IDs of the deactivated users, for hiding their tasks from lists
+func inactiveUserIDs(ctx context.Context) (map[string]bool, error) {
+	list, err := users.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inactive := map[string]bool{}
+	for _, user := range list {
+		if !user.Active {
+			inactive[user.ID] = true
+		}
+	}
+	return inactive, nil
+}
+
+// Deactivate a user. Admins may deactivate anyone and users themselves.
+func deactivateUser(c *gin.Context) {
+	setUserActive(c, false)
+}
+
+// Activate a deactivated user again. As deactivated users can't
+// authenticate, in practice only admins can.
+func activateUser(c *gin.Context) {
+	setUserActive(c, true)
+}
+
+func setUserActive(c *gin.Context, active bool) {
+	user, ok := loadUser(c, false)
+	if !ok || !checkUserAccess(c, user) {
+		return
+	}
+	if user.Active == active {
+		message := "User is already deactivated"
+		if active {
+			message = "User is already active"
+		}
+		respondError(c, http.StatusConflict, codeConflict, message)
+		return
+	}
+	updated := user
+	updated.Active = active
+	updated, err := users.Update(user.ID, updated)
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	recordAudit(c, AuditUpdate, AuditResourceUser, user.ID, user, updated)
+	c.JSON(http.StatusOK, updated)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Drop duplicate blocker IDs, keeping the first occurrence of each
+func normalizeBlockers(ids []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// Check that a task may be blocked by ids: each must be a live task of the same
+// owner, and none may depend on taskID (zero for a task not yet created), directly or not.
+// Returns the HTTP status and message for a rejected list, or a store error.
+func blockerProblem(taskID, ownerID string, ids []string) (int, string, error) {
+	seen := map[string]bool{}
+	pending := []string{}
+	for _, id := range ids {
+		if taskID != "" && id == taskID {
+			return http.StatusBadRequest, "A task cannot block itself", nil
+		}
+		blocker, err := tasks.GetByID(id)
+		if errors.Is(err, errNotFound) || (err == nil && (blocker.DeletedAt != nil || blocker.UserID != ownerID)) {
+			return http.StatusNotFound, fmt.Sprintf("Blocking task %s not found", id), nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		seen[id] = true
+		pending = append(pending, blocker.BlockedBy...)
+	}
+	if taskID == "" {
+		return 0, "", nil
+	}
+	// Follow the existing dependencies of the new blockers looking for taskID
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id == taskID {
+			return http.StatusBadRequest, "Blocking tasks would create a dependency cycle", nil
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		task, err := tasks.GetByID(id)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		pending = append(pending, task.BlockedBy...)
+	}
+	return 0, "", nil
+}
+
+// Respond to a rejected blocker list. On failure the error response has already been written.
+func checkBlockers(c *gin.Context, taskID, ownerID string, ids []string) bool {
+	status, message, err := blockerProblem(taskID, ownerID, ids)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return false
+	}
+	if status == http.StatusBadRequest {
+		respondFieldError(c, "blocked_by", message)
+		return false
+	}
+	if status != 0 {
+		respondError(c, status, codeNotFound, message)
+		return false
+	}
+	return true
+}
+
+// Get the blockers of a task that are still open. Done and cancelled
+// blockers no longer block, and neither do deleted ones.
+func openBlockers(task Task) ([]Task, error) {
+	open := []Task{}
+	for _, id := range task.BlockedBy {
+		blocker, err := tasks.GetByID(id)
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if blocker.DeletedAt == nil && blocker.Status != StatusDone && blocker.Status != StatusCancelled {
+			open = append(open, blocker)
+		}
+	}
+	return open, nil
+}
+
+// A task may only move to done once its blockers are done or cancelled.
+// Returns the error to report for a save that completes a task with open
+// blockers, or nil when the save doesn't complete it or nothing blocks it.
+func completionProblem(from string, task Task) (*apiError, error) {
+	if task.Status != StatusDone || from == StatusDone {
+		return nil, nil
+	}
+	open, err := openBlockers(task)
+	if err != nil {
+		return nil, err
+	}
+	if len(open) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(open))
+	for i, blocker := range open {
+		ids[i] = blocker.ID
+	}
+	return &apiError{
+		Code:    codeTaskBlocked,
+		Message: "Task is blocked by tasks that are not done",
+		Details: gin.H{"blockers": ids},
+	}, nil
+}
+
+// Refuse with 409 to move a task to done while it has open blockers.
+// On failure the error response has already been written.
+func checkCanComplete(c *gin.Context, from string, task Task) bool {
+	problem, err := completionProblem(from, task)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return false
+	}
+	if problem != nil {
+		writeError(c, http.StatusConflict, *problem)
+		return false
+	}
+	return true
+}
+
+// List the tasks currently blocking a task
+func getBlockers(c *gin.Context) {
+	task, ok := loadVisibleTask(c, false)
+	if !ok {
+		return
+	}
+	open, err := openBlockers(task)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	c.JSON(http.StatusOK, open)
+}
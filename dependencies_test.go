@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fail the test unless err is TASK_BLOCKED naming blocker
+func expectBlocked(t *testing.T, what string, err apiError, blocker string) {
+	t.Helper()
+	blockers, _ := err.Details["blockers"].([]interface{})
+	if err.Code != codeTaskBlocked || len(blockers) != 1 || blockers[0] != blocker {
+		t.Errorf("%s: error = %+v, want TASK_BLOCKED by %s", what, err, blocker)
+	}
+}
+
+func TestBlockedTasksCannotBeCompleted(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	blocker := srv.createTask(token, gin.H{"title": "Blocker"})
+	blocked := srv.createTask(token, gin.H{"title": "Blocked", "blocked_by": []string{blocker.ID}})
+	path := "/v1/tasks/" + blocked.ID
+
+	status, body := srv.do(http.MethodPatch, path, token, gin.H{"status": StatusDone})
+	if status != http.StatusConflict {
+		t.Fatalf("PATCH: status = %d, want 409; body %s", status, body)
+	}
+	expectBlocked(t, "PATCH", responseError(t, body), blocker.ID)
+
+	status, body = srv.do(http.MethodPut, path, token, gin.H{"title": "Blocked", "status": StatusDone, "blocked_by": []string{blocker.ID}})
+	if status != http.StatusConflict {
+		t.Fatalf("PUT: status = %d, want 409; body %s", status, body)
+	}
+	expectBlocked(t, "PUT", responseError(t, body), blocker.ID)
+
+	var bulk struct {
+		Results []bulkStatusResult `json:"results"`
+	}
+	srv.expect(http.StatusOK, http.MethodPatch, "/v1/tasks/bulk", token, gin.H{"ids": []string{blocked.ID}, "status": StatusDone}, &bulk)
+	if len(bulk.Results) != 1 || bulk.Results[0].Error == nil {
+		t.Fatalf("bulk results = %+v, want the task refused", bulk.Results)
+	}
+	expectBlocked(t, "bulk", *bulk.Results[0].Error, blocker.ID)
+
+	// Once the blocker is done, so can the blocked task be
+	srv.expect(http.StatusOK, http.MethodPatch, "/v1/tasks/"+blocker.ID, token, gin.H{"status": StatusDone}, nil)
+	srv.expect(http.StatusOK, http.MethodPatch, path, token, gin.H{"status": StatusDone}, nil)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Read ?dry_run=, which makes a delete report what it would remove instead
+// of removing it. On failure the error response has already been written.
+func dryRunParam(c *gin.Context) (bool, bool) {
+	return boolParam(c, "dry_run")
+}
+
+// Answer a dry-run delete with the users and tasks it would have deleted, in
+// the order it would have deleted them, and how many of each
+func respondDeletePreview(c *gin.Context, userIDs, taskIDs []string) {
+	if userIDs == nil {
+		userIDs = []string{}
+	}
+	if taskIDs == nil {
+		taskIDs = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"dry_run":      true,
+		"would_delete": gin.H{"users": userIDs, "tasks": taskIDs},
+		"counts":       gin.H{"users": len(userIDs), "tasks": len(taskIDs)},
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The body of a dry-run delete
+type deletePreview struct {
+	DryRun      bool `json:"dry_run"`
+	WouldDelete struct {
+		Users []string `json:"users"`
+		Tasks []string `json:"tasks"`
+	} `json:"would_delete"`
+	Counts struct {
+		Users int `json:"users"`
+		Tasks int `json:"tasks"`
+	} `json:"counts"`
+}
+
+// Everything the stores hold about users and tasks, to compare before and after
+func storedState(t *testing.T) string {
+	t.Helper()
+	ctx := context.Background()
+	userList, err := users.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskList, err := tasks.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := audit.List(ctx, auditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal([]interface{}{userList, taskList, entries})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Fail the test unless the preview names exactly the given users and tasks
+func expectPreview(t *testing.T, what string, got deletePreview, userIDs, taskIDs []string) {
+	t.Helper()
+	sorted := func(ids []string) []string {
+		ids = append([]string{}, ids...)
+		sort.Strings(ids)
+		return ids
+	}
+	if !got.DryRun ||
+		!equalStrings(sorted(got.WouldDelete.Users), sorted(userIDs)) || got.Counts.Users != len(userIDs) ||
+		!equalStrings(sorted(got.WouldDelete.Tasks), sorted(taskIDs)) || got.Counts.Tasks != len(taskIDs) {
+		t.Errorf("%s: preview = %+v, want users %q and tasks %q", what, got, userIDs, taskIDs)
+	}
+}
+
+func TestDryRunDeletesChangeNothing(t *testing.T) {
+	srv := newTestServer(t, "ADMIN_EMAILS", "admin@example.com")
+	_, adminToken := srv.signup("Admin", "admin@example.com")
+	ada, token := srv.signup("Ada", "ada@example.com")
+	parent := srv.createTask(token, gin.H{"title": "Parent"})
+	child := srv.createTask(token, gin.H{"title": "Child", "parent_id": parent.ID})
+	other := srv.createTask(token, gin.H{"title": "Other"})
+	before := storedState(t)
+
+	var preview deletePreview
+	srv.expect(http.StatusOK, http.MethodDelete, "/v1/tasks/"+parent.ID+"?dry_run=true&cascade=true", token, nil, &preview)
+	expectPreview(t, "task delete", preview, nil, []string{parent.ID, child.ID})
+
+	preview = deletePreview{}
+	srv.expect(http.StatusOK, http.MethodPost, "/v1/tasks/batch-delete?dry_run=true&cascade=true", token,
+		gin.H{"ids": []string{parent.ID, other.ID}}, &preview)
+	expectPreview(t, "batch delete", preview, nil, []string{parent.ID, child.ID, other.ID})
+
+	preview = deletePreview{}
+	srv.expect(http.StatusOK, http.MethodDelete, "/v1/users/"+ada.ID+"?dry_run=true", adminToken, nil, &preview)
+	expectPreview(t, "user delete", preview, []string{ada.ID}, []string{parent.ID, child.ID, other.ID})
+
+	if after := storedState(t); after != before {
+		t.Errorf("dry runs changed the stores:\nbefore %s\nafter  %s", before, after)
+	}
+}
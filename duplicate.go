@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Optional request body for duplicating a task
+type duplicateRequest struct {
+	Title *string `json:"title"`
+}
+
+// Create a fresh todo task owned by the caller from a task they can see,
+// copying its title, description, priority and tags. Comments, history,
+// and links to other tasks stay with the original. The body may override the title.
+func duplicateTask(c *gin.Context) {
+	task, ok := loadVisibleTask(c, false)
+	if !ok {
+		return
+	}
+	var req duplicateRequest
+	if c.Request.ContentLength != 0 && !bindJSON(c, &req) {
+		return
+	}
+
+	userID := currentUser(c).ID
+	duplicate := Task{
+		UserID:      userID,
+		Title:       task.Title,
+		Description: task.Description,
+		Status:      StatusTodo,
+		Priority:    task.Priority,
+		Color:       task.Color,
+		Tags:        append([]string(nil), task.Tags...),
+		CreatedBy:   userID,
+		UpdatedBy:   userID,
+	}
+	if req.Title != nil {
+		duplicate.Title = *req.Title
+	}
+	if err := prepareNewTask(&duplicate); err != nil {
+		respondInvalid(c, err)
+		return
+	}
+	if !checkTaskQuota(c, 1) {
+		return
+	}
+	duplicate, err := tasks.Create(duplicate)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	recordAudit(c, AuditCreate, AuditResourceTask, duplicate.ID, nil, duplicate)
+	notifyTaskEvent(EventTaskCreated, duplicate)
+	c.JSON(http.StatusCreated, duplicate)
+}
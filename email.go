@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Port used when SMTP_HOST is set without SMTP_PORT, the submission port
+const defaultSMTPPort = 587
+
+// EmailSender delivers plain-text emails
+type EmailSender interface {
+	Send(to, subject, body string) error
+}
+
+// Sender of every email, set from the config in main
+var emailSender EmailSender = noopEmailSender{}
+
+// noopEmailSender drops every email, for when no mail server is configured
+type noopEmailSender struct{}
+
+func (noopEmailSender) Send(to, subject, body string) error { return nil }
+
+// Settings of the SMTP server emails are sent through; an empty host means
+// emails are not sent
+type smtpConfig struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+// Read SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM.
+// SMTP_FROM is required once SMTP_HOST is set.
+func smtpSettings() (smtpConfig, error) {
+	cfg := smtpConfig{
+		host:     os.Getenv("SMTP_HOST"),
+		port:     defaultSMTPPort,
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     os.Getenv("SMTP_FROM"),
+	}
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil || port < 1 || port > 65535 {
+			return smtpConfig{}, fmt.Errorf("SMTP_PORT %q must be a port number", v)
+		}
+		cfg.port = port
+	}
+	if cfg.host != "" && cfg.from == "" {
+		return smtpConfig{}, fmt.Errorf("SMTP_FROM is required when SMTP_HOST is set")
+	}
+	return cfg, nil
+}
+
+// The sender the settings call for
+func newEmailSender(cfg smtpConfig) EmailSender {
+	if cfg.host == "" {
+		return noopEmailSender{}
+	}
+	return &smtpEmailSender{cfg: cfg}
+}
+
+// smtpEmailSender sends emails through an SMTP server, authenticating when a
+// username is configured
+type smtpEmailSender struct {
+	cfg smtpConfig
+}
+
+func (s *smtpEmailSender) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if s.cfg.username != "" {
+		auth = smtp.PlainAuth("", s.cfg.username, s.cfg.password, s.cfg.host)
+	}
+	// Header values come from user input, so keep them to a single line
+	clean := strings.NewReplacer("\r", "", "\n", "")
+	msg := "From: " + s.cfg.from + "\r\n" +
+		"To: " + clean.Replace(to) + "\r\n" +
+		"Subject: " + clean.Replace(subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+	addr := net.JoinHostPort(s.cfg.host, strconv.Itoa(s.cfg.port))
+	return smtp.SendMail(addr, auth, s.cfg.from, []string{to}, []byte(msg))
+}
+
+// Send an email in the background, so a slow mail server doesn't hold up the
+// request; failures are logged
+func sendEmail(to, subject, body string) {
+	sender := emailSender
+	go func() {
+		if err := sender.Send(to, subject, body); err != nil {
+			log.Printf("Failed to send %q email to %s: %v", subject, to, err)
+		}
+	}()
+}
+
+// Welcome a newly registered user
+func sendWelcomeEmail(user User) {
+	name := user.Name
+	if name == "" {
+		name = user.Email
+	}
+	sendEmail(user.Email, "Welcome to Task API",
+		"Hi "+name+",\r\n\r\nYour account has been created. Sign in with "+user.Email+" to start managing your tasks.\r\n")
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Machine-readable codes carried by every error response
+const (
+	codeBadRequest           = "BAD_REQUEST"
+	codeValidationFailed     = "VALIDATION_FAILED"
+	codeUnauthorized         = "UNAUTHORIZED"
+	codeForbidden            = "FORBIDDEN"
+	codeAccountDeactivated   = "ACCOUNT_DEACTIVATED"
+	codeNotFound             = "NOT_FOUND"
+	codeRouteNotFound        = "ROUTE_NOT_FOUND"
+	codeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	codeConflict             = "CONFLICT"
+	codeEmailTaken           = "EMAIL_TAKEN"
+	codeVersionConflict      = "VERSION_CONFLICT"
+	codeIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	codeTaskBlocked          = "TASK_BLOCKED"
+	codeInvalidTransition    = "INVALID_TRANSITION"
+	codePreconditionFailed   = "PRECONDITION_FAILED"
+	codePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	codeUnsupportedMedia     = "UNSUPPORTED_MEDIA_TYPE"
+	codeRateLimited          = "RATE_LIMITED"
+	codeQuotaExceeded        = "QUOTA_EXCEEDED"
+	codeTimeout              = "TIMEOUT"
+	codeInternal             = "INTERNAL_ERROR"
+)
+
+// Body of every error response, nested under "error"
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Fields says what is wrong with each invalid field of a VALIDATION_FAILED request
+	Fields map[string]string `json:"fields,omitempty"`
+	// Details carries anything else specific to the error, such as the index of a bad batch item
+	Details gin.H `json:"details,omitempty"`
+	// RequestID lets users quote the failing request in bug reports
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// apiError is also the error of the task operations in taskops.go
+func (e apiError) Error() string {
+	return e.Message
+}
+
+// Write an error response with the given code and message
+func respondError(c *gin.Context, status int, code, message string) {
+	writeError(c, status, apiError{Code: code, Message: message})
+}
+
+// Answer 400 VALIDATION_FAILED for a single invalid field
+func respondFieldError(c *gin.Context, field, message string) {
+	writeError(c, http.StatusBadRequest, apiError{
+		Code:    codeValidationFailed,
+		Message: message,
+		Fields:  map[string]string{field: message},
+	})
+}
+
+// Write a fully built error response, stamping it with the request ID
+func writeError(c *gin.Context, status int, e apiError) {
+	e.RequestID = requestID(c)
+	c.JSON(status, gin.H{"error": e})
+}
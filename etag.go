@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Compute a strong ETag from every field of the task, UpdatedAt included
+func taskETag(task Task) string {
+	data, _ := json.Marshal(task)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Report whether an If-Match or If-None-Match header value lists etag.
+// Weak validators compare equal to their strong form, which is what If-None-Match wants.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Reject a write with 412 when the client's If-Match no longer matches the task
+func checkIfMatch(c *gin.Context, task Task) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" || etagMatches(header, taskETag(task)) {
+		return true
+	}
+	respondError(c, http.StatusPreconditionFailed, codePreconditionFailed, "Task has been modified since it was fetched")
+	return false
+}
+
+// Reject a write with 412 when the task changed after the client's
+// If-Unmodified-Since, or with 400 when that isn't an HTTP date. As RFC 7232
+// has it, the header is ignored when If-Match is sent too.
+func checkIfUnmodifiedSince(c *gin.Context, task Task) bool {
+	header := c.GetHeader("If-Unmodified-Since")
+	if header == "" || c.GetHeader("If-Match") != "" {
+		return true
+	}
+	since, err := http.ParseTime(header)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "If-Unmodified-Since must be an HTTP date such as Sun, 06 Nov 1994 08:49:37 GMT")
+		return false
+	}
+	if modifiedAfter(task, since) {
+		respondError(c, http.StatusPreconditionFailed, codePreconditionFailed, "Task has been modified since "+header)
+		return false
+	}
+	return true
+}
+
+// Check the If-Match and If-Unmodified-Since preconditions of a write
+func checkPreconditions(c *gin.Context, task Task) bool {
+	return checkIfMatch(c, task) && checkIfUnmodifiedSince(c, task)
+}
+
+// When the task last changed: a soft delete leaves UpdatedAt alone
+func taskModifiedAt(task Task) time.Time {
+	if task.DeletedAt != nil && task.DeletedAt.After(task.UpdatedAt) {
+		return *task.DeletedAt
+	}
+	return task.UpdatedAt
+}
+
+// Report whether the task changed after an HTTP date. Those have whole
+// seconds, so a change within the same second is not after it.
+func modifiedAfter(task Task, since time.Time) bool {
+	return taskModifiedAt(task).Truncate(time.Second).After(since)
+}
+
+// Report whether a GET can be answered with 304 because of its
+// If-Modified-Since. Dates that don't parse are ignored, as RFC 7232 says.
+func notModifiedSince(c *gin.Context, task Task) bool {
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	return err == nil && !modifiedAfter(task, since)
+}
+
+// Set the ETag and Last-Modified headers of a response about the task
+func setTaskValidators(c *gin.Context, task Task) {
+	c.Header("ETag", taskETag(task))
+	c.Header("Last-Modified", taskModifiedAt(task).UTC().Format(http.TimeFormat))
+}
+
+// Write the task along with its ETag and Last-Modified
+func respondTask(c *gin.Context, status int, task Task) {
+	setTaskValidators(c, task)
+	c.JSON(status, task)
+}
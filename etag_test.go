@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIfNoneMatchAnswersNotModified(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	task := srv.createTask(token, gin.H{"title": "Write report"})
+	path := "/v1/tasks/" + task.ID
+
+	resp, _ := srv.send(http.MethodGet, path, token, nil, nil)
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("GET: status = %d, ETag = %q", resp.StatusCode, etag)
+	}
+
+	resp, data := srv.send(http.MethodGet, path, token, nil, http.Header{"If-None-Match": {etag}})
+	if resp.StatusCode != http.StatusNotModified || len(data) != 0 {
+		t.Errorf("GET with a current If-None-Match: status = %d, body %q; want 304 and no body", resp.StatusCode, data)
+	}
+	if got := resp.Header.Get("ETag"); got != etag {
+		t.Errorf("304 ETag = %q, want %q", got, etag)
+	}
+
+	resp, _ = srv.send(http.MethodGet, path, token, nil, http.Header{"If-None-Match": {`"stale"`}})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET with a stale If-None-Match: status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestIfMatchRejectsStaleWrites(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	task := srv.createTask(token, gin.H{"title": "Write report"})
+	path := "/v1/tasks/" + task.ID
+
+	resp, _ := srv.send(http.MethodGet, path, token, nil, nil)
+	etag := resp.Header.Get("ETag")
+
+	resp, _ = srv.send(http.MethodPatch, path, token, gin.H{"title": "Write the report"}, http.Header{"If-Match": {etag}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH with a current If-Match: status = %d, want 200", resp.StatusCode)
+	}
+	fresh := resp.Header.Get("ETag")
+	if fresh == "" || fresh == etag {
+		t.Errorf("PATCH ETag = %q, want a new one (was %q)", fresh, etag)
+	}
+
+	// The first ETag no longer matches, so a second writer loses
+	resp, _ = srv.send(http.MethodPatch, path, token, gin.H{"title": "Overwritten"}, http.Header{"If-Match": {etag}})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with a stale If-Match: status = %d, want 412", resp.StatusCode)
+	}
+	resp, _ = srv.send(http.MethodPut, path, token, gin.H{"title": "Overwritten"}, http.Header{"If-Match": {etag}})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT with a stale If-Match: status = %d, want 412", resp.StatusCode)
+	}
+	var got Task
+	srv.expect(http.StatusOK, http.MethodGet, path, token, nil, &got)
+	if got.Title != "Write the report" {
+		t.Errorf("title = %q after the rejected writes, want %q", got.Title, "Write the report")
+	}
+}
+
+func TestIfUnmodifiedSinceRejectsStaleWrites(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	task := srv.createTask(token, gin.H{"title": "Write report"})
+	path := "/v1/tasks/" + task.ID
+
+	resp, _ := srv.send(http.MethodGet, path, token, nil, nil)
+	modified := resp.Header.Get("Last-Modified")
+	if _, err := http.ParseTime(modified); err != nil {
+		t.Fatalf("Last-Modified = %q: %v", modified, err)
+	}
+
+	resp, _ = srv.send(http.MethodPatch, path, token, gin.H{"title": "Write the report"}, http.Header{"If-Unmodified-Since": {modified}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PATCH with a current If-Unmodified-Since: status = %d, want 200", resp.StatusCode)
+	}
+
+	earlier := task.UpdatedAt.Add(-time.Hour).UTC().Format(http.TimeFormat)
+	resp, _ = srv.send(http.MethodPatch, path, token, gin.H{"title": "Overwritten"}, http.Header{"If-Unmodified-Since": {earlier}})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with an earlier If-Unmodified-Since: status = %d, want 412", resp.StatusCode)
+	}
+	resp, _ = srv.send(http.MethodPut, path, token, gin.H{"title": "Overwritten"}, http.Header{"If-Unmodified-Since": {earlier}})
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT with an earlier If-Unmodified-Since: status = %d, want 412", resp.StatusCode)
+	}
+	resp, _ = srv.send(http.MethodPatch, path, token, gin.H{"title": "Overwritten"}, http.Header{"If-Unmodified-Since": {"yesterday"}})
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("PATCH with a malformed If-Unmodified-Since: status = %d, want 400", resp.StatusCode)
+	}
+
+	var got Task
+	srv.expect(http.StatusOK, http.MethodGet, path, token, nil, &got)
+	if got.Title != "Write the report" {
+		t.Errorf("title = %q after the rejected writes, want %q", got.Title, "Write the report")
+	}
+}
+
+func TestIfModifiedSinceAnswersNotModified(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	task := srv.createTask(token, gin.H{"title": "Write report"})
+	path := "/v1/tasks/" + task.ID
+
+	resp, _ := srv.send(http.MethodGet, path, token, nil, nil)
+	modified := resp.Header.Get("Last-Modified")
+
+	resp, data := srv.send(http.MethodGet, path, token, nil, http.Header{"If-Modified-Since": {modified}})
+	if resp.StatusCode != http.StatusNotModified || len(data) != 0 {
+		t.Errorf("GET with a current If-Modified-Since: status = %d, body %q; want 304 and no body", resp.StatusCode, data)
+	}
+
+	earlier := task.UpdatedAt.Add(-time.Hour).UTC().Format(http.TimeFormat)
+	resp, _ = srv.send(http.MethodGet, path, token, nil, http.Header{"If-Modified-Since": {earlier}})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET with an earlier If-Modified-Since: status = %d, want 200", resp.StatusCode)
+	}
+	resp, _ = srv.send(http.MethodGet, path, token, nil, http.Header{"If-Modified-Since": {"yesterday"}})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET with a malformed If-Modified-Since: status = %d, want 200", resp.StatusCode)
+	}
+	// A stale If-None-Match wins over a current If-Modified-Since
+	resp, _ = srv.send(http.MethodGet, path, token, nil, http.Header{"If-None-Match": {`"stale"`}, "If-Modified-Since": {modified}})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET with a stale If-None-Match: status = %d, want 200", resp.StatusCode)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How often an idle stream gets a comment so proxies keep it open
+const streamKeepAlive = 15 * time.Second
+
+// Events buffered per subscriber; a subscriber that falls further behind misses events
+const streamBuffer = 16
+
+// A change to a task, as delivered to webhooks and streams
+type taskEvent struct {
+	Event      string    `json:"event"`
+	Task       Task      `json:"task"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// eventHub fans task events out to the live streams of each user
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[string]map[chan taskEvent]struct{}
+	closed bool
+}
+
+var streams = &eventHub{subs: make(map[string]map[chan taskEvent]struct{})}
+
+// Register a stream for a user's events. The channel is closed by
+// unsubscribe or when the hub shuts down.
+func (h *eventHub) subscribe(userID string) (<-chan taskEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan taskEvent, streamBuffer)
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan taskEvent]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[userID][ch]; ok {
+			delete(h.subs[userID], ch)
+			if len(h.subs[userID]) == 0 {
+				delete(h.subs, userID)
+			}
+			close(ch)
+		}
+	}
+}
+
+// Send an event to every stream of a user without ever blocking the caller
+func (h *eventHub) publish(userID string, event taskEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs[userID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// End every stream so the server can shut down without waiting on them
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for userID, chans := range h.subs {
+		for ch := range chans {
+			close(ch)
+		}
+		delete(h.subs, userID)
+	}
+}
+
+// Announce a change to a task to its owner's streams and webhooks
+func notifyTaskEvent(event string, task Task) {
+	e := taskEvent{Event: event, Task: task, OccurredAt: time.Now()}
+	streams.publish(task.UserID, e)
+	go deliverToWebhooks(webhooks, e)
+}
+
+// Hold the connection open and push the caller's task events as server-sent
+// events named after the event type, with the taskEvent as JSON data
+func streamTasks(c *gin.Context) {
+	events, unsubscribe := streams.subscribe(currentUser(c).ID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Stop nginx and similar proxies from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			c.SSEvent(event.Event, event)
+		case <-keepAlive.C:
+			c.Writer.WriteString(": keep-alive\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Columns of a CSV export, in order
+var exportColumns = []string{"id", "title", "description", "status", "created_at", "updated_at"}
+
+// Export the caller's tasks as a downloadable file, CSV by default or JSON with
+// ?format=json. Rows are written and flushed one at a time rather than built up in memory.
+func exportTasks(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "format must be csv or json")
+		return
+	}
+	list, ok := listOwnedTasks(c)
+	if !ok {
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="tasks.`+format+`"`)
+	c.Status(http.StatusOK)
+	if format == "json" {
+		c.Header("Content-Type", "application/json")
+		streamJSON(c, list)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	streamCSV(c, list)
+}
+
+// csv.Writer quotes fields containing commas, quotes or newlines
+func streamCSV(c *gin.Context, list []Task) {
+	w := csv.NewWriter(c.Writer)
+	if err := w.Write(exportColumns); err != nil {
+		return
+	}
+	for _, task := range list {
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		record := []string{
+			task.ID,
+			task.Title,
+			task.Description,
+			task.Status,
+			task.CreatedAt.Format(time.RFC3339),
+			task.UpdatedAt.Format(time.RFC3339),
+		}
+		if err := w.Write(record); err != nil {
+			return
+		}
+		w.Flush()
+		c.Writer.Flush()
+	}
+	w.Flush()
+}
+
+// Write the tasks as a JSON array, one element at a time
+func streamJSON(c *gin.Context, list []Task) {
+	c.Writer.WriteString("[")
+	enc := json.NewEncoder(c.Writer)
+	for i, task := range list {
+		if c.Request.Context().Err() != nil {
+			return
+		}
+		if i > 0 {
+			c.Writer.WriteString(",")
+		}
+		if err := enc.Encode(task); err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+	c.Writer.WriteString("]\n")
+}
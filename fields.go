@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The JSON names of every task field, the values ?fields= accepts
+var taskFieldNames = jsonFieldNames(reflect.TypeOf(Task{}))
+
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// Read the comma-separated ?fields= list, nil when absent so the whole task is
+// returned. The id is always included. Unknown fields are a 400, like unknown
+// sort fields. On failure the error response has already been written.
+func fieldsParam(c *gin.Context) (map[string]bool, bool) {
+	v := c.Query("fields")
+	if v == "" {
+		return nil, true
+	}
+	fields := map[string]bool{"id": true}
+	var unknown []string
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !taskFieldNames[name] {
+			unknown = append(unknown, name)
+			continue
+		}
+		fields[name] = true
+	}
+	if len(unknown) > 0 {
+		known := make([]string, 0, len(taskFieldNames))
+		for name := range taskFieldNames {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+		respondError(c, http.StatusBadRequest, codeBadRequest,
+			"Unknown fields "+strings.Join(unknown, ", ")+": must be among "+strings.Join(known, ", "))
+		return nil, false
+	}
+	return fields, true
+}
+
+// Keep only the selected fields of a task, or the whole task when fields is nil
+func selectTaskFields(task Task, fields map[string]bool) interface{} {
+	if fields == nil {
+		return task
+	}
+	b, err := json.Marshal(task)
+	if err != nil {
+		return task
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(b, &all); err != nil {
+		return task
+	}
+	for name := range all {
+		if !fields[name] {
+			delete(all, name)
+		}
+	}
+	return all
+}
+
+// selectTaskFields for every task of a list
+func selectTasksFields(list []Task, fields map[string]bool) interface{} {
+	if fields == nil {
+		return list
+	}
+	selected := make([]interface{}, len(list))
+	for i, task := range list {
+		selected[i] = selectTaskFields(task, fields)
+	}
+	return selected
+}
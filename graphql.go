@@ -0,0 +1,610 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+// The GraphQL schema served at /graphql. It reads the same stores as the REST
+// API and its mutations make the same checks as their REST counterparts.
+const graphqlSchema = `
+scalar Time
+
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+type Query {
+	"The caller"
+	me: User!
+	"A user; callers may read themselves, admins anyone"
+	user(id: ID!): User
+	"Every live user; admin only"
+	users(limit: Int, offset: Int = 0): [User!]!
+	"A task owned by or assigned to the caller"
+	task(id: ID!): Task
+	"The caller's live, unarchived tasks, oldest first, optionally only those in one status"
+	tasks(status: String, limit: Int, offset: Int = 0): [Task!]!
+}
+
+type Mutation {
+	"Create a task owned by the caller, like POST /v1/tasks"
+	createTask(input: CreateTaskInput!): Task!
+	"Change the given fields of a task, like PATCH /v1/tasks/{id}"
+	updateTask(id: ID!, input: UpdateTaskInput!): Task!
+}
+
+type User {
+	id: ID!
+	name: String!
+	"Only shown to the user themselves and to admins"
+	email: String
+	role: String!
+	"Only shown to the user themselves and to admins"
+	timezone: String
+	active: Boolean!
+	createdAt: Time!
+	updatedAt: Time!
+}
+
+type Task {
+	id: ID!
+	owner: User
+	title: String!
+	description: String!
+	status: String!
+	priority: String!
+	tags: [String!]!
+	dueDate: Time
+	assignee: User
+	color: String!
+	recurrence: String!
+	"Null when the parent is not visible to the caller"
+	parent: Task
+	subtasks: [Task!]!
+	blockedBy: [ID!]!
+	comments: [Comment!]!
+	archived: Boolean!
+	completedAt: Time
+	"The task's place in its owner's order, from 1; 0 until the tasks are reordered"
+	position: Int!
+	version: Int!
+	createdAt: Time!
+	updatedAt: Time!
+}
+
+type Comment {
+	id: ID!
+	author: User
+	body: String!
+	createdAt: Time!
+}
+
+input CreateTaskInput {
+	title: String!
+	description: String
+	status: String
+	priority: String
+	tags: [String!]
+	dueDate: Time
+	assigneeId: ID
+	color: String
+	recurrence: String
+	parentId: ID
+	blockedBy: [ID!]
+}
+
+input UpdateTaskInput {
+	title: String
+	description: String
+	status: String
+	priority: String
+	tags: [String!]
+	dueDate: Time
+	assigneeId: ID
+	color: String
+	recurrence: String
+	parentId: ID
+	blockedBy: [ID!]
+	"When given, must match the stored version for the update to apply"
+	version: Int
+}
+`
+
+// Deepest field nesting a query may reach, so subtasks of subtasks can't be
+// followed without end
+const graphqlMaxDepth = 10
+
+// Parse the GraphQL schema and bind it to its resolvers
+func newGraphQLSchema() (*graphql.Schema, error) {
+	return graphql.ParseSchema(graphqlSchema, &graphqlResolver{},
+		graphql.UseStringDescriptions(), graphql.MaxDepth(graphqlMaxDepth))
+}
+
+// Body of a GraphQL request
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Key under which resolvers find the gin context of the request
+type ginContextKey struct{}
+
+// Serve GraphQL requests. Behind authMiddleware, so resolvers find the caller
+// on the gin context, which also lets them record audit entries like the REST
+// handlers do. Errors are reported GraphQL style, in the 200 response.
+func graphqlHandler(schema *graphql.Schema) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req graphqlRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+		ctx := context.WithValue(c.Request.Context(), ginContextKey{}, c)
+		ctx = context.WithValue(ctx, subtaskIndexKey{}, &subtaskIndex{})
+		c.JSON(http.StatusOK, schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+	}
+}
+
+func ginContext(ctx context.Context) *gin.Context {
+	c, _ := ctx.Value(ginContextKey{}).(*gin.Context)
+	return c
+}
+
+// Key under which resolvers find the subtask index of the request
+type subtaskIndexKey struct{}
+
+// The live tasks of a request by owner and parent. An owner's tasks are
+// loaded the first time the subtasks of one of them are asked for, and a
+// subtask has its parent's owner, so nested subtasks fields cost one
+// listing per owner rather than a scan of every task each.
+type subtaskIndex struct {
+	mu     sync.Mutex
+	owners map[string]*ownerSubtasks
+}
+
+type ownerSubtasks struct {
+	once     sync.Once
+	children map[string][]Task
+	err      error
+}
+
+// Get the live direct children of a task, like childrenOf
+func (x *subtaskIndex) childrenOf(ctx context.Context, task Task) ([]Task, error) {
+	x.mu.Lock()
+	if x.owners == nil {
+		x.owners = map[string]*ownerSubtasks{}
+	}
+	owner, ok := x.owners[task.UserID]
+	if !ok {
+		owner = &ownerSubtasks{}
+		x.owners[task.UserID] = owner
+	}
+	x.mu.Unlock()
+
+	owner.once.Do(func() {
+		list, err := tasks.ListByUser(ctx, task.UserID, "")
+		if err != nil {
+			owner.err = err
+			return
+		}
+		owner.children = map[string][]Task{}
+		for _, t := range list {
+			if t.DeletedAt == nil && t.ParentID != nil {
+				owner.children[*t.ParentID] = append(owner.children[*t.ParentID], t)
+			}
+		}
+	})
+	return owner.children[task.ID], owner.err
+}
+
+// Drop what the index has loaded, so fields resolved after a mutation see its changes
+func forgetSubtasks(ctx context.Context) {
+	if x, ok := ctx.Value(subtaskIndexKey{}).(*subtaskIndex); ok {
+		x.mu.Lock()
+		x.owners = nil
+		x.mu.Unlock()
+	}
+}
+
+// graphqlError is an apiError in a GraphQL response, carrying the same code
+// and details the REST API would answer with under "extensions"
+type graphqlError apiError
+
+func (e graphqlError) Error() string {
+	return e.Message
+}
+
+func (e graphqlError) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{"code": e.Code}
+	if e.Fields != nil {
+		ext["fields"] = e.Fields
+	}
+	if e.Details != nil {
+		ext["details"] = e.Details
+	}
+	return ext
+}
+
+// Convert the apiErrors of taskops.go, which graphql-go would otherwise
+// report without their codes
+func graphqlErr(err error) error {
+	var e apiError
+	if errors.As(err, &e) {
+		return graphqlError(e)
+	}
+	return err
+}
+
+// Slice out one page, defaulting and clamping the limit and rejecting
+// negative limits and offsets like parsePagination
+func graphqlPage[T any](items []T, limit *int32, offset int32) ([]T, error) {
+	size := defaultPageSize
+	if limit != nil {
+		size = int(*limit)
+	}
+	if size < 0 || offset < 0 {
+		return nil, graphqlErr(newAPIError(codeBadRequest, "limit and offset must be non-negative integers"))
+	}
+	return paginate(items, clampLimit(size), int(offset)), nil
+}
+
+// The root resolver, for queries and mutations alike
+type graphqlResolver struct{}
+
+func (graphqlResolver) Me(ctx context.Context) *userResolver {
+	caller := currentUser(ginContext(ctx))
+	return &userResolver{user: *caller, caller: caller}
+}
+
+func (graphqlResolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	caller := currentUser(ginContext(ctx))
+	id, ok := parseUUID(string(args.ID))
+	if !ok {
+		return nil, graphqlErr(newAPIError(codeBadRequest, "Invalid id: must be a UUID"))
+	}
+	user, err := users.GetByID(id)
+	if err == nil && user.DeletedAt != nil {
+		err = errNotFound
+	}
+	if err != nil {
+		return nil, graphqlErr(apiStoreError(err, "User not found"))
+	}
+	if !mayAccessUser(caller, user) {
+		return nil, graphqlErr(newAPIError(codeForbidden, "Forbidden: you may only access your own user"))
+	}
+	return &userResolver{user: user, caller: caller}, nil
+}
+
+func (graphqlResolver) Users(ctx context.Context, args struct {
+	Limit  *int32
+	Offset int32
+}) ([]*userResolver, error) {
+	caller := currentUser(ginContext(ctx))
+	if !isAdmin(caller) {
+		return nil, graphqlErr(newAPIError(codeForbidden, "Forbidden: admin role required"))
+	}
+	all, err := users.List(ctx)
+	if err != nil {
+		return nil, graphqlErr(apiStoreError(err, "User not found"))
+	}
+	live := make([]*userResolver, 0, len(all))
+	for _, user := range all {
+		if user.DeletedAt == nil {
+			live = append(live, &userResolver{user: user, caller: caller})
+		}
+	}
+	return graphqlPage(live, args.Limit, args.Offset)
+}
+
+func (graphqlResolver) Task(ctx context.Context, args struct{ ID graphql.ID }) (*taskResolver, error) {
+	caller := currentUser(ginContext(ctx))
+	task, err := apiLoadTask(caller, string(args.ID), canViewTask)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	return &taskResolver{task: task, caller: caller}, nil
+}
+
+func (graphqlResolver) Tasks(ctx context.Context, args struct {
+	Status *string
+	Limit  *int32
+	Offset int32
+}) ([]*taskResolver, error) {
+	caller := currentUser(ginContext(ctx))
+	list, err := apiListTasks(ctx, caller, args.Status)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	resolvers := make([]*taskResolver, len(list))
+	for i, task := range list {
+		resolvers[i] = &taskResolver{task: task, caller: caller}
+	}
+	return graphqlPage(resolvers, args.Limit, args.Offset)
+}
+
+// Fields a task is created or updated with over GraphQL
+type taskInput struct {
+	Description *string
+	Status      *string
+	Priority    *string
+	Tags        *[]string
+	DueDate     *graphql.Time
+	AssigneeID  *graphql.ID
+	Color       *string
+	Recurrence  *string
+	ParentID    *graphql.ID
+	BlockedBy   *[]graphql.ID
+}
+
+type createTaskInput struct {
+	Title string
+	taskInput
+}
+
+type updateTaskInput struct {
+	Title *string
+	taskInput
+	Version *int32
+}
+
+// The REST patch body with the same fields set
+func (in taskInput) patch() taskPatch {
+	patch := taskPatch{
+		Description: in.Description,
+		Status:      in.Status,
+		Priority:    in.Priority,
+		Tags:        in.Tags,
+		Color:       in.Color,
+		Recurrence:  in.Recurrence,
+		AssigneeID:  idPtr(in.AssigneeID),
+		ParentID:    idPtr(in.ParentID),
+	}
+	if in.DueDate != nil {
+		patch.DueDate = &in.DueDate.Time
+	}
+	if in.BlockedBy != nil {
+		ids := make([]string, len(*in.BlockedBy))
+		for i, id := range *in.BlockedBy {
+			ids[i] = string(id)
+		}
+		patch.BlockedBy = &ids
+	}
+	return patch
+}
+
+// The task the input creates, before defaults and validation
+func (in createTaskInput) task() Task {
+	patch := in.patch()
+	task := Task{Title: in.Title, DueDate: patch.DueDate, AssigneeID: patch.AssigneeID, ParentID: patch.ParentID}
+	if in.Description != nil {
+		task.Description = *in.Description
+	}
+	if in.Status != nil {
+		task.Status = *in.Status
+	}
+	if in.Priority != nil {
+		task.Priority = *in.Priority
+	}
+	if in.Color != nil {
+		task.Color = *in.Color
+	}
+	if in.Recurrence != nil {
+		task.Recurrence = *in.Recurrence
+	}
+	if in.Tags != nil {
+		task.Tags = *in.Tags
+	}
+	if patch.BlockedBy != nil {
+		task.BlockedBy = *patch.BlockedBy
+	}
+	return task
+}
+
+func idPtr(id *graphql.ID) *string {
+	if id == nil {
+		return nil
+	}
+	s := string(*id)
+	return &s
+}
+
+// Create a task like createTask does
+func (graphqlResolver) CreateTask(ctx context.Context, args struct{ Input createTaskInput }) (*taskResolver, error) {
+	c := ginContext(ctx)
+	task, err := apiCreateTask(c, args.Input.task())
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	forgetSubtasks(ctx)
+	return &taskResolver{task: task, caller: currentUser(c)}, nil
+}
+
+// Update the given fields of a task like patchTask does
+func (graphqlResolver) UpdateTask(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input updateTaskInput
+}) (*taskResolver, error) {
+	c := ginContext(ctx)
+	caller := currentUser(c)
+	task, err := apiLoadTask(caller, string(args.ID), ownsTask)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	patch := args.Input.patch()
+	patch.Title = args.Input.Title
+	var version *int
+	if args.Input.Version != nil {
+		v := int(*args.Input.Version)
+		version = &v
+	}
+	task, _, err = apiPatchTask(c, task, patch, version)
+	if err != nil {
+		return nil, graphqlErr(err)
+	}
+	forgetSubtasks(ctx)
+	return &taskResolver{task: task, caller: caller}, nil
+}
+
+// Resolves a user's fields, hiding the private ones from other callers
+type userResolver struct {
+	user   User
+	caller *User
+}
+
+func (r *userResolver) ID() graphql.ID          { return graphql.ID(r.user.ID) }
+func (r *userResolver) Name() string            { return r.user.Name }
+func (r *userResolver) Role() string            { return r.user.Role }
+func (r *userResolver) Active() bool            { return r.user.Active }
+func (r *userResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.user.CreatedAt} }
+func (r *userResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: r.user.UpdatedAt} }
+
+func (r *userResolver) Email() *string {
+	if !mayAccessUser(r.caller, r.user) {
+		return nil
+	}
+	return &r.user.Email
+}
+
+func (r *userResolver) Timezone() *string {
+	if !mayAccessUser(r.caller, r.user) {
+		return nil
+	}
+	return &r.user.Timezone
+}
+
+// Resolve the user with the given id, or nil when there is none
+func resolveUser(caller *User, id *string) (*userResolver, error) {
+	if id == nil {
+		return nil, nil
+	}
+	user, err := users.GetByID(*id)
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlErr(apiStoreError(err, "User not found"))
+	}
+	return &userResolver{user: user, caller: caller}, nil
+}
+
+// Resolves a task's fields, following its relations on demand
+type taskResolver struct {
+	task   Task
+	caller *User
+}
+
+func (r *taskResolver) ID() graphql.ID          { return graphql.ID(r.task.ID) }
+func (r *taskResolver) Title() string           { return r.task.Title }
+func (r *taskResolver) Description() string     { return r.task.Description }
+func (r *taskResolver) Status() string          { return r.task.Status }
+func (r *taskResolver) Priority() string        { return r.task.Priority }
+func (r *taskResolver) Color() string           { return r.task.Color }
+func (r *taskResolver) Recurrence() string      { return r.task.Recurrence }
+func (r *taskResolver) Archived() bool          { return r.task.Archived }
+func (r *taskResolver) Position() int32         { return int32(r.task.Position) }
+func (r *taskResolver) Version() int32          { return int32(r.task.Version) }
+func (r *taskResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.task.CreatedAt} }
+func (r *taskResolver) UpdatedAt() graphql.Time { return graphql.Time{Time: r.task.UpdatedAt} }
+func (r *taskResolver) DueDate() *graphql.Time  { return timeResolver(r.task.DueDate) }
+func (r *taskResolver) CompletedAt() *graphql.Time {
+	return timeResolver(r.task.CompletedAt)
+}
+
+func timeResolver(t *time.Time) *graphql.Time {
+	if t == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *t}
+}
+
+func (r *taskResolver) Tags() []string {
+	if r.task.Tags == nil {
+		return []string{}
+	}
+	return r.task.Tags
+}
+
+func (r *taskResolver) BlockedBy() []graphql.ID {
+	ids := make([]graphql.ID, len(r.task.BlockedBy))
+	for i, id := range r.task.BlockedBy {
+		ids[i] = graphql.ID(id)
+	}
+	return ids
+}
+
+func (r *taskResolver) Owner() (*userResolver, error) {
+	return resolveUser(r.caller, &r.task.UserID)
+}
+
+func (r *taskResolver) Assignee() (*userResolver, error) {
+	return resolveUser(r.caller, r.task.AssigneeID)
+}
+
+func (r *taskResolver) Parent() (*taskResolver, error) {
+	if r.task.ParentID == nil {
+		return nil, nil
+	}
+	parent, err := tasks.GetByID(*r.task.ParentID)
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlErr(apiStoreError(err, "Task not found"))
+	}
+	if parent.DeletedAt != nil || !canViewTask(r.caller, parent) {
+		return nil, nil
+	}
+	return &taskResolver{task: parent, caller: r.caller}, nil
+}
+
+func (r *taskResolver) Subtasks(ctx context.Context) ([]*taskResolver, error) {
+	index, ok := ctx.Value(subtaskIndexKey{}).(*subtaskIndex)
+	if !ok {
+		index = &subtaskIndex{}
+	}
+	children, err := index.childrenOf(ctx, r.task)
+	if err != nil {
+		return nil, graphqlErr(apiStoreError(err, "Task not found"))
+	}
+	list := make([]*taskResolver, len(children))
+	for i, child := range children {
+		list[i] = &taskResolver{task: child, caller: r.caller}
+	}
+	return list, nil
+}
+
+func (r *taskResolver) Comments() ([]*commentResolver, error) {
+	list, err := comments.ListByTask(r.task.ID)
+	if err != nil {
+		return nil, graphqlErr(apiStoreError(err, "Task not found"))
+	}
+	resolvers := make([]*commentResolver, len(list))
+	for i, comment := range list {
+		resolvers[i] = &commentResolver{comment: comment, caller: r.caller}
+	}
+	return resolvers, nil
+}
+
+type commentResolver struct {
+	comment Comment
+	caller  *User
+}
+
+func (r *commentResolver) ID() graphql.ID {
+	return graphql.ID(strconv.FormatUint(uint64(r.comment.ID), 10))
+}
+func (r *commentResolver) Body() string            { return r.comment.Body }
+func (r *commentResolver) CreatedAt() graphql.Time { return graphql.Time{Time: r.comment.CreatedAt} }
+
+func (r *commentResolver) Author() (*userResolver, error) {
+	return resolveUser(r.caller, &r.comment.UserID)
+}
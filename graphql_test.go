@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// An error in a GraphQL response
+type graphqlResponseError struct {
+	Message    string `json:"message"`
+	Extensions struct {
+		Code string `json:"code"`
+	} `json:"extensions"`
+}
+
+// Run a GraphQL query as the token's user, decoding its data into out, and
+// return the errors it answered with
+func (s *testServer) graphql(token, query string, variables gin.H, out interface{}) []graphqlResponseError {
+	s.t.Helper()
+	var resp struct {
+		Data   json.RawMessage        `json:"data"`
+		Errors []graphqlResponseError `json:"errors"`
+	}
+	s.expect(http.StatusOK, http.MethodPost, "/graphql", token, gin.H{"query": query, "variables": variables}, &resp)
+	if out != nil && len(resp.Data) > 0 {
+		if err := json.Unmarshal(resp.Data, out); err != nil {
+			s.t.Fatalf("decoding %s: %v", resp.Data, err)
+		}
+	}
+	return resp.Errors
+}
+
+// Fail the test unless errs is exactly one error with the given code
+func expectGraphQLError(t *testing.T, what string, errs []graphqlResponseError, code string) {
+	t.Helper()
+	if len(errs) != 1 || errs[0].Extensions.Code != code {
+		t.Errorf("%s: errors = %+v, want one %s", what, errs, code)
+	}
+}
+
+type graphqlTask struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	Owner  *struct {
+		ID string `json:"id"`
+	} `json:"owner"`
+	Subtasks []struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	} `json:"subtasks"`
+}
+
+const graphqlCreateTask = `mutation ($input: CreateTaskInput!) { createTask(input: $input) { id title status } }`
+
+// Create a task through GraphQL, failing the test on errors
+func (s *testServer) graphqlCreateTask(token string, input gin.H) graphqlTask {
+	s.t.Helper()
+	var data struct {
+		CreateTask graphqlTask `json:"createTask"`
+	}
+	if errs := s.graphql(token, graphqlCreateTask, gin.H{"input": input}, &data); len(errs) > 0 {
+		s.t.Fatalf("createTask: %+v", errs)
+	}
+	return data.CreateTask
+}
+
+func TestGraphQLCreatesAndReadsTasks(t *testing.T) {
+	srv := newTestServer(t)
+	ada, token := srv.signup("Ada", "ada@example.com")
+	parent := srv.graphqlCreateTask(token, gin.H{"title": "Parent"})
+	child := srv.graphqlCreateTask(token, gin.H{"title": "Child", "parentId": parent.ID})
+
+	// Both APIs see the same tasks
+	var stored Task
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+child.ID, token, nil, &stored)
+	if stored.Title != "Child" || stored.ParentID == nil || *stored.ParentID != parent.ID {
+		t.Errorf("REST sees the GraphQL-created child as %+v", stored)
+	}
+
+	var data struct {
+		Task graphqlTask `json:"task"`
+	}
+	errs := srv.graphql(token, `query ($id: ID!) { task(id: $id) { id title owner { id } subtasks { id title } } }`,
+		gin.H{"id": parent.ID}, &data)
+	if len(errs) > 0 {
+		t.Fatalf("task query: %+v", errs)
+	}
+	if data.Task.Owner == nil || data.Task.Owner.ID != ada.ID {
+		t.Errorf("owner = %+v, want %s", data.Task.Owner, ada.ID)
+	}
+	if len(data.Task.Subtasks) != 1 || data.Task.Subtasks[0].ID != child.ID {
+		t.Errorf("subtasks = %+v, want only the child", data.Task.Subtasks)
+	}
+}
+
+// Counts the listings made through the tasks store
+type countingTaskStore struct {
+	TaskStore
+	listings atomic.Int32
+}
+
+func (s *countingTaskStore) List(ctx context.Context) ([]Task, error) {
+	s.listings.Add(1)
+	return s.TaskStore.List(ctx)
+}
+
+func (s *countingTaskStore) ListByUser(ctx context.Context, userID, status string) ([]Task, error) {
+	s.listings.Add(1)
+	return s.TaskStore.ListByUser(ctx, userID, status)
+}
+
+func TestGraphQLListsTasksOnceForNestedSubtasks(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	parent := srv.createTask(token, gin.H{"title": "Parent"})
+	first := srv.createTask(token, gin.H{"title": "First", "parent_id": parent.ID})
+	srv.createTask(token, gin.H{"title": "Second", "parent_id": parent.ID})
+	grandchild := srv.createTask(token, gin.H{"title": "Grandchild", "parent_id": first.ID})
+
+	counting := &countingTaskStore{TaskStore: tasks}
+	tasks = counting
+	defer func() { tasks = counting.TaskStore }()
+
+	var data struct {
+		Task struct {
+			Subtasks []struct {
+				ID       string `json:"id"`
+				Subtasks []struct {
+					ID       string `json:"id"`
+					Subtasks []struct {
+						ID string `json:"id"`
+					} `json:"subtasks"`
+				} `json:"subtasks"`
+			} `json:"subtasks"`
+		} `json:"task"`
+	}
+	errs := srv.graphql(token, `query ($id: ID!) { task(id: $id) { subtasks { id subtasks { id subtasks { id } } } } }`,
+		gin.H{"id": parent.ID}, &data)
+	if len(errs) > 0 {
+		t.Fatalf("task query: %+v", errs)
+	}
+	subtasks := data.Task.Subtasks
+	if len(subtasks) != 2 || subtasks[0].ID != first.ID || len(subtasks[0].Subtasks) != 1 ||
+		subtasks[0].Subtasks[0].ID != grandchild.ID || len(subtasks[1].Subtasks) != 0 {
+		t.Errorf("subtasks = %+v, want First with the grandchild, then Second", subtasks)
+	}
+	if n := counting.listings.Load(); n != 1 {
+		t.Errorf("the query listed tasks %d times, want once", n)
+	}
+
+	// A mutation's changes show in the subtasks resolved after it
+	var mutated struct {
+		Before graphqlTask `json:"before"`
+		After  struct {
+			Parent graphqlTask `json:"parent"`
+		} `json:"after"`
+	}
+	errs = srv.graphql(token, `mutation ($id: ID!, $input: CreateTaskInput!) {
+		before: updateTask(id: $id, input: {title: "Parent"}) { subtasks { id } }
+		after: createTask(input: $input) { parent { subtasks { id } } }
+	}`, gin.H{"id": parent.ID, "input": gin.H{"title": "Third", "parentId": parent.ID}}, &mutated)
+	if len(errs) > 0 {
+		t.Fatalf("mutation: %+v", errs)
+	}
+	if len(mutated.Before.Subtasks) != 2 || len(mutated.After.Parent.Subtasks) != 3 {
+		t.Errorf("subtasks before and after the create = %+v and %+v, want 2 then 3",
+			mutated.Before.Subtasks, mutated.After.Parent.Subtasks)
+	}
+}
+
+func TestGraphQLUpdatesFollowTheRESTRules(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	blocker := srv.createTask(token, gin.H{"title": "Blocker"})
+	task := srv.createTask(token, gin.H{"title": "Task", "blocked_by": []string{blocker.ID}})
+	const update = `mutation ($id: ID!, $input: UpdateTaskInput!) { updateTask(id: $id, input: $input) { id status } }`
+
+	var data struct {
+		UpdateTask *graphqlTask `json:"updateTask"`
+	}
+	errs := srv.graphql(token, update, gin.H{"id": task.ID, "input": gin.H{"status": StatusDone}}, &data)
+	expectGraphQLError(t, "completing a blocked task", errs, codeTaskBlocked)
+
+	errs = srv.graphql(token, update, gin.H{"id": blocker.ID, "input": gin.H{"status": StatusDone}}, &data)
+	if len(errs) > 0 || data.UpdateTask == nil || data.UpdateTask.Status != StatusDone {
+		t.Fatalf("completing the blocker: errors %+v, task %+v", errs, data.UpdateTask)
+	}
+	errs = srv.graphql(token, update, gin.H{"id": blocker.ID, "input": gin.H{"status": StatusInProgress}}, &data)
+	expectGraphQLError(t, "reopening a done task", errs, codeInvalidTransition)
+
+	errs = srv.graphql(token, update, gin.H{"id": task.ID, "input": gin.H{"title": "Renamed", "version": 1}}, &data)
+	if len(errs) > 0 {
+		t.Fatalf("renaming: %+v", errs)
+	}
+	errs = srv.graphql(token, update, gin.H{"id": task.ID, "input": gin.H{"title": "Stale", "version": 1}}, &data)
+	expectGraphQLError(t, "updating a stale version", errs, codeVersionConflict)
+
+	yesterday := time.Now().Add(-24 * time.Hour)
+	errs = srv.graphql(token, update, gin.H{"id": task.ID, "input": gin.H{"dueDate": yesterday}}, &data)
+	expectGraphQLError(t, "moving the due date into the past", errs, codeValidationFailed)
+}
+
+func TestGraphQLKeepsTasksToTheirOwners(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	_, bobToken := srv.signup("Bob", "bob@example.com")
+	task := srv.createTask(token, gin.H{"title": "Ada's"})
+
+	var data struct {
+		Task  *graphqlTask  `json:"task"`
+		Tasks []graphqlTask `json:"tasks"`
+	}
+	errs := srv.graphql(bobToken, `query ($id: ID!) { task(id: $id) { id title } }`, gin.H{"id": task.ID}, &data)
+	if len(errs) == 0 || data.Task != nil {
+		t.Errorf("Bob reading Ada's task: errors %+v, task %+v; want an error and no task", errs, data.Task)
+	}
+	if errs := srv.graphql(bobToken, `{ tasks { id } }`, nil, &data); len(errs) > 0 || len(data.Tasks) != 0 {
+		t.Errorf("Bob's task list: errors %+v, tasks %+v; want none", errs, data.Tasks)
+	}
+
+	srv.expect(http.StatusUnauthorized, http.MethodPost, "/graphql", "", gin.H{"query": `{ me { id } }`}, nil)
+}
@@ -0,0 +1,295 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=module=example/task --go-grpc_out=. --go-grpc_opt=module=example/task proto/task.proto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"example/task/taskpb"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Port the gRPC server listens on when GRPC_PORT is not set
+const defaultGRPCPort = 9090
+
+// Domain of the ErrorInfo details of gRPC errors
+const grpcErrorDomain = "task-api"
+
+// Build the gRPC listen address from HOST and the optional GRPC_PORT
+func grpcListenAddr() (string, error) {
+	return hostPort("GRPC_PORT", defaultGRPCPort)
+}
+
+// Build the gRPC server for internal callers, offering the task operations
+// of the REST API; see proto/task.proto
+func newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(grpcRecoveryInterceptor, grpcAuthInterceptor))
+	taskpb.RegisterTaskServiceServer(srv, taskServer{})
+	return srv
+}
+
+// Turn a panicking call into an Internal error, like recoveryMiddleware does
+func grpcRecoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic in %s: %v\n%s", info.FullMethod, r, debug.Stack())
+			err = grpcError(newAPIError(codeInternal, "Internal server error"))
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// The gRPC counterpart of authMiddleware: check the bearer token in the
+// authorization metadata and make its user the caller. The caller is set on
+// a gin context, as the shared task operations expect.
+func grpcAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("authorization"); len(values) > 0 {
+		token = strings.TrimPrefix(values[0], "Bearer ")
+	}
+	if token == "" {
+		return nil, grpcError(newAPIError(codeUnauthorized, "Unauthorized: Missing token"))
+	}
+	user, err := userFromToken(token, tokenTypeAccess)
+	if err != nil {
+		return nil, grpcError(newAPIError(codeUnauthorized, "Unauthorized: "+err.Error()))
+	}
+	if !user.Active {
+		return nil, grpcError(newAPIError(codeAccountDeactivated, accountDeactivatedMessage))
+	}
+	// The task operations find the caller in c, and the call's context in its request
+	c := &gin.Context{Request: new(http.Request).WithContext(ctx)}
+	c.Set("userInfo", user)
+	return handler(context.WithValue(ctx, ginContextKey{}, c), req)
+}
+
+// gRPC status codes of the REST error codes the task operations fail with
+var grpcCodes = map[string]codes.Code{
+	codeBadRequest:         codes.InvalidArgument,
+	codeValidationFailed:   codes.InvalidArgument,
+	codeUnauthorized:       codes.Unauthenticated,
+	codeForbidden:          codes.PermissionDenied,
+	codeAccountDeactivated: codes.PermissionDenied,
+	codeNotFound:           codes.NotFound,
+	codeConflict:           codes.FailedPrecondition,
+	codeVersionConflict:    codes.Aborted,
+	codeTaskBlocked:        codes.FailedPrecondition,
+	codeInvalidTransition:  codes.FailedPrecondition,
+	codeQuotaExceeded:      codes.ResourceExhausted,
+	codeTimeout:            codes.DeadlineExceeded,
+}
+
+// Convert an apiError into a gRPC status error, with the REST code and
+// details in an ErrorInfo and any invalid fields in a BadRequest
+func grpcError(err error) error {
+	var e apiError
+	if !errors.As(err, &e) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	code, ok := grpcCodes[e.Code]
+	if !ok {
+		code = codes.Internal
+	}
+	info := &errdetails.ErrorInfo{Reason: e.Code, Domain: grpcErrorDomain}
+	for name, value := range e.Details {
+		if info.Metadata == nil {
+			info.Metadata = map[string]string{}
+		}
+		if s, ok := value.(string); ok {
+			info.Metadata[name] = s
+		} else {
+			b, _ := json.Marshal(value)
+			info.Metadata[name] = string(b)
+		}
+	}
+	st, detailErr := status.New(code, e.Message).WithDetails(info)
+	if detailErr == nil && e.Fields != nil {
+		fields := make([]string, 0, len(e.Fields))
+		for field := range e.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		bad := &errdetails.BadRequest{}
+		for _, field := range fields {
+			bad.FieldViolations = append(bad.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: field, Description: e.Fields[field]})
+		}
+		st, detailErr = st.WithDetails(bad)
+	}
+	if detailErr != nil {
+		log.Printf("Failed to attach gRPC error details: %v", detailErr)
+		return status.Error(code, e.Message)
+	}
+	return st.Err()
+}
+
+// Implements taskpb.TaskServiceServer on top of the operations in taskops.go
+type taskServer struct {
+	taskpb.UnimplementedTaskServiceServer
+}
+
+func (taskServer) CreateTask(ctx context.Context, req *taskpb.CreateTaskRequest) (*taskpb.Task, error) {
+	dueDate, err := grpcTime("due_date", req.DueDate)
+	if err != nil {
+		return nil, err
+	}
+	task, err := apiCreateTask(ginContext(ctx), Task{
+		Title:       req.Title,
+		Description: req.Description,
+		Status:      req.Status,
+		Priority:    req.Priority,
+		Tags:        req.Tags,
+		DueDate:     dueDate,
+		AssigneeID:  req.AssigneeId,
+		Color:       req.Color,
+		Recurrence:  req.Recurrence,
+		ParentID:    req.ParentId,
+		BlockedBy:   req.BlockedBy,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return taskProto(task), nil
+}
+
+func (taskServer) GetTask(ctx context.Context, req *taskpb.GetTaskRequest) (*taskpb.Task, error) {
+	task, err := apiLoadTask(currentUser(ginContext(ctx)), req.Id, canViewTask)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return taskProto(task), nil
+}
+
+func (taskServer) ListTasks(ctx context.Context, req *taskpb.ListTasksRequest) (*taskpb.ListTasksResponse, error) {
+	if req.Limit < 0 || req.Offset < 0 {
+		return nil, grpcError(newAPIError(codeBadRequest, "limit and offset must be non-negative integers"))
+	}
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	limit = clampLimit(limit)
+	list, err := apiListTasks(ctx, currentUser(ginContext(ctx)), req.Status)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &taskpb.ListTasksResponse{Total: int32(len(list))}
+	for _, task := range paginate(list, limit, int(req.Offset)) {
+		resp.Tasks = append(resp.Tasks, taskProto(task))
+	}
+	return resp, nil
+}
+
+func (taskServer) UpdateTask(ctx context.Context, req *taskpb.UpdateTaskRequest) (*taskpb.Task, error) {
+	c := ginContext(ctx)
+	task, err := apiLoadTask(currentUser(c), req.Id, ownsTask)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	dueDate, err := grpcTime("due_date", req.DueDate)
+	if err != nil {
+		return nil, err
+	}
+	patch := taskPatch{
+		Title:       req.Title,
+		Description: req.Description,
+		Status:      req.Status,
+		Priority:    req.Priority,
+		DueDate:     dueDate,
+		AssigneeID:  req.AssigneeId,
+		Color:       req.Color,
+		Recurrence:  req.Recurrence,
+		ParentID:    req.ParentId,
+	}
+	if req.Tags != nil {
+		patch.Tags = &req.Tags.Values
+	}
+	if req.BlockedBy != nil {
+		patch.BlockedBy = &req.BlockedBy.Values
+	}
+	var version *int
+	if req.Version != nil {
+		v := int(*req.Version)
+		version = &v
+	}
+	task, _, err = apiPatchTask(c, task, patch, version)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return taskProto(task), nil
+}
+
+func (taskServer) DeleteTask(ctx context.Context, req *taskpb.DeleteTaskRequest) (*emptypb.Empty, error) {
+	c := ginContext(ctx)
+	task, err := apiLoadTask(currentUser(c), req.Id, ownsTask)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if err := apiDeleteTask(c, task, req.Cascade); err != nil {
+		return nil, grpcError(err)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// Convert an optional timestamp of a request, rejecting out of range ones
+func grpcTime(field string, ts *timestamppb.Timestamp) (*time.Time, error) {
+	if ts == nil {
+		return nil, nil
+	}
+	if err := ts.CheckValid(); err != nil {
+		message := "Invalid " + field + ": " + err.Error()
+		return nil, grpcError(apiError{Code: codeValidationFailed, Message: message, Fields: map[string]string{field: message}})
+	}
+	t := ts.AsTime()
+	return &t, nil
+}
+
+func protoTime(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// The protobuf message of a task
+func taskProto(task Task) *taskpb.Task {
+	return &taskpb.Task{
+		Id:          task.ID,
+		UserId:      task.UserID,
+		Title:       task.Title,
+		Description: task.Description,
+		Status:      task.Status,
+		Priority:    task.Priority,
+		Tags:        task.Tags,
+		DueDate:     protoTime(task.DueDate),
+		AssigneeId:  task.AssigneeID,
+		Color:       task.Color,
+		Recurrence:  task.Recurrence,
+		ParentId:    task.ParentID,
+		BlockedBy:   task.BlockedBy,
+		Archived:    task.Archived,
+		CompletedAt: protoTime(task.CompletedAt),
+		CreatedBy:   task.CreatedBy,
+		UpdatedBy:   task.UpdatedBy,
+		Position:    int32(task.Position),
+		Version:     int32(task.Version),
+		CreatedAt:   timestamppb.New(task.CreatedAt),
+		UpdatedAt:   timestamppb.New(task.UpdatedAt),
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"example/task/taskpb"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Serve gRPC over an in-memory connection, sharing the test server's stores,
+// and return a client of it
+func newGRPCClient(t *testing.T) taskpb.TaskServiceClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	grpcServer := newGRPCServer()
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return taskpb.NewTaskServiceClient(conn)
+}
+
+// A context sending token as the call's bearer token
+func asUser(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// Fail the test unless err is a gRPC error with the given status code and,
+// when reason isn't empty, REST error code
+func expectGRPCError(t *testing.T, what string, err error, code codes.Code, reason string) {
+	t.Helper()
+	st := status.Convert(err)
+	if err == nil || st.Code() != code {
+		t.Errorf("%s: error = %v, want %s", what, err, code)
+		return
+	}
+	if reason == "" {
+		return
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == reason {
+			return
+		}
+	}
+	t.Errorf("%s: details = %v, want an ErrorInfo with reason %s", what, st.Details(), reason)
+}
+
+func TestGRPCServesTheSameTasksAsREST(t *testing.T) {
+	srv := newTestServer(t)
+	ada, token := srv.signup("Ada", "ada@example.com")
+	client := newGRPCClient(t)
+	ctx := asUser(token)
+
+	created, err := client.CreateTask(ctx, &taskpb.CreateTaskRequest{Title: "Write report", Tags: []string{"work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.UserId != ada.ID || created.Status != StatusTodo || created.Priority != PriorityMedium {
+		t.Errorf("created task = %v, want Ada's, todo and medium", created)
+	}
+	var stored Task
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+created.Id, token, nil, &stored)
+	if stored.Title != "Write report" || !equalStrings(stored.Tags, []string{"work"}) {
+		t.Errorf("REST sees the gRPC-created task as %+v", stored)
+	}
+
+	restTask := srv.createTask(token, gin.H{"title": "From REST"})
+	got, err := client.GetTask(ctx, &taskpb.GetTaskRequest{Id: restTask.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "From REST" || int(got.Version) != restTask.Version {
+		t.Errorf("gRPC sees the REST-created task as %v", got)
+	}
+	list, err := client.ListTasks(ctx, &taskpb.ListTasksRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 2 || len(list.Tasks) != 2 {
+		t.Errorf("ListTasks = %d of %d tasks, want 2", len(list.Tasks), list.Total)
+	}
+
+	if _, err := client.DeleteTask(ctx, &taskpb.DeleteTaskRequest{Id: created.Id}); err != nil {
+		t.Fatal(err)
+	}
+	srv.expect(http.StatusNotFound, http.MethodGet, "/v1/tasks/"+created.Id, token, nil, nil)
+}
+
+func TestGRPCUpdatesFollowTheRESTRules(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	client := newGRPCClient(t)
+	ctx := asUser(token)
+	task := srv.createTask(token, gin.H{"title": "Task"})
+
+	done := StatusDone
+	updated, err := client.UpdateTask(ctx, &taskpb.UpdateTaskRequest{Id: task.ID, Status: &done})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status != StatusDone || updated.CompletedAt == nil {
+		t.Errorf("updated task = %v, want done with a completion time", updated)
+	}
+
+	inProgress := StatusInProgress
+	_, err = client.UpdateTask(ctx, &taskpb.UpdateTaskRequest{Id: task.ID, Status: &inProgress})
+	expectGRPCError(t, "reopening a done task", err, codes.FailedPrecondition, codeInvalidTransition)
+
+	title, stale := "Stale", int32(1)
+	_, err = client.UpdateTask(ctx, &taskpb.UpdateTaskRequest{Id: task.ID, Title: &title, Version: &stale})
+	expectGRPCError(t, "updating a stale version", err, codes.Aborted, codeVersionConflict)
+
+	yesterday := timestamppb.New(time.Now().Add(-24 * time.Hour))
+	_, err = client.UpdateTask(ctx, &taskpb.UpdateTaskRequest{Id: task.ID, DueDate: yesterday})
+	expectGRPCError(t, "moving the due date into the past", err, codes.InvalidArgument, codeValidationFailed)
+
+	_, err = client.CreateTask(ctx, &taskpb.CreateTaskRequest{})
+	expectGRPCError(t, "creating without a title", err, codes.InvalidArgument, "")
+}
+
+func TestGRPCChecksTheCaller(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	_, bobToken := srv.signup("Bob", "bob@example.com")
+	client := newGRPCClient(t)
+	task := srv.createTask(token, gin.H{"title": "Ada's"})
+
+	_, err := client.GetTask(context.Background(), &taskpb.GetTaskRequest{Id: task.ID})
+	expectGRPCError(t, "no token", err, codes.Unauthenticated, codeUnauthorized)
+	_, err = client.GetTask(asUser("not.a.token"), &taskpb.GetTaskRequest{Id: task.ID})
+	expectGRPCError(t, "bad token", err, codes.Unauthenticated, codeUnauthorized)
+
+	if _, err := client.GetTask(asUser(bobToken), &taskpb.GetTaskRequest{Id: task.ID}); status.Code(err) == codes.OK {
+		t.Error("Bob read Ada's task over gRPC")
+	}
+	if _, err := client.DeleteTask(asUser(bobToken), &taskpb.DeleteTaskRequest{Id: task.ID}); status.Code(err) == codes.OK {
+		t.Error("Bob deleted Ada's task over gRPC")
+	}
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+task.ID, token, nil, nil)
+}
+
+// A gRPC call that outlives the shutdown timeout is cut off, rather than
+// holding the process up
+func TestShutdownStopsGRPCCallsStillRunning(t *testing.T) {
+	started := make(chan struct{})
+	grpcServer := grpc.NewServer()
+	grpcServer.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Stuck",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Wait",
+			Handler: func(_ interface{}, ctx context.Context, _ func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				close(started)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+		}},
+	}, struct{}{})
+	listener := bufconn.Listen(1 << 20)
+	go grpcServer.Serve(listener)
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	called := make(chan error, 1)
+	go func() {
+		called <- conn.Invoke(context.Background(), "/test.Stuck/Wait", &emptypb.Empty{}, &emptypb.Empty{})
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := shutdownServers(ctx, &http.Server{}, grpcServer); err == nil {
+		t.Error("shutdown reported a clean stop with a call still running")
+	}
+	select {
+	case err := <-called:
+		if err == nil {
+			t.Error("the stuck call succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the stuck call is still running after shutdown")
+	}
+}
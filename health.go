@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Slowest the store may answer the readiness check when READY_MAX_LATENCY is not set
+const defaultReadyMaxLatency = 500 * time.Millisecond
+
+// Read READY_MAX_LATENCY, a Go duration such as 250ms
+func readyMaxLatency() (time.Duration, error) {
+	v := os.Getenv("READY_MAX_LATENCY")
+	if v == "" {
+		return defaultReadyMaxLatency, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("READY_MAX_LATENCY %q must be a positive duration", v)
+	}
+	return d, nil
+}
+
+// A duration in fractional milliseconds, for JSON bodies
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Liveness probe: the process is up and serving
+func health(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness probe: the stores answer a count of users and tasks within
+// maxLatency. The body names the store kind and how long the check took, so
+// a slow or failing database can be told apart from a process that is down.
+func ready(storeKind string, maxLatency time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checkedAt := time.Now()
+		_, err := users.Count()
+		if err == nil {
+			_, err = tasks.Count()
+		}
+		latency := time.Since(checkedAt)
+		body := gin.H{
+			"status":         "ready",
+			"store":          storeKind,
+			"latency_ms":     milliseconds(latency),
+			"max_latency_ms": milliseconds(maxLatency),
+			"checked_at":     checkedAt.UTC(),
+		}
+		switch {
+		case err != nil:
+			log.Printf("Readiness check failed: %v", err)
+			body["status"] = "unavailable"
+			body["error"] = "store query failed"
+		case latency > maxLatency:
+			log.Printf("Readiness check failed: store took %s, more than %s", latency, maxLatency)
+			body["status"] = "unavailable"
+			body["error"] = "store is too slow"
+		default:
+			c.JSON(http.StatusOK, body)
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, body)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// One status change in a task's history
+type StatusChange struct {
+	ID        uint      `json:"id"`
+	TaskID    string    `json:"task_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Record that the authenticated user moved task from one status to another.
+// The task itself is already saved by now, so a failure is logged rather than reported.
+func recordStatusChange(c *gin.Context, taskID string, from, to string) {
+	if from == to {
+		return
+	}
+	_, err := history.Create(StatusChange{
+		TaskID:    taskID,
+		From:      from,
+		To:        to,
+		ChangedBy: currentUser(c).ID,
+	})
+	if err != nil {
+		log.Printf("Failed to record status change of task %s: %v", taskID, err)
+	}
+}
+
+// List a task's status changes, oldest first
+func getTaskHistory(c *gin.Context) {
+	task, ok := loadVisibleTask(c, true)
+	if !ok {
+		return
+	}
+	list, err := history.ListByTask(task.ID)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// Set on responses replayed from an earlier request with the same key
+const idempotentReplayHeader = "Idempotent-Replayed"
+
+// How long a key is remembered when IDEMPOTENCY_KEY_TTL is not set
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// Longest Idempotency-Key accepted
+const maxIdempotencyKeyLength = 255
+
+// The response a request with an Idempotency-Key produced, kept so retries get it again
+type idempotencyRecord struct {
+	UserID string
+	Key    string
+	// RequestHash fingerprints the method, path and body the key was first used with
+	RequestHash string
+	Status      int
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Read IDEMPOTENCY_KEY_TTL, a Go duration such as 24h
+func idempotencyTTL() (time.Duration, error) {
+	v := os.Getenv("IDEMPOTENCY_KEY_TTL")
+	if v == "" {
+		return defaultIdempotencyTTL, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("IDEMPOTENCY_KEY_TTL %q must be a positive duration", v)
+	}
+	return d, nil
+}
+
+// Middleware to make a request safe to retry when it carries an Idempotency-Key.
+// The first successful response for a key is stored for ttl and replayed for
+// every retry by the same user; reusing the key with a different request is
+// a 409. Failed requests are not stored, so they can be retried as new ones.
+// It must run after authMiddleware.
+func idempotencyMiddleware(ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			respondError(c, http.StatusBadRequest, codeBadRequest,
+				fmt.Sprintf("%s must not be longer than %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+			c.Abort()
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respondBodyTooLarge(c, tooLarge.Limit)
+			} else {
+				respondError(c, http.StatusBadRequest, codeBadRequest, "Failed to read request body")
+			}
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		userID := currentUser(c).ID
+		hash := requestFingerprint(c.Request.Method, c.Request.URL.Path, body)
+		// Hold the key until the first request finishes so a concurrent retry replays it
+		unlock, err := idempotencyKeys.Lock(c.Request.Context(), userID, key)
+		if err != nil {
+			respondStoreError(c, err, "Idempotency key not found")
+			c.Abort()
+			return
+		}
+		defer unlock()
+
+		record, err := idempotencyKeys.Get(userID, key)
+		switch {
+		case err == nil && record.RequestHash != hash:
+			respondError(c, http.StatusConflict, codeIdempotencyKeyReused,
+				idempotencyKeyHeader+" was already used with a different request")
+			c.Abort()
+			return
+		case err == nil:
+			c.Header(idempotentReplayHeader, "true")
+			c.Data(record.Status, "application/json; charset=utf-8", record.Body)
+			c.Abort()
+			return
+		case err != errNotFound:
+			log.Printf("Failed to look up idempotency key: %v", err)
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to look up idempotency key")
+			c.Abort()
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status < 200 || status >= 300 {
+			return
+		}
+		err = idempotencyKeys.Save(idempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: hash,
+			Status:      status,
+			Body:        recorder.body.Bytes(),
+			ExpiresAt:   time.Now().Add(ttl),
+		})
+		if err != nil {
+			log.Printf("Failed to save idempotency key: %v", err)
+		}
+	}
+}
+
+// Hash of everything that makes two requests the same request
+func requestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, method+" "+path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// bodyRecorder passes the response through while keeping a copy of the body
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// keyedMutex hands out one lock per key, dropping each once nobody holds it
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// Lock the key, returning the function that unlocks it
+func (m *keyedMutex) lock(key string) func() {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*keyedLock)
+	}
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		m.locks[key] = l
+	}
+	l.waiters++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		if l.waiters--; l.waiters == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Create a task sending key as its Idempotency-Key
+func createIdempotently(srv *testServer, token, key string, task gin.H) (*http.Response, []byte) {
+	srv.t.Helper()
+	return srv.send(http.MethodPost, "/v1/tasks", token, task, http.Header{idempotencyKeyHeader: {key}})
+}
+
+func TestRetriesWithAnIdempotencyKeyReplayTheFirstResponse(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+
+	resp, body := createIdempotently(srv, token, "create-report", gin.H{"title": "Write report"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("first request: status = %d, want 201; body %s", resp.StatusCode, body)
+	}
+	var first Task
+	if err := json.Unmarshal(body, &first); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body = createIdempotently(srv, token, "create-report", gin.H{"title": "Write report"})
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get(idempotentReplayHeader) != "true" {
+		t.Fatalf("retry: status = %d, %s = %q; want a replayed 201", resp.StatusCode, idempotentReplayHeader, resp.Header.Get(idempotentReplayHeader))
+	}
+	var retried Task
+	if err := json.Unmarshal(body, &retried); err != nil {
+		t.Fatal(err)
+	}
+	if retried.ID != first.ID {
+		t.Errorf("retry returned task %v, want the first response's %v", retried.ID, first.ID)
+	}
+	var list taskPage
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks", token, nil, &list)
+	if list.Total != 1 {
+		t.Errorf("%d tasks after a retried create, want 1", list.Total)
+	}
+
+	// Keys belong to the user who sent them
+	_, otherToken := srv.signup("Grace", "grace@example.com")
+	resp, body = createIdempotently(srv, otherToken, "create-report", gin.H{"title": "Write report"})
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get(idempotentReplayHeader) != "" {
+		t.Errorf("another user's request with the same key: status = %d, replayed = %q; want a new 201; body %s",
+			resp.StatusCode, resp.Header.Get(idempotentReplayHeader), body)
+	}
+}
+
+func TestReusingAnIdempotencyKeyForAnotherRequestIsAConflict(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+
+	resp, body := createIdempotently(srv, token, "create-report", gin.H{"title": "Write report"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("first request: status = %d, want 201; body %s", resp.StatusCode, body)
+	}
+	resp, body = createIdempotently(srv, token, "create-report", gin.H{"title": "Something else"})
+	if resp.StatusCode != http.StatusConflict || responseError(t, body).Code != codeIdempotencyKeyReused {
+		t.Fatalf("different body under the same key: status = %d, body %s; want 409 %s", resp.StatusCode, body, codeIdempotencyKeyReused)
+	}
+	var list taskPage
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks", token, nil, &list)
+	if list.Total != 1 {
+		t.Errorf("%d tasks after the refused request, want 1", list.Total)
+	}
+}
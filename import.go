@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Largest CSV upload accepted when IMPORT_MAX_BYTES is not set
+const defaultImportMaxBytes = 1 << 20
+
+// Header row an imported CSV file must start with
+var importColumns = []string{"title", "description", "status"}
+
+// Read IMPORT_MAX_BYTES
+func importMaxBytes() (int64, error) {
+	v := os.Getenv("IMPORT_MAX_BYTES")
+	if v == "" {
+		return defaultImportMaxBytes, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("IMPORT_MAX_BYTES %q must be a positive integer", v)
+	}
+	return n, nil
+}
+
+// A row that could not be imported
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Build the handler for POST /tasks/import, which creates a task owned by the
+// caller for every valid row of the uploaded CSV "file" and reports the rows
+// that are invalid by line number. Uploads over maxBytes are rejected with 413.
+func importTasks(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Leave room for the multipart envelope around the file itself
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+multipartOverhead)
+		header, err := c.FormFile("file")
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) || (err == nil && header.Size > maxBytes) {
+			respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("File must not be larger than %d bytes", maxBytes))
+			return
+		}
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "Expected a CSV upload in the \"file\" form field")
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		defer file.Close()
+
+		r := csv.NewReader(file)
+		r.FieldsPerRecord = len(importColumns)
+		first, err := r.Read()
+		if err != nil || !equalColumns(first, importColumns) {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "Header row must be "+strings.Join(importColumns, ","))
+			return
+		}
+
+		user := currentUser(c)
+		userID := user.ID
+		remaining, err := remainingTaskQuota(c.Request.Context(), user)
+		if err != nil {
+			respondStoreError(c, err, "Task not found")
+			return
+		}
+		created := 0
+		rowErrors := []importError{}
+		for {
+			// Past the request deadline the response is already sent
+			if c.Request.Context().Err() != nil {
+				return
+			}
+			record, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrors = append(rowErrors, importError{Line: parseErr.StartLine, Error: parseErr.Err.Error()})
+				continue
+			}
+			if err != nil {
+				respondError(c, http.StatusBadRequest, codeBadRequest, err.Error())
+				return
+			}
+			line, _ := r.FieldPos(0)
+			task := Task{Title: record[0], Description: record[1], Status: record[2]}
+			if err := prepareNewTask(&task); err != nil {
+				rowErrors = append(rowErrors, importError{Line: line, Error: err.Error()})
+				continue
+			}
+			if created >= remaining {
+				rowErrors = append(rowErrors, importError{Line: line, Error: quotaExceeded(user, 0).Message})
+				continue
+			}
+			task.UserID = userID
+			task.CreatedBy, task.UpdatedBy = userID, userID
+			task, err = tasks.Create(task)
+			if err != nil {
+				respondStoreError(c, err, "Task not found")
+				return
+			}
+			recordAudit(c, AuditCreate, AuditResourceTask, task.ID, nil, task)
+			notifyTaskEvent(EventTaskCreated, task)
+			created++
+		}
+		c.JSON(http.StatusOK, gin.H{"created": created, "errors": rowErrors})
+	}
+}
+
+// Compare a header row against the expected column names, ignoring case and padding
+func equalColumns(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range want {
+		if !strings.EqualFold(strings.TrimSpace(got[i]), want[i]) {
+			return false
+		}
+	}
+	return true
+}
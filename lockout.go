@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failed logins allowed within the window when LOGIN_MAX_ATTEMPTS is not set
+const defaultLoginMaxAttempts = 5
+
+// Window failed logins are counted over when LOGIN_LOCKOUT_WINDOW is not set
+const defaultLoginWindow = 15 * time.Minute
+
+// Read LOGIN_MAX_ATTEMPTS and LOGIN_LOCKOUT_WINDOW, a Go duration such as 15m
+func loginLockoutConfig() (int, time.Duration, error) {
+	attempts, window := defaultLoginMaxAttempts, defaultLoginWindow
+	if v := os.Getenv("LOGIN_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("LOGIN_MAX_ATTEMPTS %q must be a positive integer", v)
+		}
+		attempts = n
+	}
+	if v := os.Getenv("LOGIN_LOCKOUT_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("LOGIN_LOCKOUT_WINDOW %q must be a positive duration", v)
+		}
+		window = d
+	}
+	return attempts, window, nil
+}
+
+// LoginFailureStore keeps the times of failed logins by key
+type LoginFailureStore interface {
+	// Add records a failure of the key at the given time, forgetting the
+	// failures, of the key and any other, from before since
+	Add(key string, at, since time.Time) error
+	// Since returns the key's failures after since, oldest first
+	Since(key string, since time.Time) ([]time.Time, error)
+	// Clear forgets the key's failures
+	Clear(key string) error
+}
+
+// loginTracker counts failed logins per email over a sliding window. An email
+// with maxAttempts failures inside the window is locked until the oldest of
+// them falls out of it.
+type loginTracker struct {
+	maxAttempts int
+	window      time.Duration
+	failures    LoginFailureStore
+}
+
+// Failed logins, shared by the login handler and configured in newRouter
+var loginAttempts = newLoginTracker(defaultLoginMaxAttempts, defaultLoginWindow, &memoryLoginFailureStore{})
+
+func newLoginTracker(maxAttempts int, window time.Duration, failures LoginFailureStore) *loginTracker {
+	return &loginTracker{maxAttempts: maxAttempts, window: window, failures: failures}
+}
+
+// Emails differing only in case or surrounding space share one counter
+func loginKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Report whether the email is locked and, if so, how long until it is not
+func (t *loginTracker) locked(email string) (bool, time.Duration, error) {
+	now := time.Now()
+	recent, err := t.failures.Since(loginKey(email), now.Add(-t.window))
+	if err != nil || len(recent) < t.maxAttempts {
+		return false, 0, err
+	}
+	return true, recent[len(recent)-t.maxAttempts].Add(t.window).Sub(now), nil
+}
+
+// Count a failed login for the email
+func (t *loginTracker) fail(email string) error {
+	now := time.Now()
+	return t.failures.Add(loginKey(email), now, now.Add(-t.window))
+}
+
+// Forget the email's failures after a successful login
+func (t *loginTracker) reset(email string) error {
+	return t.failures.Clear(loginKey(email))
+}
+
+// memoryLoginFailureStore keeps failed logins in memory, guarded by a mutex
+type memoryLoginFailureStore struct {
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func (s *memoryLoginFailureStore) Add(key string, at, since time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures == nil {
+		s.failures = make(map[string][]time.Time)
+	}
+	for other := range s.failures {
+		s.recent(other, since)
+	}
+	s.failures[key] = append(s.failures[key], at)
+	return nil
+}
+
+func (s *memoryLoginFailureStore) Since(key string, since time.Time) ([]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]time.Time(nil), s.recent(key, since)...), nil
+}
+
+func (s *memoryLoginFailureStore) Clear(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+// Drop the key's failures from before since and return the rest, oldest
+// first. The caller must hold the lock.
+func (s *memoryLoginFailureStore) recent(key string, since time.Time) []time.Time {
+	times := s.failures[key]
+	i := 0
+	for i < len(times) && !times[i].After(since) {
+		i++
+	}
+	if i == len(times) {
+		delete(s.failures, key)
+		return nil
+	}
+	s.failures[key] = times[i:]
+	return times[i:]
+}
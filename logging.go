@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// One structured log entry, keyed by field name
+type logEntry map[string]interface{}
+
+// RequestLogger receives structured entries from the middlewares.
+// Implement it to forward entries to another backend such as slog.
+type RequestLogger interface {
+	Log(entry logEntry)
+}
+
+// jsonLogger writes each entry as one JSON object per line
+type jsonLogger struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newJSONLogger(w io.Writer) *jsonLogger {
+	return &jsonLogger{enc: json.NewEncoder(w)}
+}
+
+func (l *jsonLogger) Log(entry logEntry) {
+	if _, ok := entry["time"]; !ok {
+		entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.enc.Encode(entry)
+}
+
+// Middleware to log every request once it has been handled
+func loggingMiddleware(logger RequestLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("requestStart", time.Now())
+		c.Next()
+
+		entry := logEntry{
+			"level":      "info",
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"status":     c.Writer.Status(),
+			"latency_ms": float64(requestLatency(c).Microseconds()) / 1000,
+			"client_ip":  c.ClientIP(),
+			"request_id": requestID(c),
+		}
+		if user := currentUser(c); user != nil {
+			entry["user_id"] = user.ID
+		}
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			entry["level"] = "error"
+		}
+		logger.Log(entry)
+	}
+}
+
+// Time since loggingMiddleware started handling the request
+func requestLatency(c *gin.Context) time.Duration {
+	start, ok := c.Get("requestStart")
+	if !ok {
+		return 0
+	}
+	return time.Since(start.(time.Time))
+}
+
+// Middleware to turn panics into a 500 and a structured error entry
+func recoveryMiddleware(logger RequestLogger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+		logger.Log(logEntry{
+			"level":      "error",
+			"msg":        "panic recovered",
+			"error":      fmt.Sprint(recovered),
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"request_id": requestID(c),
+		})
+		respondError(c, http.StatusInternalServerError, codeInternal, "Internal server error")
+		c.Abort()
+	})
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Get the authenticated user's own profile
+func getMe(c *gin.Context) {
+	c.JSON(http.StatusOK, currentUser(c))
+}
+
+// Update the authenticated user's name, email or password without needing their ID
+func updateMe(c *gin.Context) {
+	saveUserUpdate(c, *currentUser(c))
+}
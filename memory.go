@@ -0,0 +1,625 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryUserStore keeps users in memory, guarded by a read/write lock
+type memoryUserStore struct {
+	mu    sync.RWMutex
+	users []User
+}
+
+func (s *memoryUserStore) Create(user User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(user.Email, "") {
+		return User{}, errEmailTaken
+	}
+	now := time.Now()
+	user.ID = newID()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.DeletedAt = nil
+	s.users = append(s.users, user)
+	return user, nil
+}
+
+func (s *memoryUserStore) List(ctx context.Context) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// The wait for the lock is what may take long
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	list := make([]User, len(s.users))
+	copy(list, s.users)
+	return list, nil
+}
+
+func (s *memoryUserStore) GetByID(id string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.indexOf(id)
+	if i < 0 {
+		return User{}, errNotFound
+	}
+	return s.users[i], nil
+}
+
+func (s *memoryUserStore) GetByEmail(email string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return User{}, errNotFound
+}
+
+func (s *memoryUserStore) Update(id string, user User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(id)
+	if i < 0 {
+		return User{}, errNotFound
+	}
+	if s.emailTaken(user.Email, id) {
+		return User{}, errEmailTaken
+	}
+	user.ID = id
+	user.CreatedAt = s.users[i].CreatedAt
+	user.UpdatedAt = time.Now()
+	user.DeletedAt = s.users[i].DeletedAt
+	s.users[i] = user
+	return user, nil
+}
+
+func (s *memoryUserStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(id)
+	if i < 0 || s.users[i].DeletedAt != nil {
+		return errNotFound
+	}
+	now := time.Now()
+	s.users[i].DeletedAt = &now
+	return nil
+}
+
+func (s *memoryUserStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, user := range s.users {
+		if user.DeletedAt == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// indexOf expects the caller to hold the lock
+func (s *memoryUserStore) indexOf(id string) int {
+	for i, user := range s.users {
+		if user.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// emailTaken reports whether a user other than exceptID has the email.
+// It expects the caller to hold the lock.
+func (s *memoryUserStore) emailTaken(email string, exceptID string) bool {
+	for _, user := range s.users {
+		if user.ID != exceptID && strings.EqualFold(user.Email, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryTaskStore keeps tasks in memory, guarded by a read/write lock
+type memoryTaskStore struct {
+	mu    sync.RWMutex
+	tasks []Task
+}
+
+func (s *memoryTaskStore) Create(task Task) (Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.insert(task, time.Now()), nil
+}
+
+func (s *memoryTaskStore) CreateMany(tasks []Task) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	created := make([]Task, len(tasks))
+	for i, task := range tasks {
+		created[i] = s.insert(task, now)
+	}
+	return created, nil
+}
+
+// insert expects the caller to hold the lock
+func (s *memoryTaskStore) insert(task Task, now time.Time) Task {
+	task.ID = newID()
+	task.Version = 1
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	task.DeletedAt = nil
+	s.tasks = append(s.tasks, task)
+	return task
+}
+
+func (s *memoryTaskStore) List(ctx context.Context) ([]Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	list := make([]Task, len(s.tasks))
+	copy(list, s.tasks)
+	return list, nil
+}
+
+func (s *memoryTaskStore) ListByUser(ctx context.Context, userID, status string) ([]Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	list := []Task{}
+	for _, task := range s.tasks {
+		if task.UserID == userID && (status == "" || task.Status == status) {
+			list = append(list, task)
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryTaskStore) GetByID(id string) (Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := s.indexOf(id)
+	if i < 0 {
+		return Task{}, errNotFound
+	}
+	return s.tasks[i], nil
+}
+
+func (s *memoryTaskStore) Update(id string, task Task) (Task, error) {
+	task.ID = id
+	updated, err := s.UpdateMany([]Task{task})
+	if err != nil {
+		return Task{}, err
+	}
+	return updated[0], nil
+}
+
+func (s *memoryTaskStore) UpdateMany(tasks []Task) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	indexes := make([]int, len(tasks))
+	for n, task := range tasks {
+		i := s.indexOf(task.ID)
+		if i < 0 {
+			return nil, errNotFound
+		}
+		if task.Version != s.tasks[i].Version {
+			return nil, errVersionConflict
+		}
+		indexes[n] = i
+	}
+	now := time.Now()
+	updated := make([]Task, len(tasks))
+	for n, task := range tasks {
+		i := indexes[n]
+		task.Version++
+		task.CreatedAt = s.tasks[i].CreatedAt
+		task.UpdatedAt = now
+		task.DeletedAt = s.tasks[i].DeletedAt
+		s.tasks[i] = task
+		updated[n] = task
+	}
+	return updated, nil
+}
+
+func (s *memoryTaskStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(id)
+	if i < 0 || s.tasks[i].DeletedAt != nil {
+		return errNotFound
+	}
+	now := time.Now()
+	s.tasks[i].DeletedAt = &now
+	return nil
+}
+
+func (s *memoryTaskStore) Restore(id string) (Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(id)
+	if i < 0 || s.tasks[i].DeletedAt == nil {
+		return Task{}, errNotFound
+	}
+	s.tasks[i].DeletedAt = nil
+	return s.tasks[i], nil
+}
+
+func (s *memoryTaskStore) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, task := range s.tasks {
+		if task.DeletedAt == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// indexOf expects the caller to hold the lock
+func (s *memoryTaskStore) indexOf(id string) int {
+	for i, task := range s.tasks {
+		if task.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// memoryCommentStore keeps comments in memory, guarded by a read/write lock
+type memoryCommentStore struct {
+	mu       sync.RWMutex
+	comments []Comment
+	lastID   uint
+}
+
+func (s *memoryCommentStore) Create(comment Comment) (Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	comment.ID = s.lastID
+	comment.CreatedAt = time.Now()
+	s.comments = append(s.comments, comment)
+	return comment, nil
+}
+
+func (s *memoryCommentStore) ListByTask(taskID string) ([]Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Comment{}
+	for _, comment := range s.comments {
+		if comment.TaskID == taskID {
+			list = append(list, comment)
+		}
+	}
+	return list, nil
+}
+
+// memoryHistoryStore keeps status changes in memory, guarded by a read/write lock
+type memoryHistoryStore struct {
+	mu      sync.RWMutex
+	changes []StatusChange
+	lastID  uint
+}
+
+func (s *memoryHistoryStore) Create(change StatusChange) (StatusChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	change.ID = s.lastID
+	change.ChangedAt = time.Now()
+	s.changes = append(s.changes, change)
+	return change, nil
+}
+
+func (s *memoryHistoryStore) ListByTask(taskID string) ([]StatusChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []StatusChange{}
+	for _, change := range s.changes {
+		if change.TaskID == taskID {
+			list = append(list, change)
+		}
+	}
+	return list, nil
+}
+
+// memoryPasswordResetStore keeps pending password resets in memory, keyed
+// by token hash and guarded by a mutex
+type memoryPasswordResetStore struct {
+	mu     sync.Mutex
+	resets map[string]passwordReset
+}
+
+func (s *memoryPasswordResetStore) Create(reset passwordReset) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resets == nil {
+		s.resets = map[string]passwordReset{}
+	}
+	now := time.Now()
+	for hash, existing := range s.resets {
+		if existing.UserID == reset.UserID || !existing.ExpiresAt.After(now) {
+			delete(s.resets, hash)
+		}
+	}
+	s.resets[reset.TokenHash] = reset
+	return nil
+}
+
+func (s *memoryPasswordResetStore) Consume(tokenHash string) (passwordReset, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reset, ok := s.resets[tokenHash]
+	if !ok {
+		return passwordReset{}, errNotFound
+	}
+	delete(s.resets, tokenHash)
+	if !reset.ExpiresAt.After(time.Now()) {
+		return passwordReset{}, errNotFound
+	}
+	return reset, nil
+}
+
+// memoryTimeEntryStore keeps time entries in memory, guarded by a read/write lock
+type memoryTimeEntryStore struct {
+	mu      sync.RWMutex
+	entries []TimeEntry
+	lastID  uint
+}
+
+func (s *memoryTimeEntryStore) Start(entry TimeEntry) (TimeEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.entries {
+		if existing.TaskID == entry.TaskID && existing.StoppedAt == nil {
+			return TimeEntry{}, errTimerRunning
+		}
+	}
+	s.lastID++
+	entry.ID = s.lastID
+	entry.StartedAt = time.Now()
+	entry.StoppedAt = nil
+	s.entries = append(s.entries, entry)
+	return entry, nil
+}
+
+func (s *memoryTimeEntryStore) Stop(taskID string) (TimeEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, entry := range s.entries {
+		if entry.TaskID == taskID && entry.StoppedAt == nil {
+			now := time.Now()
+			s.entries[i].StoppedAt = &now
+			return s.entries[i], nil
+		}
+	}
+	return TimeEntry{}, errTimerNotRunning
+}
+
+func (s *memoryTimeEntryStore) ListByTask(taskID string) ([]TimeEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []TimeEntry{}
+	for _, entry := range s.entries {
+		if entry.TaskID == taskID {
+			list = append(list, entry)
+		}
+	}
+	return list, nil
+}
+
+// memoryAttachmentStore keeps attachment metadata in memory, guarded by a read/write lock
+type memoryAttachmentStore struct {
+	mu          sync.RWMutex
+	attachments []Attachment
+}
+
+func (s *memoryAttachmentStore) Create(attachment Attachment) (Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attachment.CreatedAt = time.Now()
+	s.attachments = append(s.attachments, attachment)
+	return attachment, nil
+}
+
+func (s *memoryAttachmentStore) ListByTask(taskID string) ([]Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Attachment{}
+	for _, attachment := range s.attachments {
+		if attachment.TaskID == taskID {
+			list = append(list, attachment)
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryAttachmentStore) GetByID(id string) (Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, attachment := range s.attachments {
+		if attachment.ID == id {
+			return attachment, nil
+		}
+	}
+	return Attachment{}, errNotFound
+}
+
+// memoryAuditStore keeps the audit log in memory, guarded by a read/write lock
+type memoryAuditStore struct {
+	mu      sync.RWMutex
+	entries []AuditEntry
+	lastID  uint
+}
+
+func (s *memoryAuditStore) Create(entry AuditEntry) (AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	entry.ID = s.lastID
+	entry.CreatedAt = time.Now()
+	s.entries = append(s.entries, entry)
+	return entry, nil
+}
+
+func (s *memoryAuditStore) List(ctx context.Context, filter auditFilter) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	list := []AuditEntry{}
+	for _, entry := range s.entries {
+		if filter.matches(entry) {
+			list = append(list, entry)
+		}
+	}
+	return list, nil
+}
+
+// memoryWebhookStore keeps webhooks in memory, guarded by a read/write lock
+type memoryWebhookStore struct {
+	mu    sync.RWMutex
+	hooks []Webhook
+}
+
+func (s *memoryWebhookStore) Create(hook Webhook) (Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hook.ID = newID()
+	hook.CreatedAt = time.Now()
+	s.hooks = append(s.hooks, hook)
+	return hook, nil
+}
+
+func (s *memoryWebhookStore) ListByUser(userID string) ([]Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Webhook{}
+	for _, hook := range s.hooks {
+		if hook.UserID == userID {
+			list = append(list, hook)
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryWebhookStore) GetByID(id string) (Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if i := s.indexOf(id); i >= 0 {
+		return s.hooks[i], nil
+	}
+	return Webhook{}, errNotFound
+}
+
+func (s *memoryWebhookStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.indexOf(id)
+	if i < 0 {
+		return errNotFound
+	}
+	s.hooks = append(s.hooks[:i], s.hooks[i+1:]...)
+	return nil
+}
+
+func (s *memoryWebhookStore) indexOf(id string) int {
+	for i, hook := range s.hooks {
+		if hook.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// memoryIdempotencyStore keeps idempotency records in memory, guarded by a lock.
+// Expired records are swept out on every Save.
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[idempotencyID]idempotencyRecord
+	locks   keyedMutex
+}
+
+// A record is identified by its user and key
+type idempotencyID struct {
+	userID string
+	key    string
+}
+
+func (s *memoryIdempotencyStore) Get(userID, key string) (idempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[idempotencyID{userID, key}]
+	if !ok || !time.Now().Before(record.ExpiresAt) {
+		return idempotencyRecord{}, errNotFound
+	}
+	return record, nil
+}
+
+func (s *memoryIdempotencyStore) Save(record idempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.records == nil {
+		s.records = make(map[idempotencyID]idempotencyRecord)
+	}
+	for id, r := range s.records {
+		if !now.Before(r.ExpiresAt) {
+			delete(s.records, id)
+		}
+	}
+	s.records[idempotencyID{record.UserID, record.Key}] = record
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Lock(_ context.Context, userID, key string) (func(), error) {
+	return s.locks.lock(userID + ":" + key), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Path the metrics are served on, which is itself never counted
+const metricsPath = "/metrics"
+
+// Route label for requests that matched no route, so unknown paths
+// cannot blow up the number of series
+const unmatchedRoute = "unmatched"
+
+// Prometheus collectors for the HTTP traffic and the stored records
+type metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Handled HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "Time taken to handle HTTP requests by method, route and status.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+	}
+	m.registry.MustRegister(
+		m.requests,
+		m.latency,
+		storeGauge("users_total", "Users that are not deleted.", func() (int, error) { return users.Count() }),
+		storeGauge("tasks_total", "Tasks that are not deleted.", func() (int, error) { return tasks.Count() }),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// A gauge read from a store on every scrape. A failing store reports -1
+// rather than failing the whole scrape.
+func storeGauge(name, help string, count func() (int, error)) prometheus.Collector {
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+		n, err := count()
+		if err != nil {
+			return -1
+		}
+		return float64(n)
+	})
+}
+
+// Middleware to count and time every request by its route. It must run
+// inside loggingMiddleware, whose start time it reuses.
+func (m *metrics) middleware(c *gin.Context) {
+	route := c.FullPath()
+	if route == metricsPath {
+		c.Next()
+		return
+	}
+	if route == "" {
+		route = unmatchedRoute
+	}
+	c.Next()
+
+	status := strconv.Itoa(c.Writer.Status())
+	m.requests.WithLabelValues(c.Request.Method, route, status).Inc()
+	m.latency.WithLabelValues(c.Request.Method, route, status).Observe(requestLatency(c).Seconds())
+}
+
+// Handler serving the metrics in the Prometheus text format
+func (m *metrics) handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Answer requests no route matches with the JSON error envelope instead of
+// gin's plain-text default: 404 ROUTE_NOT_FOUND for unknown paths, and 405
+// METHOD_NOT_ALLOWED, with an Allow header, for known paths requested with
+// the wrong method
+func registerFallbacks(router *gin.Engine) {
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(func(c *gin.Context) {
+		respondError(c, http.StatusNotFound, codeRouteNotFound, "No route for "+c.Request.Method+" "+c.Request.URL.Path)
+	})
+	router.NoMethod(func(c *gin.Context) {
+		allowed := allowedMethods(router, c.Request.URL.Path)
+		c.Header("Allow", strings.Join(allowed, ", "))
+		writeError(c, http.StatusMethodNotAllowed, apiError{
+			Code:    codeMethodNotAllowed,
+			Message: c.Request.Method + " is not allowed on " + c.Request.URL.Path,
+			Details: gin.H{"allowed": allowed},
+		})
+	})
+}
+
+// The methods of the routes matching path, sorted
+func allowedMethods(router *gin.Engine, path string) []string {
+	seen := map[string]bool{}
+	allowed := []string{}
+	for _, route := range router.Routes() {
+		if !seen[route.Method] && routeMatches(route.Path, path) {
+			seen[route.Method] = true
+			allowed = append(allowed, route.Method)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// Report whether a route pattern such as /v1/tasks/:id or /swagger/*any
+// matches the path
+func routeMatches(pattern, path string) bool {
+	patternParts := strings.Split(pattern, "/")
+	pathParts := strings.Split(path, "/")
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if pathParts[i] == "" {
+				return false
+			}
+		} else if part != pathParts[i] {
+			return false
+		}
+	}
+	return len(patternParts) == len(pathParts)
+}
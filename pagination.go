@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Page sizes used when DEFAULT_PAGE_SIZE and MAX_PAGE_SIZE are not set
+const (
+	fallbackPageSize    = 20
+	fallbackMaxPageSize = 100
+)
+
+// Page size used when ?limit= is omitted and the largest one a request gets,
+// set from the config in main
+var (
+	defaultPageSize = fallbackPageSize
+	maxPageSize     = fallbackMaxPageSize
+)
+
+// Read DEFAULT_PAGE_SIZE and MAX_PAGE_SIZE, which may not be smaller than it
+func pageSizeSettings() (int, int, error) {
+	def, max := fallbackPageSize, fallbackMaxPageSize
+	if v := os.Getenv("DEFAULT_PAGE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("DEFAULT_PAGE_SIZE %q must be a positive integer", v)
+		}
+		def = n
+	}
+	if v := os.Getenv("MAX_PAGE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("MAX_PAGE_SIZE %q must be a positive integer", v)
+		}
+		max = n
+	}
+	if def > max {
+		return 0, 0, fmt.Errorf("DEFAULT_PAGE_SIZE %d must not exceed MAX_PAGE_SIZE %d", def, max)
+	}
+	return def, max, nil
+}
+
+// Clamp a requested page size to MAX_PAGE_SIZE. Larger ones are served
+// rather than rejected; the envelope's limit tells the client what it got.
+func clampLimit(limit int) int {
+	if limit > maxPageSize {
+		return maxPageSize
+	}
+	return limit
+}
+
+// How a list endpoint paged its results
+const (
+	paginationOffset = "offset"
+	paginationCursor = "cursor"
+)
+
+// Response header carrying the number of matching records before
+// pagination, as table libraries expect and for HEAD requests, which have no body
+const totalCountHeader = "X-Total-Count"
+
+// Set the total count header of a list response
+func setTotalCount(c *gin.Context, total int) {
+	c.Header(totalCountHeader, strconv.Itoa(total))
+}
+
+// Envelope returned by list endpoints
+type page struct {
+	Data    interface{} `json:"data"`
+	Total   int         `json:"total"`
+	Limit   int         `json:"limit"`
+	Offset  int         `json:"offset"`
+	HasNext bool        `json:"has_next"`
+	HasPrev bool        `json:"has_prev"`
+	Links   pageLinks   `json:"links"`
+	// Pagination is set by endpoints that also offer cursor pagination
+	Pagination string `json:"pagination,omitempty"`
+}
+
+// Links to a page and its neighbours, each the request's own URL with only
+// the paging parameters changed, so filters and sorting carry over. Next and
+// Prev are nil on the last and first pages.
+type pageLinks struct {
+	Self string  `json:"self"`
+	Next *string `json:"next"`
+	Prev *string `json:"prev"`
+}
+
+// Build the envelope of the page of items starting at offset, out of total
+func newPage(c *gin.Context, items interface{}, total, limit, offset int) page {
+	p := page{Data: items, Total: total, Limit: limit, Offset: offset}
+	p.HasNext = limit > 0 && offset+limit < total
+	p.HasPrev = offset > 0
+	p.Links.Self = pageLink(c, "offset", strconv.Itoa(offset), limit)
+	if p.HasNext {
+		next := pageLink(c, "offset", strconv.Itoa(offset+limit), limit)
+		p.Links.Next = &next
+	}
+	if p.HasPrev {
+		prevOffset := offset - limit
+		if prevOffset < 0 {
+			prevOffset = 0
+		}
+		prev := pageLink(c, "offset", strconv.Itoa(prevOffset), limit)
+		p.Links.Prev = &prev
+	}
+	return p
+}
+
+// The request's path and query with ?limit= and the given paging parameter set
+func pageLink(c *gin.Context, param, value string, limit int) string {
+	query := c.Request.URL.Query()
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set(param, value)
+	return (&url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}).String()
+}
+
+// Envelope returned by list endpoints in cursor mode. NextCursor is nil on
+// the last page. Cursors only lead forward, so Links.Prev is always nil,
+// though HasPrev tells whether the page is past the first.
+type cursorPage struct {
+	Data       interface{} `json:"data"`
+	Total      int         `json:"total"`
+	Limit      int         `json:"limit"`
+	NextCursor *string     `json:"next_cursor"`
+	HasNext    bool        `json:"has_next"`
+	HasPrev    bool        `json:"has_prev"`
+	Links      pageLinks   `json:"links"`
+	Pagination string      `json:"pagination"`
+}
+
+// Position of the last task on a page. Cursors are opaque to clients: the
+// base64url of this as JSON.
+type taskCursor struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func encodeCursor(task Task) string {
+	b, _ := json.Marshal(taskCursor{ID: task.ID, CreatedAt: task.CreatedAt})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode a ?cursor= value; an empty one starts from the first page
+func decodeCursor(v string) (*taskCursor, error) {
+	if v == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, errors.New("cursor is invalid")
+	}
+	var cur taskCursor
+	if err := json.Unmarshal(b, &cur); err != nil || cur.ID == "" {
+		return nil, errors.New("cursor is invalid")
+	}
+	return &cur, nil
+}
+
+// Order tasks by creation time, then ID, and slice out the page following
+// the cursor. Because the cursor names a position rather than an index, tasks
+// created between requests never shift later pages.
+func cursorPaginate(list []Task, desc bool, after *taskCursor, limit int) ([]Task, *string) {
+	before := func(a Task, createdAt time.Time, id string) bool {
+		if !a.CreatedAt.Equal(createdAt) {
+			return a.CreatedAt.Before(createdAt) != desc
+		}
+		return a.ID < id != desc
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return before(list[i], list[j].CreatedAt, list[j].ID)
+	})
+	start := 0
+	if after != nil {
+		start = sort.Search(len(list), func(i int) bool {
+			return !before(list[i], after.CreatedAt, after.ID) &&
+				!(list[i].ID == after.ID && list[i].CreatedAt.Equal(after.CreatedAt))
+		})
+	}
+	items := paginate(list, limit, start)
+	if limit == 0 || start+limit >= len(list) {
+		return items, nil
+	}
+	next := encodeCursor(items[len(items)-1])
+	return items, &next
+}
+
+// Read ?limit= and ?offset= from the query string. The limit defaults to
+// DEFAULT_PAGE_SIZE and is clamped to MAX_PAGE_SIZE.
+func parsePagination(c *gin.Context) (limit, offset int, err error) {
+	limit, offset = defaultPageSize, 0
+	if v := c.Query("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return 0, 0, errors.New("limit must be a non-negative integer")
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return clampLimit(limit), offset, nil
+}
+
+// Slice out one page of items, never returning nil so the JSON is always an array
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A page of the task list in cursor mode
+type taskCursorPage struct {
+	Data       []Task  `json:"data"`
+	NextCursor *string `json:"next_cursor"`
+	Pagination string  `json:"pagination"`
+}
+
+// Follow next_cursor from the first page of query to the last, returning the
+// titles in the order they came. Before fetching the second page, between is
+// called if it isn't nil.
+func walkCursor(srv *testServer, token, query string, between func()) []string {
+	srv.t.Helper()
+	var titles []string
+	cursor := ""
+	for pages := 1; ; pages++ {
+		var p taskCursorPage
+		srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks?"+query+"&cursor="+url.QueryEscape(cursor), token, nil, &p)
+		if p.Pagination != paginationCursor {
+			srv.t.Fatalf("pagination = %q, want %q", p.Pagination, paginationCursor)
+		}
+		for _, task := range p.Data {
+			titles = append(titles, task.Title)
+		}
+		if p.NextCursor == nil {
+			return titles
+		}
+		if pages > 10 {
+			srv.t.Fatalf("still paging after %d pages: %q", pages, titles)
+		}
+		if pages == 1 && between != nil {
+			between()
+		}
+		cursor = *p.NextCursor
+	}
+}
+
+func TestCursorPaginationWalksEveryTaskOnce(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	for i := 1; i <= 5; i++ {
+		srv.createTask(token, gin.H{"title": fmt.Sprintf("Task %d", i)})
+	}
+
+	if got, want := walkCursor(srv, token, "limit=2", nil), []string{"Task 5", "Task 4", "Task 3", "Task 2", "Task 1"}; !equalStrings(got, want) {
+		t.Errorf("newest first: got %q, want %q", got, want)
+	}
+	if got, want := walkCursor(srv, token, "limit=2&order=asc", nil), []string{"Task 1", "Task 2", "Task 3", "Task 4", "Task 5"}; !equalStrings(got, want) {
+		t.Errorf("oldest first: got %q, want %q", got, want)
+	}
+
+	// A task created mid-walk lands before the cursor, so later pages neither
+	// repeat nor skip a task as an offset would
+	got := walkCursor(srv, token, "limit=2", func() {
+		srv.createTask(token, gin.H{"title": "Task 6"})
+	})
+	if want := []string{"Task 5", "Task 4", "Task 3", "Task 2", "Task 1"}; !equalStrings(got, want) {
+		t.Errorf("with a task created mid-walk: got %q, want %q", got, want)
+	}
+}
+
+func TestCursorPaginationRejectsBadParameters(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	srv.createTask(token, gin.H{"title": "Task"})
+
+	for _, query := range []string{
+		"cursor=not-a-cursor",
+		"cursor=&offset=1",
+		"cursor=&sort=priority",
+	} {
+		status, body := srv.do(http.MethodGet, "/v1/tasks?"+query, token, nil)
+		if status != http.StatusBadRequest {
+			t.Errorf("?%s: status = %d, want 400; body %s", query, status, body)
+		}
+	}
+}
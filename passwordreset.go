@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long a password reset token stays valid when PASSWORD_RESET_TTL is not set
+const defaultPasswordResetTTL = time.Hour
+
+// A pending password reset. Only the hash of the token is kept, so the
+// stored records can't be used to reset anyone's password.
+type passwordReset struct {
+	TokenHash string
+	UserID    string
+	ExpiresAt time.Time
+}
+
+// Settings of password resets
+type passwordResetConfig struct {
+	ttl time.Duration
+	// url is the page the emailed link points at, with the token added as ?token=;
+	// empty to email the bare token
+	url string
+}
+
+// Read PASSWORD_RESET_TTL, a Go duration such as 1h, and PASSWORD_RESET_URL
+func passwordResetSettings() (passwordResetConfig, error) {
+	cfg := passwordResetConfig{ttl: defaultPasswordResetTTL, url: os.Getenv("PASSWORD_RESET_URL")}
+	if v := os.Getenv("PASSWORD_RESET_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return passwordResetConfig{}, fmt.Errorf("PASSWORD_RESET_TTL %q must be a positive duration", v)
+		}
+		cfg.ttl = d
+	}
+	if cfg.url != "" {
+		if u, err := url.Parse(cfg.url); err != nil || u.Scheme == "" || u.Host == "" {
+			return passwordResetConfig{}, fmt.Errorf("PASSWORD_RESET_URL %q must be an absolute URL", cfg.url)
+		}
+	}
+	return cfg, nil
+}
+
+// The hash a reset token is stored and looked up under
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// The text of the email carrying a reset token
+func passwordResetEmail(cfg passwordResetConfig, token string) string {
+	how := "Use this token to choose a new password: " + token
+	if cfg.url != "" {
+		u, _ := url.Parse(cfg.url)
+		q := u.Query()
+		q.Set("token", token)
+		u.RawQuery = q.Encode()
+		how = "Follow this link to choose a new password: " + u.String()
+	}
+	return "Someone asked to reset the password of your account.\r\n\r\n" + how +
+		"\r\n\r\nIt expires in " + cfg.ttl.String() + ". If you didn't ask for this, ignore this email.\r\n"
+}
+
+type passwordResetRequest struct {
+	Email string `json:"email" normalize:"trim"`
+}
+
+// Email a password reset token to the account with the given address. The
+// answer is the same whether or not the account exists, so emails can't be probed.
+func requestPasswordReset(cfg passwordResetConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req passwordResetRequest
+		if !bindJSON(c, &req) {
+			return
+		}
+		if err := validateEmail(req.Email); err != nil {
+			respondFieldError(c, "email", err.Error())
+			return
+		}
+		user, err := users.GetByEmail(req.Email)
+		if err != nil && !errors.Is(err, errNotFound) {
+			respondStoreError(c, err, "User not found")
+			return
+		}
+		if err == nil && user.DeletedAt == nil {
+			token := hex.EncodeToString(mustRandomBytes(32))
+			err := passwordResets.Create(passwordReset{
+				TokenHash: hashResetToken(token),
+				UserID:    user.ID,
+				ExpiresAt: time.Now().Add(cfg.ttl),
+			})
+			if err != nil {
+				respondStoreError(c, err, "User not found")
+				return
+			}
+			sendEmail(user.Email, "Reset your password", passwordResetEmail(cfg, token))
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "If the account exists, a password reset email is on its way"})
+	}
+}
+
+type passwordResetConfirmRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password" binding:"password"`
+}
+
+// Set a new password with a reset token, which can only be used once
+func confirmPasswordReset(c *gin.Context) {
+	var req passwordResetConfirmRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	reset, err := passwordResets.Consume(hashResetToken(req.Token))
+	if errors.Is(err, errNotFound) {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	user, err := users.GetByID(reset.UserID)
+	if err == nil && user.DeletedAt != nil {
+		err = errNotFound
+	}
+	if errors.Is(err, errNotFound) {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	updated := user
+	if err := setPassword(&updated, req.Password); err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to hash password")
+		return
+	}
+	updated, err = users.Update(user.ID, updated)
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	// A locked-out user who just proved they own the email may sign in again
+	if err := loginAttempts.reset(user.Email); err != nil {
+		log.Printf("Failed to forget failed logins: %v", err)
+	}
+	recordAudit(c, AuditUpdate, AuditResourceUser, user.ID, user, updated, "password")
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated"})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Store a reset of the user's password under token
+func startPasswordReset(t *testing.T, user User, token string) {
+	t.Helper()
+	err := passwordResets.Create(passwordReset{
+		TokenHash: hashResetToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Sign a token of the given type for the user, issued an hour ago
+func issuedEarlier(t *testing.T, user User, typ string) string {
+	t.Helper()
+	claims := tokenClaims{
+		Type: typ,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "earlier-" + typ,
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestPasswordResetRequiresAPassword(t *testing.T) {
+	srv := newTestServer(t)
+	user, _ := srv.signup("Ada", "ada@example.com")
+	startPasswordReset(t, user, "reset token")
+
+	status, data := srv.do(http.MethodPost, "/v1/password-reset/confirm", "", gin.H{"token": "reset token", "password": ""})
+	if status != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400; body %s", status, data)
+	}
+	if refused := responseError(t, data); refused.Code != codeValidationFailed || refused.Fields["password"] == "" {
+		t.Errorf("error = %+v, want a validation error on password", refused)
+	}
+	// The refused request didn't use the token up
+	srv.expect(http.StatusOK, http.MethodPost, "/v1/password-reset/confirm", "",
+		gin.H{"token": "reset token", "password": "a new password"}, nil)
+}
+
+func TestPasswordResetRefusesEarlierTokens(t *testing.T) {
+	srv := newTestServer(t)
+	user, _ := srv.signup("Ada", "ada@example.com")
+	access := issuedEarlier(t, user, tokenTypeAccess)
+	refreshToken := issuedEarlier(t, user, tokenTypeRefresh)
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks", access, nil, nil)
+
+	startPasswordReset(t, user, "reset token")
+	srv.expect(http.StatusOK, http.MethodPost, "/v1/password-reset/confirm", "",
+		gin.H{"token": "reset token", "password": "a new password"}, nil)
+
+	const refused = "Unauthorized: token issued before the password changed"
+	status, body := srv.do(http.MethodGet, "/v1/tasks", access, nil)
+	if status != http.StatusUnauthorized || responseError(t, body).Message != refused {
+		t.Errorf("earlier access token: status = %d, body %s; want 401 %q", status, body, refused)
+	}
+	status, body = srv.do(http.MethodPost, "/v1/refresh", "", gin.H{"refresh_token": refreshToken})
+	if status != http.StatusUnauthorized || responseError(t, body).Message != refused {
+		t.Errorf("earlier refresh token: status = %d, body %s; want 401 %q", status, body, refused)
+	}
+
+	// Tokens issued after the reset work
+	var login struct {
+		Token string `json:"token"`
+	}
+	srv.expect(http.StatusOK, http.MethodPost, "/v1/login", "",
+		gin.H{"email": "ada@example.com", "password": "a new password"}, &login)
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks", login.Token, nil, nil)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware that indents the JSON of GET responses when ?pretty=true, for
+// reading them in a terminal or browser while debugging
+func prettyJSONMiddleware(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.Next()
+		return
+	}
+	pretty, ok := boolParam(c, "pretty")
+	if !ok {
+		c.Abort()
+		return
+	}
+	if !pretty {
+		c.Next()
+		return
+	}
+	w := &prettyWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+	w.finish()
+}
+
+// prettyWriter buffers the body so it can be re-indented once complete
+type prettyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+	// streaming is set once the handler flushes; the body then passes through untouched
+	streaming bool
+}
+
+func (w *prettyWriter) Write(b []byte) (int, error) {
+	if w.streaming {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *prettyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *prettyWriter) Flush() {
+	if !w.streaming {
+		w.streaming = true
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *prettyWriter) finish() {
+	if w.streaming || w.body.Len() == 0 {
+		return
+	}
+	body := w.body.Bytes()
+	contentType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	var out bytes.Buffer
+	if contentType == "application/json" && json.Indent(&out, body, "", "  ") == nil {
+		out.WriteByte('\n')
+		body = out.Bytes()
+	}
+	w.ResponseWriter.Write(body)
+}
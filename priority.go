@@ -0,0 +1,32 @@
+package main
+
+import "strings"
+
+// Task priorities
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+// Every priority, from least to most pressing
+var validPriorities = []string{PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+
+// Sort weight of each priority; higher comes first
+var priorityRank = map[string]int{
+	PriorityLow:    0,
+	PriorityMedium: 1,
+	PriorityHigh:   2,
+	PriorityUrgent: 3,
+}
+
+func isValidPriority(priority string) bool {
+	_, ok := priorityRank[priority]
+	return ok
+}
+
+// Error message shared by handlers that reject a priority
+func invalidPriorityMessage(priority string) string {
+	return "Invalid priority \"" + priority + "\": must be one of " + strings.Join(validPriorities, ", ")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tasks a user may own when TASK_QUOTA is not set and they have no quota of their own
+const defaultTaskQuota = 1000
+
+// Quota of users without one of their own, set from the config in main
+var taskQuota = defaultTaskQuota
+
+// Read TASK_QUOTA
+func taskQuotaSetting() (int, error) {
+	v := os.Getenv("TASK_QUOTA")
+	if v == "" {
+		return defaultTaskQuota, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("TASK_QUOTA %q must be a non-negative integer", v)
+	}
+	return n, nil
+}
+
+// The most non-deleted tasks the user may own
+func quotaFor(user *User) int {
+	if user.TaskQuota != nil {
+		return *user.TaskQuota
+	}
+	return taskQuota
+}
+
+// How many more tasks the user may create before reaching their quota
+func remainingTaskQuota(ctx context.Context, user *User) (int, error) {
+	owned, err := liveTasksOf(ctx, user.ID)
+	if err != nil {
+		return 0, err
+	}
+	if remaining := quotaFor(user) - len(owned); remaining > 0 {
+		return remaining, nil
+	}
+	return 0, nil
+}
+
+// Check that the caller may create n more tasks.
+// On failure the error response has already been written.
+func checkTaskQuota(c *gin.Context, n int) bool {
+	user := currentUser(c)
+	remaining, err := remainingTaskQuota(c.Request.Context(), user)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return false
+	}
+	if n > remaining {
+		writeError(c, http.StatusForbidden, quotaExceeded(user, remaining))
+		return false
+	}
+	return true
+}
+
+// The error for a user who has no room for the tasks they asked for
+func quotaExceeded(user *User, remaining int) apiError {
+	return apiError{
+		Code:    codeQuotaExceeded,
+		Message: fmt.Sprintf("Task quota of %d reached; delete tasks to make room", quotaFor(user)),
+		Details: gin.H{"quota": quotaFor(user), "remaining": remaining},
+	}
+}
+
+// Completing a recurring task creates its next occurrence, which counts
+// against the quota like any other task. The quota is the owner's, whoever
+// completes the task, and a completion that leaves them no room for the next
+// occurrence is refused before anything is saved. Returns the error to
+// report for a full quota, or nil when there is room or nothing to create.
+func occurrenceQuotaProblem(ctx context.Context, from string, task Task) (*apiError, error) {
+	if !spawnsOccurrence(from, task) {
+		return nil, nil
+	}
+	owner, err := users.GetByID(task.UserID)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := remainingTaskQuota(ctx, &owner)
+	if err != nil {
+		return nil, err
+	}
+	if remaining < 1 {
+		problem := quotaExceeded(&owner, remaining)
+		return &problem, nil
+	}
+	return nil, nil
+}
+
+// Refuse with 403 to complete a recurring task whose owner has no room for
+// its next occurrence. On failure the error response has already been written.
+func checkOccurrenceQuota(c *gin.Context, from string, task Task) bool {
+	problem, err := occurrenceQuotaProblem(c.Request.Context(), from, task)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return false
+	}
+	if problem != nil {
+		writeError(c, http.StatusForbidden, *problem)
+		return false
+	}
+	return true
+}
+
+type quotaRequest struct {
+	// TaskQuota is null to fall back to the default
+	TaskQuota *int `json:"task_quota"`
+}
+
+// Set or clear a user's own task quota; admin only
+func updateUserQuota(c *gin.Context) {
+	user, ok := loadUser(c, false)
+	if !ok {
+		return
+	}
+	var req quotaRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.TaskQuota != nil && *req.TaskQuota < 0 {
+		respondFieldError(c, "task_quota", "must not be negative")
+		return
+	}
+	updated := user
+	updated.TaskQuota = req.TaskQuota
+	updated, err := users.Update(user.ID, updated)
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	recordAudit(c, AuditUpdate, AuditResourceUser, user.ID, user, updated)
+	c.JSON(http.StatusOK, updated)
+}
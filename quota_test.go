@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Fail the test unless the response is a 403 for a full quota
+func expectQuotaExceeded(t *testing.T, what string, status int, body []byte) {
+	t.Helper()
+	if status != http.StatusForbidden || responseError(t, body).Code != codeQuotaExceeded {
+		t.Fatalf("%s: status = %d, body %s; want 403 QUOTA_EXCEEDED", what, status, body)
+	}
+}
+
+func TestTaskQuotaCapsCreates(t *testing.T) {
+	srv := newTestServer(t, "TASK_QUOTA", "3")
+	_, token := srv.signup("Ada", "ada@example.com")
+
+	var created []Task
+	for i := 1; i <= 3; i++ {
+		created = append(created, srv.createTask(token, gin.H{"title": fmt.Sprintf("Task %d", i)}))
+	}
+	status, body := srv.do(http.MethodPost, "/v1/tasks", token, gin.H{"title": "One too many"})
+	expectQuotaExceeded(t, "create past the quota", status, body)
+
+	// Deleted tasks don't count
+	srv.expect(http.StatusOK, http.MethodDelete, "/v1/tasks/"+created[0].ID, token, nil, nil)
+	srv.createTask(token, gin.H{"title": "Fits again"})
+}
+
+func TestTaskQuotaCanBeSetPerUser(t *testing.T) {
+	srv := newTestServer(t, "TASK_QUOTA", "3", "ADMIN_EMAILS", "admin@example.com")
+	_, adminToken := srv.signup("Admin", "admin@example.com")
+	ada, token := srv.signup("Ada", "ada@example.com")
+
+	srv.expect(http.StatusOK, http.MethodPut, "/v1/users/"+ada.ID+"/quota", adminToken, gin.H{"task_quota": 1}, nil)
+	srv.createTask(token, gin.H{"title": "Only task"})
+	status, body := srv.do(http.MethodPost, "/v1/tasks", token, gin.H{"title": "Second task"})
+	expectQuotaExceeded(t, "create past the user's quota", status, body)
+}
+
+func TestCompletingARecurringTaskNeedsRoomForTheNextOccurrence(t *testing.T) {
+	srv := newTestServer(t, "TASK_QUOTA", "2")
+	_, token := srv.signup("Ada", "ada@example.com")
+	due := time.Now().Add(24 * time.Hour)
+	recurring := srv.createTask(token, gin.H{"title": "Water the plants", "recurrence": RecurrenceDaily, "due_date": due})
+	other := srv.createTask(token, gin.H{"title": "Other"})
+	path := "/v1/tasks/" + recurring.ID
+
+	status, body := srv.do(http.MethodPatch, path, token, gin.H{"status": StatusDone})
+	expectQuotaExceeded(t, "completing with a full quota", status, body)
+	var stored Task
+	srv.expect(http.StatusOK, http.MethodGet, path, token, nil, &stored)
+	if stored.Status != StatusTodo {
+		t.Errorf("refused completion left the task %s, want it still todo", stored.Status)
+	}
+
+	srv.expect(http.StatusOK, http.MethodDelete, "/v1/tasks/"+other.ID, token, nil, nil)
+	var completed completedTask
+	srv.expect(http.StatusOK, http.MethodPatch, path, token, gin.H{"status": StatusDone}, &completed)
+	if completed.NextTask == nil {
+		t.Fatal("completing with room in the quota created no next occurrence")
+	}
+	status, body = srv.do(http.MethodPost, "/v1/tasks", token, gin.H{"title": "One too many"})
+	expectQuotaExceeded(t, "create after the next occurrence filled the quota", status, body)
+}
+
+func TestQuotaErrorsReadTheSameEverywhere(t *testing.T) {
+	srv := newTestServer(t, "TASK_QUOTA", "1")
+	_, token := srv.signup("Ada", "ada@example.com")
+	srv.createTask(token, gin.H{"title": "Only task"})
+
+	status, body := srv.do(http.MethodPost, "/v1/tasks", token, gin.H{"title": "One too many"})
+	expectQuotaExceeded(t, "REST create", status, body)
+	want := responseError(t, body).Message
+
+	errs := srv.graphql(token, graphqlCreateTask, gin.H{"input": gin.H{"title": "One too many"}}, nil)
+	expectGraphQLError(t, "GraphQL create", errs, codeQuotaExceeded)
+	if len(errs) == 1 && errs[0].Message != want {
+		t.Errorf("GraphQL message = %q, want %q", errs[0].Message, want)
+	}
+}
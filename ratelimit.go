@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// Requests per minute allowed when RATE_LIMIT_PER_MINUTE is not set
+const defaultRateLimit = 60
+
+// Buckets idle for this long are dropped so the map doesn't grow forever
+const limiterIdleTTL = 10 * time.Minute
+
+// Read RATE_LIMIT_PER_MINUTE
+func rateLimitPerMinute() (int, error) {
+	v := os.Getenv("RATE_LIMIT_PER_MINUTE")
+	if v == "" {
+		return defaultRateLimit, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("RATE_LIMIT_PER_MINUTE %q must be a positive integer", v)
+	}
+	return n, nil
+}
+
+// rateLimiter hands out one token bucket per key
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Allow perMinute requests per key, refilled evenly, with bursts up to the same amount
+func newRateLimiter(perMinute int) *rateLimiter {
+	return &rateLimiter{
+		limit:     rate.Limit(float64(perMinute) / 60),
+		burst:     perMinute,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take a token for key, returning how long to wait when none is left
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > limiterIdleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > limiterIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// Middleware to rate limit requests by the key returned from keyFunc
+func rateLimitMiddleware(limiter *rateLimiter, keyFunc func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ok, retryAfter := limiter.allow(keyFunc(c))
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			respondError(c, http.StatusTooManyRequests, codeRateLimited, "Too many requests")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Key requests by the authenticated user, so it must run after authMiddleware
+func userRateKey(c *gin.Context) string {
+	if user := currentUser(c); user != nil {
+		return "user:" + user.ID
+	}
+	return ipRateKey(c)
+}
+
+// Key requests by client IP, for endpoints used before logging in
+func ipRateKey(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
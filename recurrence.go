@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How often a task repeats; RecurrenceNone means it doesn't
+const (
+	RecurrenceNone    = ""
+	RecurrenceDaily   = "daily"
+	RecurrenceWeekly  = "weekly"
+	RecurrenceMonthly = "monthly"
+)
+
+var validRecurrences = []string{RecurrenceDaily, RecurrenceWeekly, RecurrenceMonthly}
+
+func isValidRecurrence(recurrence string) bool {
+	if recurrence == RecurrenceNone {
+		return true
+	}
+	for _, r := range validRecurrences {
+		if r == recurrence {
+			return true
+		}
+	}
+	return false
+}
+
+// Error message shared by handlers that reject a recurrence
+func invalidRecurrenceMessage(recurrence string) string {
+	return "Invalid recurrence \"" + recurrence + "\": must be empty or one of " + strings.Join(validRecurrences, ", ")
+}
+
+// Advance t by one period of the recurrence
+func nextOccurrence(t time.Time, recurrence string) time.Time {
+	switch recurrence {
+	case RecurrenceDaily:
+		return t.AddDate(0, 0, 1)
+	case RecurrenceWeekly:
+		return t.AddDate(0, 0, 7)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+// A task response that also carries the next occurrence created by completing it
+type completedTask struct {
+	Task
+	NextTask *Task `json:"next_task,omitempty"`
+}
+
+// When a save moved a recurring task to done, create its next occurrence and
+// return it. On failure the error response has already been written.
+func spawnNextOccurrence(c *gin.Context, from string, task Task) (*Task, bool) {
+	next, err := createNextOccurrence(from, task)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return nil, false
+	}
+	return next, true
+}
+
+// Report whether saving a task that was in status from creates its next
+// occurrence, which it does when the save moves a recurring task to done
+func spawnsOccurrence(from string, task Task) bool {
+	return task.Recurrence != RecurrenceNone && task.Status == StatusDone && from != StatusDone
+}
+
+// Create the next occurrence of a recurring task that was just moved to done,
+// returning nil for any other save. The due date advances by at least one period,
+// and further until it is in the future, so a late completion doesn't leave the
+// next instance already overdue.
+func createNextOccurrence(from string, task Task) (*Task, error) {
+	if !spawnsOccurrence(from, task) {
+		return nil, nil
+	}
+	now := time.Now()
+	due := now
+	if task.DueDate != nil {
+		due = *task.DueDate
+	}
+	due = nextOccurrence(due, task.Recurrence)
+	for !due.After(now) {
+		due = nextOccurrence(due, task.Recurrence)
+	}
+	next, err := tasks.Create(Task{
+		UserID:      task.UserID,
+		Title:       task.Title,
+		Description: task.Description,
+		Status:      StatusTodo,
+		Priority:    task.Priority,
+		Color:       task.Color,
+		Tags:        task.Tags,
+		DueDate:     &due,
+		AssigneeID:  task.AssigneeID,
+		Recurrence:  task.Recurrence,
+		ParentID:    task.ParentID,
+		BlockedBy:   []string{},
+		// The next occurrence takes this one's place in the owner's order
+		Position: task.Position,
+		// Whoever completed this occurrence brought the next one about
+		CreatedBy: task.UpdatedBy,
+		UpdatedBy: task.UpdatedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// Write a saved task, creating and including its next occurrence if the save completed it.
+// Webhooks hear about both.
+func respondSavedTask(c *gin.Context, from string, task Task) {
+	notifyTaskEvent(EventTaskUpdated, task)
+	next, ok := spawnNextOccurrence(c, from, task)
+	if !ok {
+		return
+	}
+	if next != nil {
+		recordAudit(c, AuditCreate, AuditResourceTask, next.ID, nil, *next)
+		notifyTaskEvent(EventTaskCreated, *next)
+	}
+	respondCompletedTask(c, task, next)
+}
+
+// Write a saved task along with the next occurrence its save created, if any
+func respondCompletedTask(c *gin.Context, task Task, next *Task) {
+	setTaskValidators(c, task)
+	c.JSON(http.StatusOK, completedTask{Task: task, NextTask: next})
+}
@@ -0,0 +1,1105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The Redis stores let several API instances share all of their state,
+// revoked tokens and failed logins included. Each user and task is a hash
+// with a field per JSON field, holding that field's JSON. Sorted sets scored
+// by creation time index them in List order: every user, every task, and
+// each user's tasks, overall and per status. The other records are stored
+// as JSON, as laid out above each of their stores. Rate limits and event
+// streams still live in each instance, and attachment files in its
+// ATTACHMENT_DIR, which the instances must share.
+
+// Keys of the indexes
+const (
+	// redisUsers and redisTasks hold every ID, deleted ones included
+	redisUsers = "users"
+	redisTasks = "tasks"
+	// redisUserEmails maps the lowercased email of every user to their ID
+	redisUserEmails   = "users:emails"
+	redisDeletedUsers = "users:deleted"
+	redisDeletedTasks = "tasks:deleted"
+)
+
+func redisUserKey(id string) string { return "user:" + id }
+func redisTaskKey(id string) string { return "task:" + id }
+
+// The index of a user's tasks, or of those in one status when it isn't empty
+func redisUserTasksKey(userID, status string) string {
+	if status == "" {
+		return "user:" + userID + ":tasks"
+	}
+	return "user:" + userID + ":tasks:" + status
+}
+
+// How often a write is retried when another client changes its keys first
+const redisMaxAttempts = 5
+
+// Address of the Redis server when REDIS_ADDR is not set
+const defaultRedisAddr = "localhost:6379"
+
+type redisConfig struct {
+	addr     string
+	password string
+}
+
+// Read REDIS_ADDR, the host:port of the server STORAGE=redis uses, and the
+// optional REDIS_PASSWORD
+func redisSettings() (redisConfig, error) {
+	cfg := redisConfig{addr: os.Getenv("REDIS_ADDR"), password: os.Getenv("REDIS_PASSWORD")}
+	if cfg.addr == "" {
+		cfg.addr = defaultRedisAddr
+	}
+	if !strings.Contains(cfg.addr, ":") {
+		return redisConfig{}, fmt.Errorf("REDIS_ADDR %q must be a host:port", cfg.addr)
+	}
+	return cfg, nil
+}
+
+// Connect to Redis, checking that it answers
+func openRedis(cfg redisConfig) (*redis.Client, error) {
+	db := redis.NewClient(&redis.Options{Addr: cfg.addr, Password: cfg.password})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.Ping(ctx).Err(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Score of a record in the indexes. Microseconds are exact in a float64,
+// and records created in the same one are ordered by ID, as sqlite does.
+func redisScore(createdAt time.Time) float64 {
+	return float64(createdAt.UnixMicro())
+}
+
+// The hash fields of a record: its JSON fields, each holding its value's JSON
+func redisFields(record interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{}, len(raw))
+	for name, value := range raw {
+		fields[name] = string(value)
+	}
+	return fields, nil
+}
+
+// Decode the hash fields of a record; a missing record has none
+func redisDecode(fields map[string]string, record interface{}) error {
+	if len(fields) == 0 {
+		return errNotFound
+	}
+	raw := make(map[string]json.RawMessage, len(fields))
+	for name, value := range fields {
+		raw[name] = json.RawMessage(value)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, record)
+}
+
+// Run fn in a transaction watching keys, starting over when another client
+// changes them before it commits
+func redisWatch(db *redis.Client, fn func(tx *redis.Tx) error, keys ...string) error {
+	for attempt := 0; attempt < redisMaxAttempts; attempt++ {
+		err := db.Watch(context.Background(), fn, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("gave up writing %s after %d conflicting attempts", strings.Join(keys, ", "), redisMaxAttempts)
+}
+
+// Fetch the records with the given IDs, skipping any that are gone
+func redisGetMany[T any](ctx context.Context, db redis.Cmdable, key func(string) string, ids []string, decode func(map[string]string) (T, error)) ([]T, error) {
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	_, err := db.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, key(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]T, 0, len(ids))
+	for _, cmd := range cmds {
+		record, err := decode(cmd.Val())
+		if errors.Is(err, errNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, record)
+	}
+	return list, nil
+}
+
+// Count the IDs in an index that aren't in the matching deleted set
+func redisLiveCount(db *redis.Client, index, deleted string) (int, error) {
+	ctx := context.Background()
+	var all, gone *redis.IntCmd
+	_, err := db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		all = pipe.ZCard(ctx, index)
+		gone = pipe.SCard(ctx, deleted)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(all.Val() - gone.Val()), nil
+}
+
+// redisUserStore keeps users in Redis
+type redisUserStore struct {
+	db *redis.Client
+}
+
+func decodeUser(fields map[string]string) (User, error) {
+	var record userRecord
+	if err := redisDecode(fields, &record); err != nil {
+		return User{}, err
+	}
+	return record.toUser(), nil
+}
+
+func getRedisUser(db redis.Cmdable, id string) (User, error) {
+	fields, err := db.HGetAll(context.Background(), redisUserKey(id)).Result()
+	if err != nil {
+		return User{}, err
+	}
+	return decodeUser(fields)
+}
+
+func (s *redisUserStore) Create(user User) (User, error) {
+	ctx := context.Background()
+	now := time.Now()
+	user.ID = newID()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.DeletedAt = nil
+	fields, err := redisFields(newUserRecord(user))
+	if err != nil {
+		return User{}, err
+	}
+	email := strings.ToLower(user.Email)
+	claimed, err := s.db.HSetNX(ctx, redisUserEmails, email, user.ID).Result()
+	if err != nil {
+		return User{}, err
+	}
+	if !claimed {
+		return User{}, errEmailTaken
+	}
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisUserKey(user.ID), fields)
+		pipe.ZAdd(ctx, redisUsers, redis.Z{Score: redisScore(now), Member: user.ID})
+		return nil
+	})
+	if err != nil {
+		s.db.HDel(ctx, redisUserEmails, email)
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (s *redisUserStore) List(ctx context.Context) ([]User, error) {
+	ids, err := s.db.ZRange(ctx, redisUsers, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return redisGetMany(ctx, s.db, redisUserKey, ids, decodeUser)
+}
+
+func (s *redisUserStore) GetByID(id string) (User, error) {
+	return getRedisUser(s.db, id)
+}
+
+func (s *redisUserStore) GetByEmail(email string) (User, error) {
+	id, err := s.db.HGet(context.Background(), redisUserEmails, strings.ToLower(email)).Result()
+	if errors.Is(err, redis.Nil) {
+		return User{}, errNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return getRedisUser(s.db, id)
+}
+
+func (s *redisUserStore) Update(id string, user User) (User, error) {
+	ctx := context.Background()
+	err := redisWatch(s.db, func(tx *redis.Tx) error {
+		current, err := getRedisUser(tx, id)
+		if err != nil {
+			return err
+		}
+		email, previousEmail := strings.ToLower(user.Email), strings.ToLower(current.Email)
+		if email != previousEmail {
+			owner, err := tx.HGet(ctx, redisUserEmails, email).Result()
+			if err == nil && owner != id {
+				return errEmailTaken
+			}
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+		}
+		user.ID = id
+		user.CreatedAt = current.CreatedAt
+		user.UpdatedAt = time.Now()
+		user.DeletedAt = current.DeletedAt
+		fields, err := redisFields(newUserRecord(user))
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if email != previousEmail {
+				pipe.HDel(ctx, redisUserEmails, previousEmail)
+				pipe.HSet(ctx, redisUserEmails, email, id)
+			}
+			pipe.Del(ctx, redisUserKey(id))
+			pipe.HSet(ctx, redisUserKey(id), fields)
+			return nil
+		})
+		return err
+	}, redisUserKey(id), redisUserEmails)
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (s *redisUserStore) Delete(id string) error {
+	ctx := context.Background()
+	return redisWatch(s.db, func(tx *redis.Tx) error {
+		user, err := getRedisUser(tx, id)
+		if err != nil {
+			return err
+		}
+		if user.DeletedAt != nil {
+			return errNotFound
+		}
+		deletedAt, err := json.Marshal(time.Now())
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, redisUserKey(id), "deleted_at", string(deletedAt))
+			pipe.SAdd(ctx, redisDeletedUsers, id)
+			return nil
+		})
+		return err
+	}, redisUserKey(id))
+}
+
+func (s *redisUserStore) Count() (int, error) {
+	return redisLiveCount(s.db, redisUsers, redisDeletedUsers)
+}
+
+// redisTaskStore keeps tasks in Redis
+type redisTaskStore struct {
+	db *redis.Client
+}
+
+func decodeTask(fields map[string]string) (Task, error) {
+	var task Task
+	err := redisDecode(fields, &task)
+	return task, err
+}
+
+func getRedisTask(db redis.Cmdable, id string) (Task, error) {
+	fields, err := db.HGetAll(context.Background(), redisTaskKey(id)).Result()
+	if err != nil {
+		return Task{}, err
+	}
+	return decodeTask(fields)
+}
+
+// Queue the writes of a new task
+func (s *redisTaskStore) insert(pipe redis.Pipeliner, task Task) error {
+	ctx := context.Background()
+	fields, err := redisFields(task)
+	if err != nil {
+		return err
+	}
+	member := redis.Z{Score: redisScore(task.CreatedAt), Member: task.ID}
+	pipe.HSet(ctx, redisTaskKey(task.ID), fields)
+	pipe.ZAdd(ctx, redisTasks, member)
+	pipe.ZAdd(ctx, redisUserTasksKey(task.UserID, ""), member)
+	pipe.ZAdd(ctx, redisUserTasksKey(task.UserID, task.Status), member)
+	return nil
+}
+
+func (s *redisTaskStore) Create(task Task) (Task, error) {
+	created, err := s.CreateMany([]Task{task})
+	if err != nil {
+		return Task{}, err
+	}
+	return created[0], nil
+}
+
+func (s *redisTaskStore) CreateMany(tasks []Task) ([]Task, error) {
+	now := time.Now()
+	created := make([]Task, len(tasks))
+	_, err := s.db.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for i, task := range tasks {
+			task.ID = newID()
+			task.Version = 1
+			task.CreatedAt = now
+			task.UpdatedAt = now
+			task.DeletedAt = nil
+			if err := s.insert(pipe, task); err != nil {
+				return err
+			}
+			created[i] = task
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *redisTaskStore) List(ctx context.Context) ([]Task, error) {
+	return s.listIndex(ctx, redisTasks)
+}
+
+func (s *redisTaskStore) ListByUser(ctx context.Context, userID, status string) ([]Task, error) {
+	return s.listIndex(ctx, redisUserTasksKey(userID, status))
+}
+
+func (s *redisTaskStore) listIndex(ctx context.Context, key string) ([]Task, error) {
+	ids, err := s.db.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return redisGetMany(ctx, s.db, redisTaskKey, ids, decodeTask)
+}
+
+func (s *redisTaskStore) GetByID(id string) (Task, error) {
+	return getRedisTask(s.db, id)
+}
+
+func (s *redisTaskStore) Update(id string, task Task) (Task, error) {
+	task.ID = id
+	updated, err := s.UpdateMany([]Task{task})
+	if err != nil {
+		return Task{}, err
+	}
+	return updated[0], nil
+}
+
+func (s *redisTaskStore) UpdateMany(tasks []Task) ([]Task, error) {
+	ctx := context.Background()
+	keys := make([]string, len(tasks))
+	for i, task := range tasks {
+		keys[i] = redisTaskKey(task.ID)
+	}
+	updated := make([]Task, len(tasks))
+	err := redisWatch(s.db, func(tx *redis.Tx) error {
+		now := time.Now()
+		currents := make([]Task, len(tasks))
+		for i, task := range tasks {
+			current, err := getRedisTask(tx, task.ID)
+			if err != nil {
+				return err
+			}
+			if task.Version != current.Version {
+				return errVersionConflict
+			}
+			task.Version = current.Version + 1
+			task.CreatedAt = current.CreatedAt
+			task.UpdatedAt = now
+			task.DeletedAt = current.DeletedAt
+			currents[i], updated[i] = current, task
+		}
+		_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, task := range updated {
+				fields, err := redisFields(task)
+				if err != nil {
+					return err
+				}
+				current := currents[i]
+				pipe.Del(ctx, redisTaskKey(task.ID))
+				pipe.HSet(ctx, redisTaskKey(task.ID), fields)
+				if task.UserID != current.UserID || task.Status != current.Status {
+					member := redis.Z{Score: redisScore(task.CreatedAt), Member: task.ID}
+					pipe.ZRem(ctx, redisUserTasksKey(current.UserID, ""), task.ID)
+					pipe.ZRem(ctx, redisUserTasksKey(current.UserID, current.Status), task.ID)
+					pipe.ZAdd(ctx, redisUserTasksKey(task.UserID, ""), member)
+					pipe.ZAdd(ctx, redisUserTasksKey(task.UserID, task.Status), member)
+				}
+			}
+			return nil
+		})
+		return err
+	}, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (s *redisTaskStore) Delete(id string) error {
+	ctx := context.Background()
+	return redisWatch(s.db, func(tx *redis.Tx) error {
+		task, err := getRedisTask(tx, id)
+		if err != nil {
+			return err
+		}
+		if task.DeletedAt != nil {
+			return errNotFound
+		}
+		deletedAt, err := json.Marshal(time.Now())
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, redisTaskKey(id), "deleted_at", string(deletedAt))
+			pipe.SAdd(ctx, redisDeletedTasks, id)
+			return nil
+		})
+		return err
+	}, redisTaskKey(id))
+}
+
+func (s *redisTaskStore) Restore(id string) (Task, error) {
+	ctx := context.Background()
+	var task Task
+	err := redisWatch(s.db, func(tx *redis.Tx) error {
+		var err error
+		task, err = getRedisTask(tx, id)
+		if err != nil {
+			return err
+		}
+		if task.DeletedAt == nil {
+			return errNotFound
+		}
+		task.DeletedAt = nil
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, redisTaskKey(id), "deleted_at")
+			pipe.SRem(ctx, redisDeletedTasks, id)
+			return nil
+		})
+		return err
+	}, redisTaskKey(id))
+	if err != nil {
+		return Task{}, err
+	}
+	return task, nil
+}
+
+func (s *redisTaskStore) Count() (int, error) {
+	return redisLiveCount(s.db, redisTasks, redisDeletedTasks)
+}
+
+// Keys of the records kept per task, each a list of the task's records as
+// JSON, oldest first, and of the counters handing out their IDs
+func redisTaskCommentsKey(taskID string) string    { return "task:" + taskID + ":comments" }
+func redisTaskHistoryKey(taskID string) string     { return "task:" + taskID + ":history" }
+func redisTaskTimeEntriesKey(taskID string) string { return "task:" + taskID + ":time_entries" }
+
+const (
+	redisCommentIDs   = "comments:last_id"
+	redisHistoryIDs   = "history:last_id"
+	redisTimeEntryIDs = "time_entries:last_id"
+)
+
+// Append a record to a list as JSON
+func redisAppend(db redis.Cmdable, key string, record interface{}) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return db.RPush(context.Background(), key, b).Err()
+}
+
+// Decode the JSON records of a list
+func redisList[T any](ctx context.Context, db redis.Cmdable, key string) ([]T, error) {
+	values, err := db.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]T, len(values))
+	for i, value := range values {
+		if err := json.Unmarshal([]byte(value), &list[i]); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// Fetch the JSON records with the given IDs from the hash at key, skipping
+// any that are gone
+func redisGetJSON[T any](ctx context.Context, db redis.Cmdable, key string, ids []string) ([]T, error) {
+	list := make([]T, 0, len(ids))
+	if len(ids) == 0 {
+		return list, nil
+	}
+	values, err := db.HMGet(ctx, key, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var record T
+		if err := json.Unmarshal([]byte(s), &record); err != nil {
+			return nil, err
+		}
+		list = append(list, record)
+	}
+	return list, nil
+}
+
+// Fetch and decode the JSON record at key, or the field of the hash at key
+// when field isn't empty
+func redisGetOne(db redis.Cmdable, key, field string, record interface{}) error {
+	ctx := context.Background()
+	var cmd *redis.StringCmd
+	if field == "" {
+		cmd = db.Get(ctx, key)
+	} else {
+		cmd = db.HGet(ctx, key, field)
+	}
+	value, err := cmd.Result()
+	if errors.Is(err, redis.Nil) {
+		return errNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(value), record)
+}
+
+// redisCommentStore keeps comments in Redis
+type redisCommentStore struct {
+	db *redis.Client
+}
+
+func (s *redisCommentStore) Create(comment Comment) (Comment, error) {
+	id, err := s.db.Incr(context.Background(), redisCommentIDs).Result()
+	if err != nil {
+		return Comment{}, err
+	}
+	comment.ID = uint(id)
+	comment.CreatedAt = time.Now()
+	if err := redisAppend(s.db, redisTaskCommentsKey(comment.TaskID), comment); err != nil {
+		return Comment{}, err
+	}
+	return comment, nil
+}
+
+func (s *redisCommentStore) ListByTask(taskID string) ([]Comment, error) {
+	return redisList[Comment](context.Background(), s.db, redisTaskCommentsKey(taskID))
+}
+
+// redisHistoryStore keeps status changes in Redis
+type redisHistoryStore struct {
+	db *redis.Client
+}
+
+func (s *redisHistoryStore) Create(change StatusChange) (StatusChange, error) {
+	id, err := s.db.Incr(context.Background(), redisHistoryIDs).Result()
+	if err != nil {
+		return StatusChange{}, err
+	}
+	change.ID = uint(id)
+	change.ChangedAt = time.Now()
+	if err := redisAppend(s.db, redisTaskHistoryKey(change.TaskID), change); err != nil {
+		return StatusChange{}, err
+	}
+	return change, nil
+}
+
+func (s *redisHistoryStore) ListByTask(taskID string) ([]StatusChange, error) {
+	return redisList[StatusChange](context.Background(), s.db, redisTaskHistoryKey(taskID))
+}
+
+// redisTimeEntryStore keeps time entries in Redis. Only the latest entry of
+// a task can be running, since Start refuses to add one while it is.
+type redisTimeEntryStore struct {
+	db *redis.Client
+}
+
+// The latest entry in the list at key
+func lastRedisTimeEntry(db redis.Cmdable, key string) (TimeEntry, error) {
+	value, err := db.LIndex(context.Background(), key, -1).Result()
+	if errors.Is(err, redis.Nil) {
+		return TimeEntry{}, errNotFound
+	}
+	if err != nil {
+		return TimeEntry{}, err
+	}
+	var entry TimeEntry
+	err = json.Unmarshal([]byte(value), &entry)
+	return entry, err
+}
+
+func (s *redisTimeEntryStore) Start(entry TimeEntry) (TimeEntry, error) {
+	ctx := context.Background()
+	key := redisTaskTimeEntriesKey(entry.TaskID)
+	err := redisWatch(s.db, func(tx *redis.Tx) error {
+		last, err := lastRedisTimeEntry(tx, key)
+		if err == nil && last.StoppedAt == nil {
+			return errTimerRunning
+		}
+		if err != nil && !errors.Is(err, errNotFound) {
+			return err
+		}
+		id, err := tx.Incr(ctx, redisTimeEntryIDs).Result()
+		if err != nil {
+			return err
+		}
+		entry.ID = uint(id)
+		entry.StartedAt = time.Now()
+		entry.StoppedAt = nil
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.RPush(ctx, key, b)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return TimeEntry{}, err
+	}
+	return entry, nil
+}
+
+func (s *redisTimeEntryStore) Stop(taskID string) (TimeEntry, error) {
+	ctx := context.Background()
+	key := redisTaskTimeEntriesKey(taskID)
+	var entry TimeEntry
+	err := redisWatch(s.db, func(tx *redis.Tx) error {
+		var err error
+		entry, err = lastRedisTimeEntry(tx, key)
+		if errors.Is(err, errNotFound) || (err == nil && entry.StoppedAt != nil) {
+			return errTimerNotRunning
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		entry.StoppedAt = &now
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.LSet(ctx, key, -1, b)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return TimeEntry{}, err
+	}
+	return entry, nil
+}
+
+func (s *redisTimeEntryStore) ListByTask(taskID string) ([]TimeEntry, error) {
+	return redisList[TimeEntry](context.Background(), s.db, redisTaskTimeEntriesKey(taskID))
+}
+
+// Attachments and webhooks are JSON in a hash keyed by ID, with a list of
+// the IDs of each task's attachments and each user's webhooks, oldest first
+const (
+	redisAttachments = "attachments"
+	redisWebhooks    = "webhooks"
+)
+
+func redisTaskAttachmentsKey(taskID string) string { return "task:" + taskID + ":attachments" }
+func redisUserWebhooksKey(userID string) string    { return "user:" + userID + ":webhooks" }
+
+// redisAttachmentStore keeps attachment metadata in Redis; the files
+// themselves stay in the attachments directory
+type redisAttachmentStore struct {
+	db *redis.Client
+}
+
+func (s *redisAttachmentStore) Create(a Attachment) (Attachment, error) {
+	ctx := context.Background()
+	a.CreatedAt = time.Now()
+	b, err := json.Marshal(a)
+	if err != nil {
+		return Attachment{}, err
+	}
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisAttachments, a.ID, b)
+		pipe.RPush(ctx, redisTaskAttachmentsKey(a.TaskID), a.ID)
+		return nil
+	})
+	if err != nil {
+		return Attachment{}, err
+	}
+	return a, nil
+}
+
+func (s *redisAttachmentStore) ListByTask(taskID string) ([]Attachment, error) {
+	ctx := context.Background()
+	ids, err := s.db.LRange(ctx, redisTaskAttachmentsKey(taskID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return redisGetJSON[Attachment](ctx, s.db, redisAttachments, ids)
+}
+
+func (s *redisAttachmentStore) GetByID(id string) (Attachment, error) {
+	var a Attachment
+	if err := redisGetOne(s.db, redisAttachments, id, &a); err != nil {
+		return Attachment{}, err
+	}
+	return a, nil
+}
+
+// redisWebhookStore keeps webhooks in Redis
+type redisWebhookStore struct {
+	db *redis.Client
+}
+
+func (s *redisWebhookStore) Create(hook Webhook) (Webhook, error) {
+	ctx := context.Background()
+	hook.ID = newID()
+	hook.CreatedAt = time.Now()
+	b, err := json.Marshal(hook)
+	if err != nil {
+		return Webhook{}, err
+	}
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisWebhooks, hook.ID, b)
+		pipe.RPush(ctx, redisUserWebhooksKey(hook.UserID), hook.ID)
+		return nil
+	})
+	if err != nil {
+		return Webhook{}, err
+	}
+	return hook, nil
+}
+
+func (s *redisWebhookStore) ListByUser(userID string) ([]Webhook, error) {
+	ctx := context.Background()
+	ids, err := s.db.LRange(ctx, redisUserWebhooksKey(userID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return redisGetJSON[Webhook](ctx, s.db, redisWebhooks, ids)
+}
+
+func (s *redisWebhookStore) GetByID(id string) (Webhook, error) {
+	var hook Webhook
+	if err := redisGetOne(s.db, redisWebhooks, id, &hook); err != nil {
+		return Webhook{}, err
+	}
+	return hook, nil
+}
+
+func (s *redisWebhookStore) Delete(id string) error {
+	ctx := context.Background()
+	hook, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+	var deleted *redis.IntCmd
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		deleted = pipe.HDel(ctx, redisWebhooks, id)
+		pipe.LRem(ctx, redisUserWebhooksKey(hook.UserID), 0, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if deleted.Val() == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// The audit log: every entry as JSON in a hash keyed by ID, and lists of IDs
+// in the order they were recorded, of every entry and of those about each
+// resource and by each actor, so List reads the narrowest one its filter allows
+const (
+	redisAuditEntries = "audit:entries"
+	redisAudit        = "audit"
+	redisAuditIDs     = "audit:last_id"
+)
+
+func redisAuditResourceKey(resourceType, id string) string {
+	return "audit:resource:" + resourceType + ":" + id
+}
+func redisAuditActorKey(actorID string) string { return "audit:actor:" + actorID }
+
+// redisAuditStore keeps the audit log in Redis
+type redisAuditStore struct {
+	db *redis.Client
+}
+
+func (s *redisAuditStore) Create(entry AuditEntry) (AuditEntry, error) {
+	ctx := context.Background()
+	id, err := s.db.Incr(ctx, redisAuditIDs).Result()
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	entry.ID = uint(id)
+	entry.CreatedAt = time.Now()
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	member := strconv.FormatInt(id, 10)
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, redisAuditEntries, member, b)
+		pipe.RPush(ctx, redisAudit, member)
+		pipe.RPush(ctx, redisAuditResourceKey(entry.ResourceType, entry.ResourceID), member)
+		if entry.ActorID != nil {
+			pipe.RPush(ctx, redisAuditActorKey(*entry.ActorID), member)
+		}
+		return nil
+	})
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	return entry, nil
+}
+
+func (s *redisAuditStore) List(ctx context.Context, filter auditFilter) ([]AuditEntry, error) {
+	index := redisAudit
+	switch {
+	case filter.ResourceType != "" && filter.ResourceID != "":
+		index = redisAuditResourceKey(filter.ResourceType, filter.ResourceID)
+	case filter.ActorID != "":
+		index = redisAuditActorKey(filter.ActorID)
+	}
+	ids, err := s.db.LRange(ctx, index, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := redisGetJSON[AuditEntry](ctx, s.db, redisAuditEntries, ids)
+	if err != nil {
+		return nil, err
+	}
+	list := []AuditEntry{}
+	for _, entry := range entries {
+		if filter.matches(entry) {
+			list = append(list, entry)
+		}
+	}
+	return list, nil
+}
+
+// Records that lapse by themselves are plain keys set to expire with them:
+// password resets, each with a key naming the user's pending one so a new
+// reset replaces it, idempotency records, revoked tokens, and sorted sets of
+// each email's failed logins scored by their time
+func redisPasswordResetKey(tokenHash string) string { return "password_reset:" + tokenHash }
+func redisUserPasswordResetKey(userID string) string {
+	return "user:" + userID + ":password_reset"
+}
+func redisIdempotencyKey(userID, key string) string { return "idempotency:" + userID + ":" + key }
+func redisIdempotencyLockKey(userID, key string) string {
+	return "idempotency_lock:" + userID + ":" + key
+}
+func redisRevokedKey(id string) string        { return "revoked:" + id }
+func redisLoginFailuresKey(key string) string { return "login_failures:" + key }
+
+// redisPasswordResetStore keeps pending password resets in Redis
+type redisPasswordResetStore struct {
+	db *redis.Client
+}
+
+func (s *redisPasswordResetStore) Create(reset passwordReset) error {
+	ctx := context.Background()
+	ttl := time.Until(reset.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	b, err := json.Marshal(reset)
+	if err != nil {
+		return err
+	}
+	userKey := redisUserPasswordResetKey(reset.UserID)
+	previous, err := s.db.Get(ctx, userKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	_, err = s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if previous != "" {
+			pipe.Del(ctx, redisPasswordResetKey(previous))
+		}
+		pipe.Set(ctx, redisPasswordResetKey(reset.TokenHash), b, ttl)
+		pipe.Set(ctx, userKey, reset.TokenHash, ttl)
+		return nil
+	})
+	return err
+}
+
+func (s *redisPasswordResetStore) Consume(tokenHash string) (passwordReset, error) {
+	value, err := s.db.GetDel(context.Background(), redisPasswordResetKey(tokenHash)).Result()
+	if errors.Is(err, redis.Nil) {
+		return passwordReset{}, errNotFound
+	}
+	if err != nil {
+		return passwordReset{}, err
+	}
+	var reset passwordReset
+	if err := json.Unmarshal([]byte(value), &reset); err != nil {
+		return passwordReset{}, err
+	}
+	if !reset.ExpiresAt.After(time.Now()) {
+		return passwordReset{}, errNotFound
+	}
+	return reset, nil
+}
+
+// How long a request may hold an idempotency key, so a lock left behind by
+// an instance that died mid-request frees itself
+const redisIdempotencyLockTTL = time.Minute
+
+// How often a request waiting for a held idempotency key checks it again
+const redisLockRetryInterval = 20 * time.Millisecond
+
+// Delete a lock only while it still holds the value its holder set, so a
+// holder whose lock expired can't free the next one's
+var redisUnlock = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// redisIdempotencyStore keeps idempotency records in Redis, and locks keys
+// there so a retry reaching another instance waits for the first request
+type redisIdempotencyStore struct {
+	db *redis.Client
+}
+
+func (s *redisIdempotencyStore) Get(userID, key string) (idempotencyRecord, error) {
+	var record idempotencyRecord
+	if err := redisGetOne(s.db, redisIdempotencyKey(userID, key), "", &record); err != nil {
+		return idempotencyRecord{}, err
+	}
+	if !time.Now().Before(record.ExpiresAt) {
+		return idempotencyRecord{}, errNotFound
+	}
+	return record, nil
+}
+
+func (s *redisIdempotencyStore) Save(record idempotencyRecord) error {
+	ttl := time.Until(record.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Set(context.Background(), redisIdempotencyKey(record.UserID, record.Key), b, ttl).Err()
+}
+
+func (s *redisIdempotencyStore) Lock(ctx context.Context, userID, key string) (func(), error) {
+	lockKey, holder := redisIdempotencyLockKey(userID, key), newID()
+	for {
+		locked, err := s.db.SetNX(ctx, lockKey, holder, redisIdempotencyLockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(redisLockRetryInterval):
+		}
+	}
+	return func() {
+		if err := redisUnlock.Run(context.Background(), s.db, []string{lockKey}, holder).Err(); err != nil {
+			log.Printf("Failed to unlock idempotency key: %v", err)
+		}
+	}, nil
+}
+
+// redisRevocationStore keeps revoked tokens in Redis until they expire
+type redisRevocationStore struct {
+	db *redis.Client
+}
+
+func (s *redisRevocationStore) Revoke(id string, until time.Time) error {
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.db.Set(context.Background(), redisRevokedKey(id), 1, ttl).Err()
+}
+
+func (s *redisRevocationStore) IsRevoked(id string) (bool, error) {
+	n, err := s.db.Exists(context.Background(), redisRevokedKey(id)).Result()
+	return n > 0, err
+}
+
+// redisLoginFailureStore keeps failed logins in Redis. Each key's set
+// expires with its latest failure, which forgets the keys nobody retries.
+type redisLoginFailureStore struct {
+	db *redis.Client
+}
+
+func (s *redisLoginFailureStore) Add(key string, at, since time.Time) error {
+	ctx := context.Background()
+	setKey := redisLoginFailuresKey(key)
+	_, err := s.db.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, setKey, redis.Z{Score: redisScore(at), Member: newID()})
+		pipe.ZRemRangeByScore(ctx, setKey, "-inf", redisScoreString(since))
+		pipe.PExpire(ctx, setKey, at.Sub(since))
+		return nil
+	})
+	return err
+}
+
+func (s *redisLoginFailureStore) Since(key string, since time.Time) ([]time.Time, error) {
+	failures, err := s.db.ZRangeByScoreWithScores(context.Background(), redisLoginFailuresKey(key), &redis.ZRangeBy{
+		Min: "(" + redisScoreString(since),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	times := make([]time.Time, len(failures))
+	for i, failure := range failures {
+		times[i] = time.UnixMicro(int64(failure.Score))
+	}
+	return times, nil
+}
+
+func (s *redisLoginFailureStore) Clear(key string) error {
+	return s.db.Del(context.Background(), redisLoginFailuresKey(key)).Err()
+}
+
+// A score as a bound of a range query
+func redisScoreString(t time.Time) string {
+	return strconv.FormatFloat(redisScore(t), 'f', -1, 64)
+}
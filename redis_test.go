@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// Start a test server storing everything in mr, with the environment
+// variables in env set like newTestServer does
+func newRedisTestServer(t *testing.T, mr *miniredis.Miniredis, env ...string) *testServer {
+	t.Helper()
+	return newTestServer(t, append([]string{"STORAGE", "redis", "REDIS_ADDR", mr.Addr()}, env...)...)
+}
+
+func TestRedisStoresServeTheAPI(t *testing.T) {
+	mr := miniredis.RunT(t)
+	srv := newRedisTestServer(t, mr)
+	_, token := srv.signup("Ada", "ada@example.com")
+	srv.expect(http.StatusConflict, http.MethodPost, "/v1/users", "",
+		gin.H{"name": "Ada", "email": "ADA@example.com", "password": testPassword}, nil)
+
+	report := srv.createTask(token, gin.H{"title": "Write the report"})
+	srv.createTask(token, gin.H{"title": "Review the report"})
+	stale := srv.createTask(token, gin.H{"title": "Stale"})
+
+	srv.expect(http.StatusOK, http.MethodPatch, "/v1/tasks/"+report.ID, token, gin.H{"status": StatusInProgress}, nil)
+	var page taskPage
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks?status=in_progress", token, nil, &page)
+	if page.Total != 1 || page.Data[0].ID != report.ID {
+		t.Fatalf("in progress = %+v, want only %s", page, report.ID)
+	}
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks?status=todo", token, nil, &page)
+	if page.Total != 2 {
+		t.Fatalf("to do total = %d, want 2", page.Total)
+	}
+
+	srv.expect(http.StatusOK, http.MethodDelete, "/v1/tasks/"+stale.ID, token, nil, nil)
+	srv.expect(http.StatusNotFound, http.MethodGet, "/v1/tasks/"+stale.ID, token, nil, nil)
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks", token, nil, &page)
+	if page.Total != 2 {
+		t.Fatalf("total after delete = %d, want 2", page.Total)
+	}
+}
+
+func TestRedisStoresSurviveARestart(t *testing.T) {
+	mr := miniredis.RunT(t)
+	srv := newRedisTestServer(t, mr)
+	_, token := srv.signup("Ada", "ada@example.com")
+	task := srv.createTask(token, gin.H{"title": "Write the report"})
+	srv.stop()
+
+	srv = newRedisTestServer(t, mr)
+	token = srv.login("ada@example.com")
+	var got Task
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+task.ID, token, nil, &got)
+	if got.Title != task.Title {
+		t.Errorf("title = %q, want %q", got.Title, task.Title)
+	}
+}
+
+// Everything one instance records is seen by the next one on the same Redis,
+// so instances behind a load balancer agree
+func TestRedisStoresShareEverythingBetweenInstances(t *testing.T) {
+	mr := miniredis.RunT(t)
+	env := []string{"ADMIN_EMAILS", "ada@example.com", "LOGIN_MAX_ATTEMPTS", "2"}
+	srv := newRedisTestServer(t, mr, env...)
+	ada, token := srv.signup("Ada", "ada@example.com")
+	var login struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	srv.expect(http.StatusOK, http.MethodPost, "/v1/login", "",
+		gin.H{"email": "ada@example.com", "password": testPassword}, &login)
+
+	task := srv.createTask(token, gin.H{"title": "Write the report"})
+	srv.expect(http.StatusCreated, http.MethodPost, "/v1/tasks/"+task.ID+"/comments", token, gin.H{"body": "Started"}, nil)
+	srv.expect(http.StatusOK, http.MethodPatch, "/v1/tasks/"+task.ID, token, gin.H{"status": StatusInProgress}, nil)
+	srv.expect(http.StatusCreated, http.MethodPost, "/v1/tasks/"+task.ID+"/start", token, nil, nil)
+	srv.expect(http.StatusCreated, http.MethodPost, "/v1/webhooks", token, gin.H{"url": "https://203.0.113.10/hook"}, nil)
+	_, err := attachments.Create(Attachment{ID: newID(), TaskID: task.ID, UserID: ada.ID, Filename: "notes.txt", ContentType: "text/plain", Size: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, body := createIdempotently(srv, token, "create-review", gin.H{"title": "Review the report"})
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("idempotent create: status = %d; body %s", resp.StatusCode, body)
+	}
+	var review Task
+	if err := json.Unmarshal(body, &review); err != nil {
+		t.Fatal(err)
+	}
+	srv.expect(http.StatusOK, http.MethodPost, "/v1/logout", "", gin.H{"refresh_token": login.RefreshToken}, nil)
+	for i := 0; i < 2; i++ {
+		srv.expect(http.StatusUnauthorized, http.MethodPost, "/v1/login", "", gin.H{"email": "bob@example.com", "password": "guess"}, nil)
+	}
+	startPasswordReset(t, ada, "reset token")
+	srv.stop()
+
+	srv = newRedisTestServer(t, mr, env...)
+	token = srv.login("ada@example.com")
+	var comments []Comment
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+task.ID+"/comments", token, nil, &comments)
+	var history []StatusChange
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+task.ID+"/history", token, nil, &history)
+	var entry TimeEntry
+	srv.expect(http.StatusOK, http.MethodPost, "/v1/tasks/"+task.ID+"/stop", token, nil, &entry)
+	var hooks []Webhook
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/webhooks", token, nil, &hooks)
+	var files []Attachment
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+task.ID+"/attachments", token, nil, &files)
+	var audited struct {
+		Total int `json:"total"`
+	}
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/audit?resource_type=task&resource_id="+task.ID, token, nil, &audited)
+	if len(comments) != 1 || len(history) != 1 || entry.StoppedAt == nil || len(hooks) != 1 || len(files) != 1 || audited.Total == 0 {
+		t.Errorf("the next instance sees %d comments, %d status changes, entry %+v, %d webhooks, %d attachments and %d audit entries",
+			len(comments), len(history), entry, len(hooks), len(files), audited.Total)
+	}
+
+	resp, body = createIdempotently(srv, token, "create-review", gin.H{"title": "Review the report"})
+	var replayed Task
+	if err := json.Unmarshal(body, &replayed); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get(idempotentReplayHeader) != "true" || replayed.ID != review.ID {
+		t.Errorf("retry on the next instance created %s, want the replay of %s", replayed.ID, review.ID)
+	}
+	srv.expect(http.StatusUnauthorized, http.MethodPost, "/v1/refresh", "", gin.H{"refresh_token": login.RefreshToken}, nil)
+	srv.expect(http.StatusTooManyRequests, http.MethodPost, "/v1/login", "", gin.H{"email": "bob@example.com", "password": "guess"}, nil)
+	srv.expect(http.StatusOK, http.MethodPost, "/v1/password-reset/confirm", "",
+		gin.H{"token": "reset token", "password": "a new password"}, nil)
+}
+
+// A request holding an idempotency key in Redis makes the others wait
+func TestRedisIdempotencyLockWaitsForTheHolder(t *testing.T) {
+	mr := miniredis.RunT(t)
+	db := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer db.Close()
+	first, second := &redisIdempotencyStore{db: db}, &redisIdempotencyStore{db: db}
+
+	unlock, err := first.Lock(context.Background(), "user", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := second.Lock(ctx, "user", "key"); err == nil {
+		t.Fatal("a second request locked a held key")
+	}
+	if unlockOther, err := second.Lock(context.Background(), "user", "other key"); err != nil {
+		t.Fatalf("locking another key: %v", err)
+	} else {
+		unlockOther()
+	}
+
+	unlock()
+	unlock, err = second.Lock(context.Background(), "user", "key")
+	if err != nil {
+		t.Fatalf("locking the released key: %v", err)
+	}
+	unlock()
+}
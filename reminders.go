@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Defaults for how far ahead of a due date reminders go out, and how often
+// the scheduler looks for them
+const (
+	defaultReminderLeadTime = 24 * time.Hour
+	defaultReminderInterval = time.Minute
+)
+
+// A reminder that a task is due soon, or is overdue
+type Reminder struct {
+	TaskID string `json:"task_id"`
+	// UserID is who the reminder is for: the assignee, or the owner of an unassigned task
+	UserID  string    `json:"user_id"`
+	Title   string    `json:"title"`
+	DueDate time.Time `json:"due_date"`
+	Overdue bool      `json:"overdue"`
+}
+
+// Settings of the reminder scheduler
+type reminderConfig struct {
+	leadTime time.Duration
+	interval time.Duration
+}
+
+// Read REMINDER_LEAD_TIME and REMINDER_INTERVAL, Go durations such as 24h
+func reminderSettings() (reminderConfig, error) {
+	cfg := reminderConfig{leadTime: defaultReminderLeadTime, interval: defaultReminderInterval}
+	for _, setting := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"REMINDER_LEAD_TIME", &cfg.leadTime},
+		{"REMINDER_INTERVAL", &cfg.interval},
+	} {
+		v := os.Getenv(setting.name)
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return reminderConfig{}, fmt.Errorf("%s %q must be a positive duration", setting.name, v)
+		}
+		*setting.dst = d
+	}
+	return cfg, nil
+}
+
+// Lead time of GET /tasks/reminders, set from the config in main
+var reminderLeadTime = defaultReminderLeadTime
+
+// reminderNotifier delivers reminders. Only logging exists for now; email or
+// webhooks can be plugged in by implementing it.
+type reminderNotifier interface {
+	Notify(reminder Reminder) error
+}
+
+// logNotifier writes reminders to the log
+type logNotifier struct{}
+
+func (logNotifier) Notify(r Reminder) error {
+	state := "due"
+	if r.Overdue {
+		state = "overdue"
+	}
+	log.Printf("Reminder for user %s: task %s %q is %s at %s", r.UserID, r.TaskID, r.Title, state, r.DueDate.Format(time.RFC3339))
+	return nil
+}
+
+// The reminders of unfinished tasks due before now+lead, soonest first
+func dueReminders(list []Task, now time.Time, lead time.Duration) []Reminder {
+	reminders := []Reminder{}
+	for _, task := range list {
+		if task.DeletedAt != nil || task.Archived || task.DueDate == nil ||
+			task.Status == StatusDone || task.Status == StatusCancelled ||
+			task.DueDate.After(now.Add(lead)) {
+			continue
+		}
+		recipient := task.UserID
+		if task.AssigneeID != nil {
+			recipient = *task.AssigneeID
+		}
+		reminders = append(reminders, Reminder{
+			TaskID:  task.ID,
+			UserID:  recipient,
+			Title:   task.Title,
+			DueDate: *task.DueDate,
+			Overdue: task.DueDate.Before(now),
+		})
+	}
+	sort.SliceStable(reminders, func(i, j int) bool { return reminders[i].DueDate.Before(reminders[j].DueDate) })
+	return reminders
+}
+
+// reminderScheduler periodically notifies about tasks coming due. Each task
+// is notified once per due date, so moving the due date brings a new reminder.
+type reminderScheduler struct {
+	cfg      reminderConfig
+	notifier reminderNotifier
+	// sent maps the tasks already notified to the due date they were notified for
+	sent map[string]time.Time
+}
+
+func newReminderScheduler(cfg reminderConfig, notifier reminderNotifier) *reminderScheduler {
+	return &reminderScheduler{cfg: cfg, notifier: notifier, sent: map[string]time.Time{}}
+}
+
+// Scan for reminders every interval until ctx is done
+func (s *reminderScheduler) run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.interval)
+	defer ticker.Stop()
+	for {
+		s.scan(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Send the reminders that haven't been sent yet. Tasks that are no longer
+// due are forgotten, so the record of sent reminders doesn't grow forever.
+func (s *reminderScheduler) scan(ctx context.Context, now time.Time) {
+	list, err := tasks.List(ctx)
+	if err != nil {
+		log.Printf("Failed to scan for reminders: %v", err)
+		return
+	}
+	sent := make(map[string]time.Time, len(s.sent))
+	for _, r := range dueReminders(list, now, s.cfg.leadTime) {
+		if due, ok := s.sent[r.TaskID]; ok && due.Equal(r.DueDate) {
+			sent[r.TaskID] = due
+			continue
+		}
+		if err := s.notifier.Notify(r); err != nil {
+			// Not marked as sent, so the next scan tries again
+			log.Printf("Failed to send reminder for task %s: %v", r.TaskID, err)
+			continue
+		}
+		sent[r.TaskID] = r.DueDate
+	}
+	s.sent = sent
+}
+
+// List the reminders of the caller's tasks, soonest due first
+func getReminders(c *gin.Context) {
+	list, err := tasks.List(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	user := currentUser(c)
+	visible := filterTasks(list, func(task Task) bool { return canViewTask(user, task) })
+	c.JSON(http.StatusOK, dueReminders(visible, time.Now(), reminderLeadTime))
+}
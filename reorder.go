@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request body for reordering tasks: task IDs, top first
+type reorderRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// Put the caller's tasks in the order given, as drag-and-drop task lists do.
+// The listed tasks swap among the places they already hold, so reordering a
+// filtered list leaves the tasks it doesn't show where they were. Every live
+// task of the caller is then renumbered from 1, closing gaps and breaking
+// ties, and all the changed tasks are saved together or not at all. The
+// response lists the caller's live tasks in their new order.
+func reorderTasks(c *gin.Context) {
+	var req reorderRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if len(req.IDs) == 0 {
+		respondFieldError(c, "ids", "must contain at least one task ID")
+		return
+	}
+	if len(req.IDs) > maxBulkTasks {
+		respondError(c, http.StatusRequestEntityTooLarge, codePayloadTooLarge, fmt.Sprintf("Batch must not contain more than %d tasks", maxBulkTasks))
+		return
+	}
+
+	user := currentUser(c)
+	all, err := tasks.ListByUser(c.Request.Context(), user.ID, "")
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	list := filterTasks(all, func(task Task) bool { return task.DeletedAt == nil })
+	sortTasks(list, taskSort{field: "position"})
+	index := make(map[string]int, len(list))
+	for i, task := range list {
+		index[task.ID] = i
+	}
+	slots := make([]int, len(req.IDs))
+	seen := make(map[string]bool, len(req.IDs))
+	for i, id := range req.IDs {
+		if seen[id] {
+			respondFieldError(c, "ids", "must not list a task more than once")
+			return
+		}
+		seen[id] = true
+		slot, ok := index[id]
+		if !ok {
+			writeError(c, http.StatusNotFound, apiError{
+				Code:    codeNotFound,
+				Message: fmt.Sprintf("Task at index %d not found", i),
+				Details: gin.H{"index": i},
+			})
+			return
+		}
+		slots[i] = slot
+	}
+
+	ordered := make([]Task, len(list))
+	copy(ordered, list)
+	sort.Ints(slots)
+	for i, id := range req.IDs {
+		ordered[slots[i]] = list[index[id]]
+	}
+	var before, changed []Task
+	for i, task := range ordered {
+		if task.Position == i+1 {
+			continue
+		}
+		before = append(before, task)
+		task.Position = i + 1
+		task.UpdatedBy = user.ID
+		changed = append(changed, task)
+	}
+	if len(changed) > 0 {
+		saved, err := tasks.UpdateMany(changed)
+		if err != nil {
+			respondStoreError(c, err, "Task not found")
+			return
+		}
+		for i, task := range saved {
+			ordered[task.Position-1] = task
+			recordAudit(c, AuditUpdate, AuditResourceTask, task.ID, before[i], task)
+			notifyTaskEvent(EventTaskUpdated, task)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": ordered})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// Longest incoming request ID we are willing to echo back
+const maxRequestIDLength = 128
+
+// Middleware to tag every request with an ID, reusing the caller's X-Request-ID when sane
+func requestIDMiddleware(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+	c.Set("requestID", id)
+	c.Header(requestIDHeader, id)
+	c.Next()
+}
+
+// Accept only short, printable IDs so they are safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Get the ID set by requestIDMiddleware
+func requestID(c *gin.Context) string {
+	return c.GetString("requestID")
+}
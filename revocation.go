@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RevocationStore remembers the IDs of revoked tokens until they would have
+// expired anyway, after which they can be forgotten
+type RevocationStore interface {
+	// Revoke the token with the given ID, which expires at until
+	Revoke(id string, until time.Time) error
+	IsRevoked(id string) (bool, error)
+}
+
+// The revoked tokens, pointed at the chosen storage by newRouter
+var revokedTokens RevocationStore = &revocationList{}
+
+// revocationList keeps revoked tokens in memory, guarded by a mutex.
+// Expired ones are swept out on every Revoke.
+type revocationList struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func (l *revocationList) Revoke(id string, until time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.revoked == nil {
+		l.revoked = make(map[string]time.Time)
+	}
+	now := time.Now()
+	for other, expiry := range l.revoked {
+		if expiry.Before(now) {
+			delete(l.revoked, other)
+		}
+	}
+	l.revoked[id] = until
+	return nil
+}
+
+func (l *revocationList) IsRevoked(id string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.revoked[id]
+	return ok, nil
+}
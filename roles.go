@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var validRoles = []string{RoleUser, RoleAdmin}
+
+func isValidRole(role string) bool {
+	for _, r := range validRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Emails that are given the admin role when they register, from the
+// comma-separated ADMIN_EMAILS. This is how the first admin comes to be.
+func adminEmails() map[string]bool {
+	emails := map[string]bool{}
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.TrimSpace(email); email != "" {
+			emails[strings.ToLower(email)] = true
+		}
+	}
+	return emails
+}
+
+// Role of a newly registered user
+func roleForEmail(email string) string {
+	if adminEmails()[strings.ToLower(email)] {
+		return RoleAdmin
+	}
+	return RoleUser
+}
+
+func isAdmin(user *User) bool {
+	return user != nil && user.Role == RoleAdmin
+}
+
+// Middleware to refuse non-admins with 403; must run after authMiddleware
+func adminOnly(c *gin.Context) {
+	if !isAdmin(currentUser(c)) {
+		respondError(c, http.StatusForbidden, codeForbidden, "Forbidden: admin role required")
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+// Change a user's role; admin only
+func updateUserRole(c *gin.Context) {
+	user, ok := loadUser(c, false)
+	if !ok {
+		return
+	}
+	var req roleRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if !isValidRole(req.Role) {
+		respondFieldError(c, "role", "Invalid role \""+req.Role+"\": must be one of "+strings.Join(validRoles, ", "))
+		return
+	}
+	updated := user
+	updated.Role = req.Role
+	updated, err := users.Update(user.ID, updated)
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	recordAudit(c, AuditUpdate, AuditResourceUser, user.ID, user, updated)
+	c.JSON(http.StatusOK, updated)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// How well a task matches a search; lower ranks sort first
+const (
+	rankExactTitle = iota
+	rankTitle
+	rankDescription
+	noMatch
+)
+
+// Rank a task against a lowercased query
+func searchRank(task Task, query string) int {
+	title := strings.ToLower(task.Title)
+	switch {
+	case title == query:
+		return rankExactTitle
+	case strings.Contains(title, query):
+		return rankTitle
+	case strings.Contains(strings.ToLower(task.Description), query):
+		return rankDescription
+	default:
+		return noMatch
+	}
+}
+
+// Find the caller's tasks whose title or description contains ?q=, best matches first
+func searchTasks(c *gin.Context) {
+	query := strings.ToLower(strings.TrimSpace(c.Query("q")))
+	if query == "" {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "q must not be empty")
+		return
+	}
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	owned, ok := listOwnedTasks(c)
+	if !ok {
+		return
+	}
+
+	ranks := make(map[string]int, len(owned))
+	list := filterTasks(owned, func(task Task) bool {
+		ranks[task.ID] = searchRank(task, query)
+		return ranks[task.ID] != noMatch
+	})
+	sort.SliceStable(list, func(i, j int) bool {
+		return ranks[list[i].ID] < ranks[list[j].ID]
+	})
+	setTotalCount(c, len(list))
+	c.JSON(http.StatusOK, newPage(c, paginate(list, limit, offset), len(list), limit, offset))
+}
+
+// Fold text for matching regardless of case and accents, so "jose" matches "José"
+func foldSearchText(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return strings.ToLower(folded)
+}
+
+// Find the users whose name or email contains ?q=, ignoring case and accents; admin only
+func searchUsers(c *gin.Context) {
+	query := foldSearchText(strings.TrimSpace(c.Query("q")))
+	if query == "" {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "q must not be empty")
+		return
+	}
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
+		return
+	}
+	all, err := users.List(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	list := []User{}
+	for _, user := range all {
+		if user.DeletedAt != nil && !includeDeleted {
+			continue
+		}
+		if strings.Contains(foldSearchText(user.Name), query) || strings.Contains(foldSearchText(user.Email), query) {
+			list = append(list, user)
+		}
+	}
+	setTotalCount(c, len(list))
+	c.JSON(http.StatusOK, newPage(c, paginate(list, limit, offset), len(list), limit, offset))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testPassword = "correct horse battery staple"
+
+// A server wired like main's. The handlers share
+// package-level state, so tests using it must not run in parallel.
+type testServer struct {
+	*httptest.Server
+	t *testing.T
+	// stop shuts the server down and closes its storage
+	stop func()
+}
+
+// Start a test server over a new database, with the environment
+// variables given in env as name, value pairs set for the test
+func newTestServer(t *testing.T, env ...string) *testServer {
+	t.Helper()
+	return newTestServerAt(t, filepath.Join(t.TempDir(), "tasks.db"), env...)
+}
+
+// Like newTestServer, but over the database at dbPath, which is closed with
+// the server. Rate limits are lifted unless the test sets them.
+func newTestServerAt(t *testing.T, dbPath string, env ...string) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("JWT_SECRET", "test secret")
+	t.Setenv("STORAGE", "sqlite")
+	t.Setenv("DATABASE_PATH", dbPath)
+	t.Setenv("RATE_LIMIT_PER_MINUTE", "1000000")
+	for i := 0; i+1 < len(env); i += 2 {
+		t.Setenv(env[i], env[i+1])
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores, err := openStores(cfg.Storage, cfg.DatabasePath, cfg.Snapshots, cfg.Redis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := newRouter(cfg, stores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(stripTrailingSlash(router))
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			srv.Close()
+			stores.close()
+		})
+	}
+	t.Cleanup(stop)
+	return &testServer{Server: srv, t: t, stop: stop}
+}
+
+// Send a request with body, when not nil, as JSON and token, when not empty,
+// as its bearer token. Returns the status and the response body.
+func (s *testServer) do(method, path, token string, body interface{}) (int, []byte) {
+	s.t.Helper()
+	resp, data := s.send(method, path, token, body, nil)
+	return resp.StatusCode, data
+}
+
+// Like do, but also sends the headers in header and returns the whole response
+func (s *testServer) send(method, path, token string, body interface{}, header http.Header) (*http.Response, []byte) {
+	s.t.Helper()
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.URL+path, reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return resp, data
+}
+
+// Like do, but fails the test unless the status is want, then decodes the
+// body into out when it isn't nil
+func (s *testServer) expect(want int, method, path, token string, body, out interface{}) {
+	s.t.Helper()
+	status, data := s.do(method, path, token, body)
+	if status != want {
+		s.t.Fatalf("%s %s: status = %d, want %d; body %s", method, path, status, want, data)
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			s.t.Fatalf("%s %s: decoding %s: %v", method, path, data, err)
+		}
+	}
+}
+
+// Register a user and log them in, returning the user and their token
+func (s *testServer) signup(name, email string) (User, string) {
+	s.t.Helper()
+	var user User
+	s.expect(http.StatusCreated, http.MethodPost, "/v1/users", "",
+		gin.H{"name": name, "email": email, "password": testPassword}, &user)
+	return user, s.login(email)
+}
+
+// Log in as the user with email and testPassword, returning their token
+func (s *testServer) login(email string) string {
+	s.t.Helper()
+	var login struct {
+		Token string `json:"token"`
+	}
+	s.expect(http.StatusOK, http.MethodPost, "/v1/login", "",
+		gin.H{"email": email, "password": testPassword}, &login)
+	return login.Token
+}
+
+// Create a task as the token's user
+func (s *testServer) createTask(token string, task gin.H) Task {
+	s.t.Helper()
+	var created Task
+	s.expect(http.StatusCreated, http.MethodPost, "/v1/tasks", token, task, &created)
+	return created
+}
+
+// A page of the task list
+type taskPage struct {
+	Data  []Task `json:"data"`
+	Total int    `json:"total"`
+}
+
+// Decode the error envelope of a failed request
+func responseError(t *testing.T, body []byte) apiError {
+	t.Helper()
+	var resp struct {
+		Error apiError `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decoding %s: %v", body, err)
+	}
+	return resp.Error
+}
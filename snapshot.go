@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Snapshots let the memory stores survive restarts without a database: users
+// and tasks are written to a JSON file every SNAPSHOT_INTERVAL and on
+// shutdown, and read back on startup. Everything else the memory stores hold,
+// such as comments and status history, is still lost on restart.
+
+// How often snapshots are taken when SNAPSHOT_INTERVAL is not set
+const defaultSnapshotInterval = time.Minute
+
+type snapshotConfig struct {
+	// path is empty when snapshots are off
+	path     string
+	interval time.Duration
+}
+
+// Read SNAPSHOT_PATH, the file to snapshot the memory stores to, which turns
+// snapshots on, and SNAPSHOT_INTERVAL, a Go duration such as 30s
+func snapshotSettings() (snapshotConfig, error) {
+	cfg := snapshotConfig{path: os.Getenv("SNAPSHOT_PATH"), interval: defaultSnapshotInterval}
+	if v := os.Getenv("SNAPSHOT_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return snapshotConfig{}, fmt.Errorf("SNAPSHOT_INTERVAL %q must be a positive duration", v)
+		}
+		cfg.interval = d
+	}
+	return cfg, nil
+}
+
+// Contents of a snapshot file
+type snapshot struct {
+	SavedAt time.Time    `json:"saved_at"`
+	Users   []userRecord `json:"users"`
+	Tasks   []Task       `json:"tasks"`
+}
+
+// snapshotter keeps a snapshot file of the memory user and task stores
+type snapshotter struct {
+	cfg   snapshotConfig
+	users *memoryUserStore
+	tasks *memoryTaskStore
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// Fill the stores from the snapshot file and keep saving them to it until close
+func startSnapshots(cfg snapshotConfig, users *memoryUserStore, tasks *memoryTaskStore) *snapshotter {
+	s := &snapshotter{cfg: cfg, users: users, tasks: tasks, stop: make(chan struct{}), done: make(chan struct{})}
+	s.load()
+	go s.run()
+	return s
+}
+
+// Load the snapshot file into the stores. Without the file they start empty,
+// and so they do when it is corrupt, with the file moved aside to
+// <path>.corrupt so the next snapshot doesn't overwrite what it held.
+func (s *snapshotter) load() {
+	b, err := os.ReadFile(s.cfg.path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No snapshot at %s yet, starting empty", s.cfg.path)
+		return
+	}
+	var snap snapshot
+	if err == nil {
+		err = json.Unmarshal(b, &snap)
+	}
+	if err != nil {
+		log.Printf("WARNING: could not read snapshot %s, starting empty: %v", s.cfg.path, err)
+		if err := os.Rename(s.cfg.path, s.cfg.path+".corrupt"); err != nil {
+			log.Printf("WARNING: could not move the snapshot aside: %v", err)
+		}
+		return
+	}
+	list := make([]User, len(snap.Users))
+	for i, user := range snap.Users {
+		list[i] = user.toUser()
+	}
+	s.users.mu.Lock()
+	s.users.users = list
+	s.users.mu.Unlock()
+	s.tasks.mu.Lock()
+	s.tasks.tasks = snap.Tasks
+	s.tasks.mu.Unlock()
+	log.Printf("Loaded %d users and %d tasks from the snapshot taken at %s",
+		len(list), len(snap.Tasks), snap.SavedAt.Format(time.RFC3339))
+}
+
+// Save a snapshot every interval until close is called
+func (s *snapshotter) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.save(); err != nil {
+				log.Printf("Failed to save snapshot: %v", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Write the stores to the snapshot file. The file is replaced in one
+// rename, so a crash mid-write leaves the previous snapshot in place.
+func (s *snapshotter) save() error {
+	snap := snapshot{SavedAt: time.Now()}
+	// A snapshot runs to the end, even the one taken on shutdown
+	ctx := context.Background()
+	list, err := s.users.List(ctx)
+	if err != nil {
+		return err
+	}
+	snap.Users = make([]userRecord, len(list))
+	for i, user := range list {
+		snap.Users[i] = newUserRecord(user)
+	}
+	if snap.Tasks, err = s.tasks.List(ctx); err != nil {
+		return err
+	}
+	b, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.cfg.path), filepath.Base(s.cfg.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.cfg.path)
+}
+
+// Stop the periodic snapshots and take a final one
+func (s *snapshotter) close() error {
+	close(s.stop)
+	<-s.done
+	if err := s.save(); err != nil {
+		return fmt.Errorf("save snapshot: %w", err)
+	}
+	log.Printf("Saved snapshot to %s", s.cfg.path)
+	return nil
+}
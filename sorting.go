@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sort used when ?sort= is omitted
+const defaultSortField = "created_at"
+
+// A column tasks can be sorted by
+type sortField struct {
+	// less reports whether a comes before b in ascending order
+	less func(a, b Task) bool
+	// descByDefault is the order used when ?order= is omitted
+	descByDefault bool
+}
+
+// The values accepted by ?sort=. Priorities ascend from low to urgent,
+// statuses follow the workflow, from todo to cancelled, and positions follow
+// the order set by PATCH /tasks/reorder.
+var sortFields = map[string]sortField{
+	"created_at": {
+		less:          func(a, b Task) bool { return a.CreatedAt.Before(b.CreatedAt) },
+		descByDefault: true,
+	},
+	"updated_at": {
+		less:          func(a, b Task) bool { return a.UpdatedAt.Before(b.UpdatedAt) },
+		descByDefault: true,
+	},
+	"title": {
+		less: func(a, b Task) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) },
+	},
+	"status": {
+		less: func(a, b Task) bool { return statusRank(a.Status) < statusRank(b.Status) },
+	},
+	"priority": {
+		less:          func(a, b Task) bool { return priorityRank[a.Priority] < priorityRank[b.Priority] },
+		descByDefault: true,
+	},
+	"position": {
+		less: func(a, b Task) bool { return a.Position < b.Position },
+	},
+}
+
+// How a list of tasks should be ordered
+type taskSort struct {
+	field string
+	desc  bool
+}
+
+// Read ?sort= and ?order= from the query string. Without ?order=, dates and
+// priorities sort newest and most pressing first, titles and statuses A to Z
+// and positions from the top.
+func parseSort(c *gin.Context) (taskSort, error) {
+	s := taskSort{field: c.DefaultQuery("sort", defaultSortField)}
+	field, ok := sortFields[s.field]
+	if !ok {
+		return taskSort{}, errors.New("sort must be one of created_at, updated_at, title, status, priority, position")
+	}
+	switch order := c.Query("order"); order {
+	case "":
+		s.desc = field.descByDefault
+	case "asc", "desc":
+		s.desc = order == "desc"
+	default:
+		return taskSort{}, errors.New("order must be asc or desc")
+	}
+	return s, nil
+}
+
+// Order the tasks in place. Ties keep their existing order, so tasks that
+// compare equal stay oldest first.
+func sortTasks(list []Task, s taskSort) {
+	less := sortFields[s.field].less
+	sort.SliceStable(list, func(i, j int) bool {
+		if s.desc {
+			return less(list[j], list[i])
+		}
+		return less(list[i], list[j])
+	})
+}
+
+// Position of a status in the workflow, with unknown statuses last
+func statusRank(status string) int {
+	for i, s := range validStatuses {
+		if s == status {
+			return i
+		}
+	}
+	return len(validStatuses)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Titles of the tasks the token's user gets back from the task list at path
+func listedTitles(srv *testServer, token, path string) []string {
+	srv.t.Helper()
+	var list taskPage
+	srv.expect(http.StatusOK, http.MethodGet, path, token, nil, &list)
+	titles := make([]string, len(list.Data))
+	for i, task := range list.Data {
+		titles[i] = task.Title
+	}
+	return titles
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSortByPriority(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	for _, task := range []struct{ title, priority string }{
+		{"first low", PriorityLow},
+		{"first urgent", PriorityUrgent},
+		{"medium", PriorityMedium},
+		{"second urgent", PriorityUrgent},
+		{"high", PriorityHigh},
+	} {
+		srv.createTask(token, gin.H{"title": task.title, "priority": task.priority})
+	}
+
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		// Most pressing first, and the older of two urgent tasks before the newer
+		{"sort=priority", []string{"first urgent", "second urgent", "high", "medium", "first low"}},
+		{"sort=priority&order=asc", []string{"first low", "medium", "high", "first urgent", "second urgent"}},
+		{"sort=created_at&order=asc", []string{"first low", "first urgent", "medium", "second urgent", "high"}},
+		// Newest first by default
+		{"", []string{"high", "second urgent", "medium", "first urgent", "first low"}},
+	} {
+		if got := listedTitles(srv, token, "/v1/tasks?"+tc.query); !equalStrings(got, tc.want) {
+			t.Errorf("?%s: got %q, want %q", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestPriorityIsValidated(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+
+	srv.expect(http.StatusBadRequest, http.MethodPost, "/v1/tasks", token, gin.H{"title": "Task", "priority": "whenever"}, nil)
+	task := srv.createTask(token, gin.H{"title": "Task"})
+	if task.Priority != PriorityMedium {
+		t.Errorf("default priority = %q, want medium", task.Priority)
+	}
+	path := "/v1/tasks/" + task.ID
+	srv.expect(http.StatusBadRequest, http.MethodPut, path, token, gin.H{"title": "Task", "priority": "whenever"}, nil)
+	srv.expect(http.StatusBadRequest, http.MethodPatch, path, token, gin.H{"priority": "whenever"}, nil)
+}
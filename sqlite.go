@@ -0,0 +1,1182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// Schema changes, applied in order. The index of the last applied migration
+// is kept in PRAGMA user_version, so only append to this list.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		name       TEXT NOT NULL,
+		email      TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		password   TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS tasks (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id     INTEGER NOT NULL,
+		title       TEXT NOT NULL,
+		description TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		priority    TEXT NOT NULL,
+		tags        TEXT NOT NULL,
+		due_date    TIMESTAMP,
+		created_at  TIMESTAMP NOT NULL,
+		updated_at  TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS tasks_user_id ON tasks (user_id)`,
+	`ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP`,
+	`ALTER TABLE tasks ADD COLUMN deleted_at TIMESTAMP`,
+	`ALTER TABLE tasks ADD COLUMN assignee_id INTEGER`,
+	`CREATE INDEX IF NOT EXISTS tasks_assignee_id ON tasks (assignee_id)`,
+	`CREATE TABLE IF NOT EXISTS comments (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id    INTEGER NOT NULL,
+		user_id    INTEGER NOT NULL,
+		body       TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS comments_task_id ON comments (task_id)`,
+	`CREATE TABLE IF NOT EXISTS status_changes (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id     INTEGER NOT NULL,
+		from_status TEXT NOT NULL,
+		to_status   TEXT NOT NULL,
+		changed_by  INTEGER NOT NULL,
+		changed_at  TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS status_changes_task_id ON status_changes (task_id)`,
+	`ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	`ALTER TABLE tasks ADD COLUMN recurrence TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE tasks ADD COLUMN parent_id INTEGER`,
+	`CREATE INDEX IF NOT EXISTS tasks_parent_id ON tasks (parent_id)`,
+	`ALTER TABLE tasks ADD COLUMN blocked_by TEXT NOT NULL DEFAULT '[]'`,
+	`CREATE TABLE IF NOT EXISTS webhooks (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    INTEGER NOT NULL,
+		url        TEXT NOT NULL,
+		secret     TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS webhooks_user_id ON webhooks (user_id)`,
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'`,
+	`ALTER TABLE tasks ADD COLUMN archived INTEGER NOT NULL DEFAULT 0`,
+	`CREATE TABLE IF NOT EXISTS idempotency_keys (
+		user_id      INTEGER NOT NULL,
+		key          TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		status       INTEGER NOT NULL,
+		body         BLOB NOT NULL,
+		expires_at   INTEGER NOT NULL,
+		PRIMARY KEY (user_id, key)
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_log (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor_id      INTEGER,
+		action        TEXT NOT NULL,
+		resource_type TEXT NOT NULL,
+		resource_id   INTEGER NOT NULL,
+		changes       TEXT NOT NULL,
+		created_at    TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_resource ON audit_log (resource_type, resource_id)`,
+	`CREATE INDEX IF NOT EXISTS audit_log_actor_id ON audit_log (actor_id)`,
+	// The audit log is append-only, even for someone with a SQL shell
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+	`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+	`CREATE TABLE IF NOT EXISTS attachments (
+		id           TEXT PRIMARY KEY,
+		task_id      INTEGER NOT NULL,
+		user_id      INTEGER NOT NULL,
+		filename     TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size         INTEGER NOT NULL,
+		created_at   TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS attachments_task_id ON attachments (task_id)`,
+	`ALTER TABLE tasks ADD COLUMN created_by INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE tasks ADD COLUMN updated_by INTEGER NOT NULL DEFAULT 0`,
+	// Tasks from before provenance was tracked are credited to their owner
+	`UPDATE tasks SET created_by = user_id, updated_by = user_id`,
+	// Users and tasks move from sequential integer IDs to UUIDs. The old IDs are
+	// kept in legacy_user_ids and legacy_task_ids for anything outside the
+	// database that still refers to them, such as attachment directories.
+	createLegacyUserIDs,
+	`INSERT INTO legacy_user_ids (old_id, id) SELECT id, ` + sqliteNewUUID + ` FROM users`,
+	`CREATE TABLE legacy_task_ids (old_id INTEGER PRIMARY KEY, id TEXT NOT NULL UNIQUE)`,
+	`INSERT INTO legacy_task_ids (old_id, id) SELECT id, ` + sqliteNewUUID + ` FROM tasks`,
+	`CREATE TABLE users_v2 (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		email      TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		password   TEXT NOT NULL,
+		role       TEXT NOT NULL DEFAULT 'user',
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL,
+		deleted_at TIMESTAMP
+	)`,
+	`INSERT INTO users_v2 (id, name, email, password, role, created_at, updated_at, deleted_at)
+	SELECT m.id, u.name, u.email, u.password, u.role, u.created_at, u.updated_at, u.deleted_at
+	FROM users u JOIN legacy_user_ids m ON m.old_id = u.id`,
+	`DROP TABLE users`,
+	`ALTER TABLE users_v2 RENAME TO users`,
+	`CREATE TABLE tasks_v2 (
+		id          TEXT PRIMARY KEY,
+		user_id     TEXT NOT NULL,
+		title       TEXT NOT NULL,
+		description TEXT NOT NULL,
+		status      TEXT NOT NULL,
+		priority    TEXT NOT NULL,
+		tags        TEXT NOT NULL,
+		due_date    TIMESTAMP,
+		assignee_id TEXT,
+		recurrence  TEXT NOT NULL DEFAULT '',
+		parent_id   TEXT,
+		blocked_by  TEXT NOT NULL DEFAULT '[]',
+		archived    INTEGER NOT NULL DEFAULT 0,
+		created_by  TEXT NOT NULL,
+		updated_by  TEXT NOT NULL,
+		version     INTEGER NOT NULL DEFAULT 1,
+		created_at  TIMESTAMP NOT NULL,
+		updated_at  TIMESTAMP NOT NULL,
+		deleted_at  TIMESTAMP
+	)`,
+	`INSERT INTO tasks_v2 (id, user_id, title, description, status, priority, tags, due_date, assignee_id,
+		recurrence, parent_id, blocked_by, archived, created_by, updated_by, version, created_at, updated_at, deleted_at)
+	SELECT m.id, owner.id, t.title, t.description, t.status, t.priority, t.tags, t.due_date,
+		(SELECT id FROM legacy_user_ids WHERE old_id = t.assignee_id),
+		t.recurrence,
+		(SELECT id FROM legacy_task_ids WHERE old_id = t.parent_id),
+		(SELECT json_group_array(id) FROM (
+			SELECT b.id FROM json_each(t.blocked_by) j JOIN legacy_task_ids b ON b.old_id = j.value ORDER BY j.key)),
+		t.archived,
+		COALESCE((SELECT id FROM legacy_user_ids WHERE old_id = t.created_by), owner.id),
+		COALESCE((SELECT id FROM legacy_user_ids WHERE old_id = t.updated_by), owner.id),
+		t.version, t.created_at, t.updated_at, t.deleted_at
+	FROM tasks t
+	JOIN legacy_task_ids m ON m.old_id = t.id
+	-- checkTaskOwners saw to it that every task has an owner; one that
+	-- somehow doesn't fails the NOT NULL on user_id instead of being left behind
+	LEFT JOIN legacy_user_ids owner ON owner.old_id = t.user_id`,
+	`DROP TABLE tasks`,
+	`ALTER TABLE tasks_v2 RENAME TO tasks`,
+	`CREATE INDEX tasks_user_id ON tasks (user_id)`,
+	`CREATE INDEX tasks_assignee_id ON tasks (assignee_id)`,
+	`CREATE INDEX tasks_parent_id ON tasks (parent_id)`,
+	// The other tables keep their INTEGER columns, which hold the UUIDs as text,
+	// until they are rebuilt with TEXT columns further down
+	`UPDATE comments SET
+		task_id = (SELECT id FROM legacy_task_ids WHERE old_id = task_id),
+		user_id = (SELECT id FROM legacy_user_ids WHERE old_id = user_id)`,
+	`UPDATE status_changes SET
+		task_id = (SELECT id FROM legacy_task_ids WHERE old_id = task_id),
+		changed_by = (SELECT id FROM legacy_user_ids WHERE old_id = changed_by)`,
+	`UPDATE webhooks SET user_id = (SELECT id FROM legacy_user_ids WHERE old_id = user_id)`,
+	`UPDATE attachments SET
+		task_id = (SELECT id FROM legacy_task_ids WHERE old_id = task_id),
+		user_id = (SELECT id FROM legacy_user_ids WHERE old_id = user_id)`,
+	// Stored responses carry the old IDs and expire soon anyway
+	`DELETE FROM idempotency_keys`,
+	// Renumbering the audit log is the one change it allows
+	`DROP TRIGGER audit_log_no_update`,
+	`UPDATE audit_log SET
+		actor_id = (SELECT id FROM legacy_user_ids WHERE old_id = actor_id),
+		resource_id = CASE resource_type
+			WHEN 'user' THEN COALESCE((SELECT id FROM legacy_user_ids WHERE old_id = resource_id), resource_id)
+			ELSE COALESCE((SELECT id FROM legacy_task_ids WHERE old_id = resource_id), resource_id)
+		END`,
+	`CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+	`ALTER TABLE users ADD COLUMN task_quota INTEGER`,
+	`CREATE TABLE IF NOT EXISTS time_entries (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id    TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		started_at TIMESTAMP NOT NULL,
+		stopped_at TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS time_entries_task_id ON time_entries (task_id)`,
+	// At most one running timer per task
+	`CREATE UNIQUE INDEX IF NOT EXISTS time_entries_running ON time_entries (task_id) WHERE stopped_at IS NULL`,
+	`CREATE TABLE IF NOT EXISTS password_resets (
+		token_hash TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`,
+	`ALTER TABLE tasks ADD COLUMN color TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE tasks ADD COLUMN completed_at TIMESTAMP`,
+	// Tasks already done count as completed when they last became done
+	`UPDATE tasks SET completed_at = COALESCE(
+		(SELECT MAX(changed_at) FROM status_changes WHERE task_id = tasks.id AND to_status = 'done'),
+		updated_at)
+	WHERE status = 'done'`,
+	`ALTER TABLE users ADD COLUMN timezone TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS tasks_user_status ON tasks (user_id, status)`,
+	`ALTER TABLE tasks ADD COLUMN position INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT 1`,
+	// The tables that refer to users and tasks by ID are rebuilt with TEXT
+	// columns for the UUIDs, which compare and index as text only then
+	`CREATE TABLE comments_v2 (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id    TEXT NOT NULL,
+		user_id    TEXT NOT NULL,
+		body       TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`INSERT INTO comments_v2 (id, task_id, user_id, body, created_at)
+	SELECT id, task_id, user_id, body, created_at FROM comments`,
+	`DROP TABLE comments`,
+	`ALTER TABLE comments_v2 RENAME TO comments`,
+	`CREATE INDEX comments_task_id ON comments (task_id)`,
+	`CREATE TABLE status_changes_v2 (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		task_id     TEXT NOT NULL,
+		from_status TEXT NOT NULL,
+		to_status   TEXT NOT NULL,
+		changed_by  TEXT NOT NULL,
+		changed_at  TIMESTAMP NOT NULL
+	)`,
+	`INSERT INTO status_changes_v2 (id, task_id, from_status, to_status, changed_by, changed_at)
+	SELECT id, task_id, from_status, to_status, changed_by, changed_at FROM status_changes`,
+	`DROP TABLE status_changes`,
+	`ALTER TABLE status_changes_v2 RENAME TO status_changes`,
+	`CREATE INDEX status_changes_task_id ON status_changes (task_id)`,
+	`CREATE TABLE webhooks_v2 (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id    TEXT NOT NULL,
+		url        TEXT NOT NULL,
+		secret     TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`INSERT INTO webhooks_v2 (id, user_id, url, secret, created_at)
+	SELECT id, user_id, url, secret, created_at FROM webhooks`,
+	`DROP TABLE webhooks`,
+	`ALTER TABLE webhooks_v2 RENAME TO webhooks`,
+	`CREATE INDEX webhooks_user_id ON webhooks (user_id)`,
+	`CREATE TABLE attachments_v2 (
+		id           TEXT PRIMARY KEY,
+		task_id      TEXT NOT NULL,
+		user_id      TEXT NOT NULL,
+		filename     TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size         INTEGER NOT NULL,
+		created_at   TIMESTAMP NOT NULL
+	)`,
+	`INSERT INTO attachments_v2 (id, task_id, user_id, filename, content_type, size, created_at)
+	SELECT id, task_id, user_id, filename, content_type, size, created_at FROM attachments`,
+	`DROP TABLE attachments`,
+	`ALTER TABLE attachments_v2 RENAME TO attachments`,
+	`CREATE INDEX attachments_task_id ON attachments (task_id)`,
+	`CREATE TABLE idempotency_keys_v2 (
+		user_id      TEXT NOT NULL,
+		key          TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		status       INTEGER NOT NULL,
+		body         BLOB NOT NULL,
+		expires_at   INTEGER NOT NULL,
+		PRIMARY KEY (user_id, key)
+	)`,
+	`INSERT INTO idempotency_keys_v2 (user_id, key, request_hash, status, body, expires_at)
+	SELECT user_id, key, request_hash, status, body, expires_at FROM idempotency_keys`,
+	`DROP TABLE idempotency_keys`,
+	`ALTER TABLE idempotency_keys_v2 RENAME TO idempotency_keys`,
+	// Dropping the audit log doesn't fire its triggers; they go with the table
+	// and come back on the new one
+	`CREATE TABLE audit_log_v2 (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor_id      TEXT,
+		action        TEXT NOT NULL,
+		resource_type TEXT NOT NULL,
+		resource_id   TEXT NOT NULL,
+		changes       TEXT NOT NULL,
+		created_at    TIMESTAMP NOT NULL
+	)`,
+	`INSERT INTO audit_log_v2 (id, actor_id, action, resource_type, resource_id, changes, created_at)
+	SELECT id, actor_id, action, resource_type, resource_id, changes, created_at FROM audit_log`,
+	`DROP TABLE audit_log`,
+	`ALTER TABLE audit_log_v2 RENAME TO audit_log`,
+	`CREATE INDEX audit_log_resource ON audit_log (resource_type, resource_id)`,
+	`CREATE INDEX audit_log_actor_id ON audit_log (actor_id)`,
+	`CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+	`CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+	// Webhooks get random UUIDs like users and tasks. Nothing refers to
+	// them, so existing ones are simply given new IDs.
+	`CREATE TABLE webhooks_v3 (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL,
+		url        TEXT NOT NULL,
+		secret     TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`INSERT INTO webhooks_v3 (id, user_id, url, secret, created_at)
+	SELECT ` + sqliteNewUUID + `, user_id, url, secret, created_at FROM webhooks ORDER BY id`,
+	`DROP TABLE webhooks`,
+	`ALTER TABLE webhooks_v3 RENAME TO webhooks`,
+	`CREATE INDEX webhooks_user_id ON webhooks (user_id)`,
+	`ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMP`,
+}
+
+// The first step of moving users and tasks to UUIDs
+const createLegacyUserIDs = `CREATE TABLE legacy_user_ids (old_id INTEGER PRIMARY KEY, id TEXT NOT NULL UNIQUE)`
+
+// Checks run before the migration whose SQL they are keyed by. One that
+// fails stops migrate before that migration, leaving the database as it was.
+var migrationChecks = map[string]func(tx *sql.Tx) error{
+	createLegacyUserIDs: checkTaskOwners,
+}
+
+// Check that every task has an owner to carry over to its UUID. Databases
+// from before users were soft-deleted can hold tasks of users deleted for
+// good, which have to be dealt with by hand first.
+func checkTaskOwners(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id FROM tasks WHERE user_id NOT IN (SELECT id FROM users) ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, strconv.FormatInt(id, 10))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		list := strings.Join(ids, ", ")
+		return fmt.Errorf("tasks %s belong to users that no longer exist; delete them (DELETE FROM tasks WHERE id IN (%s)) "+
+			"or give them to an existing user (UPDATE tasks SET user_id = <user id> WHERE id IN (%s)), then start again", list, list, list)
+	}
+	return nil
+}
+
+// SQL expression for a random (version 4) UUID, for migrating existing rows
+const sqliteNewUUID = `lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' ||
+	substr(hex(randomblob(2)), 2) || '-' || substr('89ab', 1 + abs(random()) % 4, 1) ||
+	substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6)))`
+
+// Open the SQLite database at path and bring its schema up to date
+func openSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer at a time
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if check, ok := migrationChecks[migrations[i]]; ok {
+			if err := check(tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d: %w", i+1, err)
+			}
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		// PRAGMA does not accept placeholders
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// queryExecer is satisfied by both as well, for writes that read first
+type queryExecer interface {
+	execer
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// sqliteUserStore keeps users in the users table
+type sqliteUserStore struct {
+	db *sql.DB
+}
+
+const userColumns = `id, name, email, password, role, task_quota, timezone, active, password_changed_at, created_at, updated_at, deleted_at`
+
+func scanUser(row rowScanner) (User, error) {
+	var (
+		user              User
+		quota             sql.NullInt64
+		passwordChangedAt sql.NullTime
+		deletedAt         sql.NullTime
+	)
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &quota, &user.Timezone, &user.Active, &passwordChangedAt, &user.CreatedAt, &user.UpdatedAt, &deletedAt)
+	if err == sql.ErrNoRows {
+		return User{}, errNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if quota.Valid {
+		n := int(quota.Int64)
+		user.TaskQuota = &n
+	}
+	user.PasswordChangedAt = timePtr(passwordChangedAt)
+	user.DeletedAt = timePtr(deletedAt)
+	return user, nil
+}
+
+// Convert a nullable column into an optional time
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// Map constraint violations onto the store's errors
+func userWriteError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: users.email") {
+		return errEmailTaken
+	}
+	return err
+}
+
+func (s *sqliteUserStore) Create(user User) (User, error) {
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.DeletedAt = nil
+	user.ID = newID()
+	_, err := s.db.Exec(`INSERT INTO users (id, name, email, password, role, task_quota, timezone, active, password_changed_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID, user.Name, user.Email, user.Password, user.Role, user.TaskQuota, user.Timezone, user.Active, user.PasswordChangedAt, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return User{}, userWriteError(err)
+	}
+	return user, nil
+}
+
+func (s *sqliteUserStore) List(ctx context.Context) ([]User, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+userColumns+` FROM users ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, user)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqliteUserStore) GetByID(id string) (User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+}
+
+func (s *sqliteUserStore) GetByEmail(email string) (User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email = ?`, email))
+}
+
+func (s *sqliteUserStore) Update(id string, user User) (User, error) {
+	existing, err := s.GetByID(id)
+	if err != nil {
+		return User{}, err
+	}
+	user.ID = id
+	user.CreatedAt = existing.CreatedAt
+	user.UpdatedAt = time.Now()
+	user.DeletedAt = existing.DeletedAt
+	_, err = s.db.Exec(`UPDATE users SET name = ?, email = ?, password = ?, role = ?, task_quota = ?, timezone = ?, active = ?, password_changed_at = ?, updated_at = ? WHERE id = ?`,
+		user.Name, user.Email, user.Password, user.Role, user.TaskQuota, user.Timezone, user.Active, user.PasswordChangedAt, user.UpdatedAt, id)
+	if err != nil {
+		return User{}, userWriteError(err)
+	}
+	return user, nil
+}
+
+func (s *sqliteUserStore) Delete(id string) error {
+	res, err := s.db.Exec(`UPDATE users SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (s *sqliteUserStore) Count() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM users WHERE deleted_at IS NULL`).Scan(&n)
+	return n, err
+}
+
+// sqliteTaskStore keeps tasks in the tasks table
+type sqliteTaskStore struct {
+	db *sql.DB
+}
+
+const taskColumns = `id, user_id, title, description, status, priority, tags, due_date, assignee_id,
+	recurrence, parent_id, blocked_by, archived, created_by, updated_by, color, completed_at, position, version, created_at, updated_at, deleted_at`
+
+func scanTask(row rowScanner) (Task, error) {
+	var (
+		task        Task
+		tags        string
+		blockedBy   string
+		dueDate     sql.NullTime
+		assigneeID  sql.NullString
+		parentID    sql.NullString
+		completedAt sql.NullTime
+		deletedAt   sql.NullTime
+	)
+	err := row.Scan(&task.ID, &task.UserID, &task.Title, &task.Description, &task.Status, &task.Priority,
+		&tags, &dueDate, &assigneeID, &task.Recurrence, &parentID, &blockedBy, &task.Archived, &task.CreatedBy, &task.UpdatedBy, &task.Color, &completedAt, &task.Position, &task.Version, &task.CreatedAt, &task.UpdatedAt, &deletedAt)
+	if err == sql.ErrNoRows {
+		return Task{}, errNotFound
+	}
+	if err != nil {
+		return Task{}, err
+	}
+	if err := json.Unmarshal([]byte(tags), &task.Tags); err != nil {
+		return Task{}, err
+	}
+	if err := json.Unmarshal([]byte(blockedBy), &task.BlockedBy); err != nil {
+		return Task{}, err
+	}
+	task.DueDate = timePtr(dueDate)
+	task.AssigneeID = stringPtr(assigneeID)
+	task.ParentID = stringPtr(parentID)
+	task.CompletedAt = timePtr(completedAt)
+	task.DeletedAt = timePtr(deletedAt)
+	return task, nil
+}
+
+// Convert a nullable column into an optional ID
+func stringPtr(n sql.NullString) *string {
+	if !n.Valid {
+		return nil
+	}
+	return &n.String
+}
+
+// Columns set from the task on both insert and update, in the order taskArgs returns them
+var taskWriteColumns = []string{"user_id", "title", "description", "status", "priority", "tags", "due_date", "assignee_id", "recurrence", "parent_id", "blocked_by", "archived", "created_by", "updated_by", "color", "completed_at", "position"}
+
+func taskArgs(task Task) ([]interface{}, error) {
+	tags, err := encodeTags(task.Tags)
+	if err != nil {
+		return nil, err
+	}
+	blockedBy, err := encodeBlockers(task.BlockedBy)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{task.UserID, task.Title, task.Description, task.Status, task.Priority, tags,
+		task.DueDate, task.AssigneeID, task.Recurrence, task.ParentID, blockedBy, task.Archived, task.CreatedBy, task.UpdatedBy, task.Color, task.CompletedAt, task.Position}, nil
+}
+
+var (
+	insertTaskSQL = `INSERT INTO tasks (id, ` + strings.Join(taskWriteColumns, ", ") + `, version, created_at, updated_at)
+		VALUES (?, ` + strings.Repeat("?, ", len(taskWriteColumns)) + `1, ?, ?)`
+	// Bumps the version, matching only while the stored version is the one the update was based on
+	updateTaskSQL = `UPDATE tasks SET ` + strings.Join(taskWriteColumns, " = ?, ") + ` = ?, version = version + 1, updated_at = ?
+		WHERE id = ? AND version = ?`
+)
+
+// Tags are stored as a JSON array
+func encodeTags(tags []string) (string, error) {
+	if tags == nil {
+		tags = []string{}
+	}
+	b, err := json.Marshal(tags)
+	return string(b), err
+}
+
+// Blocking task IDs are stored as a JSON array too
+func encodeBlockers(ids []string) (string, error) {
+	if ids == nil {
+		ids = []string{}
+	}
+	b, err := json.Marshal(ids)
+	return string(b), err
+}
+
+func (s *sqliteTaskStore) Create(task Task) (Task, error) {
+	return insertTask(s.db, task, time.Now())
+}
+
+func (s *sqliteTaskStore) CreateMany(tasks []Task) ([]Task, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	created := make([]Task, len(tasks))
+	for i, task := range tasks {
+		if created[i], err = insertTask(tx, task, now); err != nil {
+			return nil, err
+		}
+	}
+	return created, tx.Commit()
+}
+
+func insertTask(db execer, task Task, now time.Time) (Task, error) {
+	task.Version = 1
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	task.DeletedAt = nil
+	args, err := taskArgs(task)
+	if err != nil {
+		return Task{}, err
+	}
+	task.ID = newID()
+	args = append([]interface{}{task.ID}, args...)
+	if _, err := db.Exec(insertTaskSQL, append(args, task.CreatedAt, task.UpdatedAt)...); err != nil {
+		return Task{}, err
+	}
+	return task, nil
+}
+
+func (s *sqliteTaskStore) List(ctx context.Context) ([]Task, error) {
+	return s.query(ctx, `SELECT `+taskColumns+` FROM tasks ORDER BY created_at, id`)
+}
+
+func (s *sqliteTaskStore) ListByUser(ctx context.Context, userID, status string) ([]Task, error) {
+	return s.query(ctx, `SELECT `+taskColumns+` FROM tasks WHERE user_id = ? AND (? = '' OR status = ?)
+		ORDER BY created_at, id`, userID, status, status)
+}
+
+func (s *sqliteTaskStore) query(ctx context.Context, query string, args ...interface{}) ([]Task, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, task)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqliteTaskStore) GetByID(id string) (Task, error) {
+	return scanTask(s.db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id))
+}
+
+func (s *sqliteTaskStore) Update(id string, task Task) (Task, error) {
+	return updateTaskRow(s.db, id, task, time.Now())
+}
+
+func (s *sqliteTaskStore) UpdateMany(tasks []Task) ([]Task, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	updated := make([]Task, len(tasks))
+	for i, task := range tasks {
+		if updated[i], err = updateTaskRow(tx, task.ID, task, now); err != nil {
+			return nil, err
+		}
+	}
+	return updated, tx.Commit()
+}
+
+func updateTaskRow(db queryExecer, id string, task Task, now time.Time) (Task, error) {
+	existing, err := scanTask(db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE id = ?`, id))
+	if err != nil {
+		return Task{}, err
+	}
+	task.ID = id
+	task.CreatedAt = existing.CreatedAt
+	task.UpdatedAt = now
+	task.DeletedAt = existing.DeletedAt
+	args, err := taskArgs(task)
+	if err != nil {
+		return Task{}, err
+	}
+	res, err := db.Exec(updateTaskSQL, append(args, task.UpdatedAt, id, task.Version)...)
+	if err != nil {
+		return Task{}, err
+	}
+	// The task exists, so matching no row means its version moved on
+	if err := expectAffected(res); errors.Is(err, errNotFound) {
+		return Task{}, errVersionConflict
+	} else if err != nil {
+		return Task{}, err
+	}
+	task.Version++
+	return task, nil
+}
+
+func (s *sqliteTaskStore) Delete(id string) error {
+	res, err := s.db.Exec(`UPDATE tasks SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+func (s *sqliteTaskStore) Restore(id string) (Task, error) {
+	res, err := s.db.Exec(`UPDATE tasks SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	if err != nil {
+		return Task{}, err
+	}
+	if err := expectAffected(res); err != nil {
+		return Task{}, err
+	}
+	return s.GetByID(id)
+}
+
+func (s *sqliteTaskStore) Count() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM tasks WHERE deleted_at IS NULL`).Scan(&n)
+	return n, err
+}
+
+// sqliteCommentStore keeps comments in the comments table
+type sqliteCommentStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteCommentStore) Create(comment Comment) (Comment, error) {
+	comment.CreatedAt = time.Now()
+	res, err := s.db.Exec(`INSERT INTO comments (task_id, user_id, body, created_at) VALUES (?, ?, ?, ?)`,
+		comment.TaskID, comment.UserID, comment.Body, comment.CreatedAt)
+	if err != nil {
+		return Comment{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Comment{}, err
+	}
+	comment.ID = uint(id)
+	return comment, nil
+}
+
+func (s *sqliteCommentStore) ListByTask(taskID string) ([]Comment, error) {
+	rows, err := s.db.Query(`SELECT id, task_id, user_id, body, created_at FROM comments WHERE task_id = ? ORDER BY id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Comment{}
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(&comment.ID, &comment.TaskID, &comment.UserID, &comment.Body, &comment.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, comment)
+	}
+	return list, rows.Err()
+}
+
+// sqliteHistoryStore keeps status changes in the status_changes table
+type sqliteHistoryStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteHistoryStore) Create(change StatusChange) (StatusChange, error) {
+	change.ChangedAt = time.Now()
+	res, err := s.db.Exec(`INSERT INTO status_changes (task_id, from_status, to_status, changed_by, changed_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		change.TaskID, change.From, change.To, change.ChangedBy, change.ChangedAt)
+	if err != nil {
+		return StatusChange{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return StatusChange{}, err
+	}
+	change.ID = uint(id)
+	return change, nil
+}
+
+func (s *sqliteHistoryStore) ListByTask(taskID string) ([]StatusChange, error) {
+	rows, err := s.db.Query(`SELECT id, task_id, from_status, to_status, changed_by, changed_at
+		FROM status_changes WHERE task_id = ? ORDER BY id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []StatusChange{}
+	for rows.Next() {
+		var change StatusChange
+		if err := rows.Scan(&change.ID, &change.TaskID, &change.From, &change.To, &change.ChangedBy, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, change)
+	}
+	return list, rows.Err()
+}
+
+// sqlitePasswordResetStore keeps pending password resets in the
+// password_resets table, with expiry as Unix nanoseconds. Expired rows are
+// deleted on every Create.
+type sqlitePasswordResetStore struct {
+	db *sql.DB
+}
+
+func (s *sqlitePasswordResetStore) Create(reset passwordReset) error {
+	_, err := s.db.Exec(`DELETE FROM password_resets WHERE user_id = ? OR expires_at <= ?`, reset.UserID, time.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO password_resets (token_hash, user_id, expires_at) VALUES (?, ?, ?)`,
+		reset.TokenHash, reset.UserID, reset.ExpiresAt.UnixNano())
+	return err
+}
+
+func (s *sqlitePasswordResetStore) Consume(tokenHash string) (passwordReset, error) {
+	reset := passwordReset{TokenHash: tokenHash}
+	var expiresAt int64
+	err := s.db.QueryRow(`DELETE FROM password_resets WHERE token_hash = ? RETURNING user_id, expires_at`, tokenHash).
+		Scan(&reset.UserID, &expiresAt)
+	if err == sql.ErrNoRows {
+		return passwordReset{}, errNotFound
+	}
+	if err != nil {
+		return passwordReset{}, err
+	}
+	reset.ExpiresAt = time.Unix(0, expiresAt)
+	if !reset.ExpiresAt.After(time.Now()) {
+		return passwordReset{}, errNotFound
+	}
+	return reset, nil
+}
+
+// sqliteTimeEntryStore keeps time entries in the time_entries table
+type sqliteTimeEntryStore struct {
+	db *sql.DB
+}
+
+const timeEntryColumns = `id, task_id, user_id, started_at, stopped_at`
+
+func scanTimeEntry(row rowScanner) (TimeEntry, error) {
+	var (
+		entry     TimeEntry
+		stoppedAt sql.NullTime
+	)
+	err := row.Scan(&entry.ID, &entry.TaskID, &entry.UserID, &entry.StartedAt, &stoppedAt)
+	entry.StoppedAt = timePtr(stoppedAt)
+	return entry, err
+}
+
+func (s *sqliteTimeEntryStore) Start(entry TimeEntry) (TimeEntry, error) {
+	entry.StartedAt = time.Now()
+	entry.StoppedAt = nil
+	res, err := s.db.Exec(`INSERT INTO time_entries (task_id, user_id, started_at) VALUES (?, ?, ?)`,
+		entry.TaskID, entry.UserID, entry.StartedAt)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed: time_entries.task_id") {
+		return TimeEntry{}, errTimerRunning
+	}
+	if err != nil {
+		return TimeEntry{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return TimeEntry{}, err
+	}
+	entry.ID = uint(id)
+	return entry, nil
+}
+
+func (s *sqliteTimeEntryStore) Stop(taskID string) (TimeEntry, error) {
+	entry, err := scanTimeEntry(s.db.QueryRow(`UPDATE time_entries SET stopped_at = ?
+		WHERE task_id = ? AND stopped_at IS NULL RETURNING `+timeEntryColumns, time.Now(), taskID))
+	if err == sql.ErrNoRows {
+		return TimeEntry{}, errTimerNotRunning
+	}
+	return entry, err
+}
+
+func (s *sqliteTimeEntryStore) ListByTask(taskID string) ([]TimeEntry, error) {
+	rows, err := s.db.Query(`SELECT `+timeEntryColumns+` FROM time_entries WHERE task_id = ? ORDER BY id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []TimeEntry{}
+	for rows.Next() {
+		entry, err := scanTimeEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, entry)
+	}
+	return list, rows.Err()
+}
+
+// sqliteAttachmentStore keeps attachment metadata in the attachments table
+type sqliteAttachmentStore struct {
+	db *sql.DB
+}
+
+const attachmentColumns = `id, task_id, user_id, filename, content_type, size, created_at`
+
+func scanAttachment(row rowScanner) (Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.ID, &a.TaskID, &a.UserID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return Attachment{}, errNotFound
+	}
+	return a, err
+}
+
+func (s *sqliteAttachmentStore) Create(a Attachment) (Attachment, error) {
+	a.CreatedAt = time.Now()
+	_, err := s.db.Exec(`INSERT INTO attachments (`+attachmentColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.TaskID, a.UserID, a.Filename, a.ContentType, a.Size, a.CreatedAt)
+	if err != nil {
+		return Attachment{}, err
+	}
+	return a, nil
+}
+
+func (s *sqliteAttachmentStore) ListByTask(taskID string) ([]Attachment, error) {
+	rows, err := s.db.Query(`SELECT `+attachmentColumns+` FROM attachments WHERE task_id = ? ORDER BY created_at, id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqliteAttachmentStore) GetByID(id string) (Attachment, error) {
+	return scanAttachment(s.db.QueryRow(`SELECT `+attachmentColumns+` FROM attachments WHERE id = ?`, id))
+}
+
+// sqliteAuditStore keeps the audit log in the audit_log table, with each
+// entry's changes as a JSON object
+type sqliteAuditStore struct {
+	db *sql.DB
+}
+
+func (s *sqliteAuditStore) Create(entry AuditEntry) (AuditEntry, error) {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	entry.CreatedAt = time.Now()
+	res, err := s.db.Exec(`INSERT INTO audit_log (actor_id, action, resource_type, resource_id, changes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.ActorID, entry.Action, entry.ResourceType, entry.ResourceID, string(changes), entry.CreatedAt)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	entry.ID = uint(id)
+	return entry, nil
+}
+
+func (s *sqliteAuditStore) List(ctx context.Context, filter auditFilter) ([]AuditEntry, error) {
+	query := `SELECT id, actor_id, action, resource_type, resource_id, changes, created_at FROM audit_log WHERE 1 = 1`
+	var args []interface{}
+	if filter.ActorID != "" {
+		query += ` AND actor_id = ?`
+		args = append(args, filter.ActorID)
+	}
+	if filter.ResourceType != "" {
+		query += ` AND resource_type = ?`
+		args = append(args, filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		query += ` AND resource_id = ?`
+		args = append(args, filter.ResourceID)
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []AuditEntry{}
+	for rows.Next() {
+		var (
+			entry   AuditEntry
+			actorID sql.NullString
+			changes string
+		)
+		if err := rows.Scan(&entry.ID, &actorID, &entry.Action, &entry.ResourceType, &entry.ResourceID, &changes, &entry.CreatedAt); err != nil {
+			return nil, err
+		}
+		entry.ActorID = stringPtr(actorID)
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		list = append(list, entry)
+	}
+	return list, rows.Err()
+}
+
+// Turn a write that touched no rows into errNotFound
+func expectAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// sqliteWebhookStore keeps webhooks in the webhooks table
+type sqliteWebhookStore struct {
+	db *sql.DB
+}
+
+const webhookColumns = `id, user_id, url, secret, created_at`
+
+func scanWebhook(row rowScanner) (Webhook, error) {
+	var hook Webhook
+	err := row.Scan(&hook.ID, &hook.UserID, &hook.URL, &hook.Secret, &hook.CreatedAt)
+	if err == sql.ErrNoRows {
+		return Webhook{}, errNotFound
+	}
+	return hook, err
+}
+
+func (s *sqliteWebhookStore) Create(hook Webhook) (Webhook, error) {
+	hook.ID = newID()
+	hook.CreatedAt = time.Now()
+	_, err := s.db.Exec(`INSERT INTO webhooks (id, user_id, url, secret, created_at) VALUES (?, ?, ?, ?, ?)`,
+		hook.ID, hook.UserID, hook.URL, hook.Secret, hook.CreatedAt)
+	if err != nil {
+		return Webhook{}, err
+	}
+	return hook, nil
+}
+
+func (s *sqliteWebhookStore) ListByUser(userID string) ([]Webhook, error) {
+	rows, err := s.db.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE user_id = ? ORDER BY created_at, rowid`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, hook)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqliteWebhookStore) GetByID(id string) (Webhook, error) {
+	return scanWebhook(s.db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, id))
+}
+
+func (s *sqliteWebhookStore) Delete(id string) error {
+	res, err := s.db.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res)
+}
+
+// sqliteIdempotencyStore keeps idempotency records in the idempotency_keys table,
+// with expiry as Unix nanoseconds so it compares numerically. Expired rows are
+// deleted on every Save. Keys are locked in memory, as one process serves the file.
+type sqliteIdempotencyStore struct {
+	db    *sql.DB
+	locks keyedMutex
+}
+
+func (s *sqliteIdempotencyStore) Lock(_ context.Context, userID, key string) (func(), error) {
+	return s.locks.lock(userID + ":" + key), nil
+}
+
+func (s *sqliteIdempotencyStore) Get(userID, key string) (idempotencyRecord, error) {
+	record := idempotencyRecord{UserID: userID, Key: key}
+	var expiresAt int64
+	err := s.db.QueryRow(`SELECT request_hash, status, body, expires_at FROM idempotency_keys
+		WHERE user_id = ? AND key = ? AND expires_at > ?`, userID, key, time.Now().UnixNano()).
+		Scan(&record.RequestHash, &record.Status, &record.Body, &expiresAt)
+	if err == sql.ErrNoRows {
+		return idempotencyRecord{}, errNotFound
+	}
+	record.ExpiresAt = time.Unix(0, expiresAt)
+	return record, err
+}
+
+func (s *sqliteIdempotencyStore) Save(record idempotencyRecord) error {
+	if _, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= ?`, time.Now().UnixNano()); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO idempotency_keys (user_id, key, request_hash, status, body, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		record.UserID, record.Key, record.RequestHash, record.Status, record.Body, record.ExpiresAt.UnixNano())
+	return err
+}
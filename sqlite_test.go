@@ -0,0 +1,298 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConcurrentWritesAreAllApplied(t *testing.T) {
+	const n = 100
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			status, body := srv.do(http.MethodPost, "/v1/tasks", token, gin.H{"title": fmt.Sprintf("Task %d", i)})
+			if status != http.StatusCreated {
+				t.Errorf("create status = %d, want 201; body %s", status, body)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var list taskPage
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks?limit=100", token, nil, &list)
+	if list.Total != n {
+		t.Fatalf("got %d tasks, want %d", list.Total, n)
+	}
+	ids := map[string]bool{}
+	for _, task := range list.Data {
+		ids[task.ID] = true
+	}
+	if len(ids) != n {
+		t.Errorf("got %d distinct task IDs, want %d", len(ids), n)
+	}
+
+	// Delete half of them at once
+	for _, task := range list.Data[:n/2] {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if status, body := srv.do(http.MethodDelete, "/v1/tasks/"+id, token, nil); status != http.StatusOK {
+				t.Errorf("delete status = %d, want 200; body %s", status, body)
+			}
+		}(task.ID)
+	}
+	wg.Wait()
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks", token, nil, &list)
+	if list.Total != n-n/2 {
+		t.Errorf("got %d tasks after deleting %d, want %d", list.Total, n/2, n-n/2)
+	}
+}
+
+func TestRecordsSurviveARestart(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tasks.db")
+	srv := newTestServerAt(t, dbPath)
+	user, token := srv.signup("Ada", "ada@example.com")
+	task := srv.createTask(token, gin.H{"title": "Persisted", "priority": PriorityHigh, "tags": []string{"home"}})
+	srv.stop()
+
+	srv = newTestServerAt(t, dbPath)
+	var stored Task
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+task.ID, srv.login(user.Email), nil, &stored)
+	if stored.Title != task.Title || stored.Priority != task.Priority || !equalStrings(stored.Tags, task.Tags) || !stored.CreatedAt.Equal(task.CreatedAt) {
+		t.Errorf("task after a restart = %+v, want %+v", stored, task)
+	}
+}
+
+func TestMigrationsOnlyRunOnce(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tasks.db")
+	for i := 0; i < 2; i++ {
+		db, err := openSQLite(dbPath)
+		if err != nil {
+			t.Fatalf("open %d: %v", i+1, err)
+		}
+		var version int
+		if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+			t.Fatal(err)
+		}
+		db.Close()
+		if version != len(migrations) {
+			t.Errorf("open %d: user_version = %d, want %d", i+1, version, len(migrations))
+		}
+	}
+}
+
+// Create a database at path with the schema as it was before the first
+// migration whose SQL starts with prefix
+func createLegacyDatabase(t *testing.T, path, prefix string) *sql.DB {
+	t.Helper()
+	version := -1
+	for i, m := range migrations {
+		if strings.HasPrefix(m, prefix) {
+			version = i
+			break
+		}
+	}
+	if version < 0 {
+		t.Fatalf("no migration starts with %q", prefix)
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for _, m := range migrations[:version] {
+		if _, err := db.Exec(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestIntegerIDsMigrateToUUIDs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tasks.db")
+	db := createLegacyDatabase(t, dbPath, "CREATE TABLE legacy_user_ids")
+	password, err := hashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, stmt := range []struct {
+		sql  string
+		args []interface{}
+	}{
+		{`INSERT INTO users (id, name, email, password, created_at, updated_at) VALUES
+			(1, 'Ada', 'ada@example.com', ?, ?, ?), (2, 'Grace', 'grace@example.com', ?, ?, ?)`,
+			[]interface{}{password, now, now, password, now, now}},
+		{`INSERT INTO tasks (id, user_id, title, description, status, priority, tags, created_by, updated_by, created_at, updated_at)
+			VALUES (1, 1, 'Parent', '', 'todo', 'medium', '[]', 1, 1, ?, ?)`, []interface{}{now, now}},
+		{`INSERT INTO tasks (id, user_id, title, description, status, priority, tags, assignee_id, parent_id, blocked_by,
+			created_by, updated_by, created_at, updated_at)
+			VALUES (2, 1, 'Child', '', 'in_progress', 'high', '["home"]', 2, 1, '[1]', 1, 2, ?, ?)`, []interface{}{now, now}},
+		{`INSERT INTO comments (task_id, user_id, body, created_at) VALUES (2, 2, 'On it', ?)`, []interface{}{now}},
+		{`INSERT INTO status_changes (task_id, from_status, to_status, changed_by, changed_at)
+			VALUES (2, 'todo', 'in_progress', 2, ?)`, []interface{}{now}},
+	} {
+		if _, err := db.Exec(stmt.sql, stmt.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	srv := newTestServerAt(t, dbPath)
+	token := srv.login("ada@example.com")
+	var grace User
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/me", srv.login("grace@example.com"), nil, &grace)
+
+	var list taskPage
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks?sort=created_at&order=asc", token, nil, &list)
+	if len(list.Data) != 2 {
+		t.Fatalf("got %d tasks after the migration, want 2", len(list.Data))
+	}
+	parent, child := list.Data[0], list.Data[1]
+	if parent.Title != "Parent" {
+		parent, child = child, parent
+	}
+	if _, ok := parseUUID(child.ID); !ok {
+		t.Errorf("migrated task ID %q is not a UUID", child.ID)
+	}
+	if child.ParentID == nil || *child.ParentID != parent.ID {
+		t.Errorf("child parent_id = %v, want %s", child.ParentID, parent.ID)
+	}
+	if !equalStrings(child.BlockedBy, []string{parent.ID}) {
+		t.Errorf("child blocked_by = %q, want [%s]", child.BlockedBy, parent.ID)
+	}
+	if child.AssigneeID == nil || *child.AssigneeID != grace.ID || child.UpdatedBy != grace.ID || child.CreatedBy != parent.UserID {
+		t.Errorf("child assignee, created_by and updated_by = %v, %s, %s; want Grace (%s) and Ada (%s)",
+			child.AssigneeID, child.CreatedBy, child.UpdatedBy, grace.ID, parent.UserID)
+	}
+
+	var comments []Comment
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+child.ID+"/comments", token, nil, &comments)
+	if len(comments) != 1 || comments[0].TaskID != child.ID || comments[0].UserID != grace.ID {
+		t.Errorf("comments after the migration = %+v, want Grace's comment on the child", comments)
+	}
+	var history []StatusChange
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+child.ID+"/history", token, nil, &history)
+	if len(history) != 1 || history[0].TaskID != child.ID || history[0].ChangedBy != grace.ID {
+		t.Errorf("history after the migration = %+v, want Grace's change to the child", history)
+	}
+}
+
+func TestOwnerlessTasksStopTheUUIDMigration(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tasks.db")
+	db := createLegacyDatabase(t, dbPath, "CREATE TABLE legacy_user_ids")
+	now := time.Now()
+	// The owners of these tasks were deleted before deletes were soft
+	for _, id := range []int{3, 1} {
+		if _, err := db.Exec(`INSERT INTO tasks (id, user_id, title, description, status, priority, tags, created_by, updated_by, created_at, updated_at)
+			VALUES (?, 9, 'Orphan', '', 'todo', 'medium', '[]', 9, 9, ?, ?)`, id, now, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	_, err := openSQLite(dbPath)
+	if err == nil || !strings.Contains(err.Error(), "tasks 1, 3 belong to users that no longer exist") {
+		t.Fatalf("migrating tasks without an owner: error = %v, want one naming tasks 1 and 3", err)
+	}
+	db, err = sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var after int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&after); err != nil {
+		t.Fatal(err)
+	}
+	if after != version {
+		t.Errorf("user_version = %d after the refused migration, want it left at %d", after, version)
+	}
+	// Following the advice lets the migration through
+	if _, err := db.Exec(`DELETE FROM tasks WHERE id IN (1, 3)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	db, err = openSQLite(dbPath)
+	if err != nil {
+		t.Fatalf("migrating once the ownerless tasks are gone: %v", err)
+	}
+	db.Close()
+}
+
+func TestReferencingColumnsAreText(t *testing.T) {
+	db, err := openSQLite(filepath.Join(t.TempDir(), "tasks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for table, columns := range map[string][]string{
+		"comments":         {"task_id", "user_id"},
+		"status_changes":   {"task_id", "changed_by"},
+		"webhooks":         {"user_id"},
+		"attachments":      {"task_id", "user_id"},
+		"idempotency_keys": {"user_id"},
+		"audit_log":        {"actor_id", "resource_id"},
+	} {
+		for _, column := range columns {
+			var typ string
+			err := db.QueryRow(`SELECT type FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&typ)
+			if err != nil {
+				t.Fatalf("%s.%s: %v", table, column, err)
+			}
+			if typ != "TEXT" {
+				t.Errorf("%s.%s is %s, want TEXT", table, column, typ)
+			}
+		}
+	}
+}
+
+func TestWebhooksMigrateToUUIDs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "tasks.db")
+	db := createLegacyDatabase(t, dbPath, "CREATE TABLE webhooks_v3")
+	password, err := hashPassword(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ada := newID()
+	if _, err := db.Exec(`INSERT INTO users (id, name, email, password, created_at, updated_at)
+		VALUES (?, 'Ada', 'ada@example.com', ?, ?, ?)`, ada, password, now, now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO webhooks (id, user_id, url, secret, created_at)
+		VALUES (1, ?, 'https://example.com/hooks', 'secret', ?)`, ada, now); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	srv := newTestServerAt(t, dbPath)
+	token := srv.login("ada@example.com")
+	var list []Webhook
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/webhooks", token, nil, &list)
+	if len(list) != 1 || list[0].URL != "https://example.com/hooks" {
+		t.Fatalf("webhooks after the migration = %+v, want Ada's", list)
+	}
+	if _, ok := parseUUID(list[0].ID); !ok {
+		t.Errorf("migrated webhook ID %q is not a UUID", list[0].ID)
+	}
+	srv.expect(http.StatusOK, http.MethodDelete, "/v1/webhooks/"+list[0].ID, token, nil, nil)
+}
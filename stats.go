@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Summary of the caller's tasks for dashboards
+type taskStats struct {
+	// Every known status appears, with zero when no task has it
+	ByStatus map[string]int `json:"by_status"`
+	Overdue  int            `json:"overdue"`
+	Total    int            `json:"total"`
+}
+
+// Summarize the caller's tasks by status, along with how many are overdue
+func getTaskStats(c *gin.Context) {
+	list, ok := listOwnedTasks(c)
+	if !ok {
+		return
+	}
+	stats := taskStats{ByStatus: make(map[string]int, len(validStatuses)), Total: len(list)}
+	for _, status := range validStatuses {
+		stats.ByStatus[status] = 0
+	}
+	now := time.Now()
+	for _, task := range list {
+		stats.ByStatus[task.Status]++
+		if isOverdue(task, now) {
+			stats.Overdue++
+		}
+	}
+	c.JSON(http.StatusOK, stats)
+}
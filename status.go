@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// Task statuses
+const (
+	StatusTodo       = "todo"
+	StatusInProgress = "in_progress"
+	StatusDone       = "done"
+	StatusCancelled  = "cancelled"
+)
+
+// Every status a task may be in, in lifecycle order
+var validStatuses = []string{StatusTodo, StatusInProgress, StatusDone, StatusCancelled}
+
+func isValidStatus(status string) bool {
+	for _, s := range validStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Error message shared by handlers that reject a status
+func invalidStatusMessage(status string) string {
+	return "Invalid status \"" + status + "\": must be one of " + strings.Join(validStatuses, ", ")
+}
+
+// Allowed next states for each status. Staying in the same status is always allowed.
+// Done tasks can only be cancelled, and cancelled is terminal.
+var statusTransitions = map[string][]string{
+	StatusTodo:       {StatusInProgress, StatusDone, StatusCancelled},
+	StatusInProgress: {StatusTodo, StatusDone, StatusCancelled},
+	StatusDone:       {StatusCancelled},
+	StatusCancelled:  {},
+}
+
+func canTransition(from, to string) bool {
+	if from == to {
+		return true
+	}
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Keep CompletedAt in step with a task's status after it changed from the given
+// one: set it when the task becomes done and clear it when the task isn't done
+func trackCompletion(task *Task, from string) {
+	switch {
+	case task.Status != StatusDone:
+		task.CompletedAt = nil
+	case from != StatusDone || task.CompletedAt == nil:
+		now := time.Now()
+		task.CompletedAt = &now
+	}
+}
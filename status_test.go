@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDoneTasksCannotGoBackInProgress(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	task := srv.createTask(token, gin.H{"title": "Task"})
+	path := "/v1/tasks/" + task.ID
+	srv.expect(http.StatusOK, http.MethodPut, path, token, gin.H{"title": "Task", "status": StatusDone}, nil)
+
+	status, body := srv.do(http.MethodPut, path, token, gin.H{"title": "Task", "status": StatusInProgress})
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("done to in_progress: status = %d, want 422; body %s", status, body)
+	}
+	refused := responseError(t, body)
+	if refused.Code != codeInvalidTransition || refused.Details["from"] != StatusDone || refused.Details["to"] != StatusInProgress {
+		t.Errorf("refused transition = %+v, want INVALID_TRANSITION from done to in_progress", refused)
+	}
+
+	var stored Task
+	srv.expect(http.StatusOK, http.MethodGet, path, token, nil, &stored)
+	if stored.Status != StatusDone {
+		t.Errorf("refused update left the task %s, want it still done", stored.Status)
+	}
+	// Cancelling is still allowed
+	srv.expect(http.StatusOK, http.MethodPut, path, token, gin.H{"title": "Task", "status": StatusCancelled}, nil)
+}
+
+func TestCompletedAtFollowsTheStatus(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	task := srv.createTask(token, gin.H{"title": "Task"})
+	if task.CompletedAt != nil {
+		t.Fatalf("new task completed_at = %v, want null", task.CompletedAt)
+	}
+	path := "/v1/tasks/" + task.ID
+
+	before := time.Now()
+	var done Task
+	srv.expect(http.StatusOK, http.MethodPatch, path, token, gin.H{"status": StatusDone}, &done)
+	if done.CompletedAt == nil || done.CompletedAt.Before(before) || done.CompletedAt.After(time.Now()) {
+		t.Fatalf("completed_at after moving to done = %v, want the time of the update", done.CompletedAt)
+	}
+
+	// Saving a task that stays done keeps the time it was finished
+	var edited Task
+	srv.expect(http.StatusOK, http.MethodPut, path, token, gin.H{"title": "Renamed", "status": StatusDone}, &edited)
+	if edited.CompletedAt == nil || !edited.CompletedAt.Equal(*done.CompletedAt) {
+		t.Errorf("completed_at after an edit = %v, want it left at %v", edited.CompletedAt, done.CompletedAt)
+	}
+
+	var cancelled Task
+	srv.expect(http.StatusOK, http.MethodPatch, path, token, gin.H{"status": StatusCancelled}, &cancelled)
+	if cancelled.CompletedAt != nil {
+		t.Errorf("completed_at after moving out of done = %v, want null", cancelled.CompletedAt)
+	}
+}
+
+func TestFilterByCompletionTime(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	finished := srv.createTask(token, gin.H{"title": "Finished"})
+	srv.createTask(token, gin.H{"title": "Open"})
+	srv.expect(http.StatusOK, http.MethodPut, "/v1/tasks/"+finished.ID, token, gin.H{"title": "Finished", "status": StatusDone}, nil)
+
+	hourAgo := url.QueryEscape(time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+	if got := listedTitles(srv, token, "/v1/tasks?completed_after="+hourAgo); !equalStrings(got, []string{"Finished"}) {
+		t.Errorf("?completed_after an hour ago: got %q, want only the finished task", got)
+	}
+	if got := listedTitles(srv, token, "/v1/tasks?completed_before="+hourAgo); len(got) != 0 {
+		t.Errorf("?completed_before an hour ago: got %q, want none", got)
+	}
+}
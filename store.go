@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by the stores
+var (
+	errNotFound   = errors.New("record not found")
+	errEmailTaken = errors.New("email already in use")
+	// A task update was based on a version that is no longer current
+	errVersionConflict = errors.New("version conflict")
+	// A task's timer was started while running or stopped while not
+	errTimerRunning    = errors.New("timer already running")
+	errTimerNotRunning = errors.New("timer not running")
+)
+
+// Generate the ID of a new user or task. IDs are random UUIDs, so they
+// reveal nothing about how many records exist and can't be guessed.
+func newID() string {
+	return uuid.NewString()
+}
+
+// userRecord is a user along with the password hash the User JSON leaves
+// out, for stores that keep users as JSON
+type userRecord struct {
+	User
+	Password string `json:"password"`
+	// Active is missing from records written before users could be
+	// deactivated, whose users are all active
+	Active            *bool      `json:"active"`
+	PasswordChangedAt *time.Time `json:"password_changed_at"`
+}
+
+func newUserRecord(user User) userRecord {
+	return userRecord{User: user, Password: user.Password, Active: &user.Active, PasswordChangedAt: user.PasswordChangedAt}
+}
+
+// The user the record holds
+func (r userRecord) toUser() User {
+	user := r.User
+	user.Password = r.Password
+	user.Active = r.Active == nil || *r.Active
+	user.PasswordChangedAt = r.PasswordChangedAt
+	return user
+}
+
+// Store methods that scan many records take the request's context and give
+// up once it is done, so a request that timed out stops waiting on them.
+
+// UserStore persists users. Lookups of missing users return errNotFound,
+// and writes that would duplicate an email return errEmailTaken.
+// Delete is a soft delete: the user keeps its record, email included, with
+// DeletedAt set. Lookups and List still return soft-deleted users; Count does not.
+type UserStore interface {
+	Create(user User) (User, error)
+	List(ctx context.Context) ([]User, error)
+	GetByID(id string) (User, error)
+	GetByEmail(email string) (User, error)
+	Update(id string, user User) (User, error)
+	Delete(id string) error
+	Count() (int, error)
+}
+
+// TaskStore persists tasks. Lookups of missing tasks return errNotFound.
+// Delete is a soft delete that Restore undoes; deleting an already deleted
+// task, or restoring one that isn't, returns errNotFound. Lookups and List
+// still return soft-deleted tasks; Count does not. Update never changes DeletedAt.
+// Update only applies when task.Version matches the stored version, returning
+// errVersionConflict otherwise, and stores the task with its version incremented.
+type TaskStore interface {
+	Create(task Task) (Task, error)
+	// CreateMany creates all of the tasks or none of them
+	CreateMany(tasks []Task) ([]Task, error)
+	List(ctx context.Context) ([]Task, error)
+	// ListByUser returns a user's tasks in List's order, only those in status
+	// unless it is empty. Stores index tasks by owner and status to make it cheap.
+	ListByUser(ctx context.Context, userID, status string) ([]Task, error)
+	GetByID(id string) (Task, error)
+	Update(id string, task Task) (Task, error)
+	// UpdateMany updates all of the tasks, identified by their IDs, or none of
+	// them, failing like Update does when any one of them would
+	UpdateMany(tasks []Task) ([]Task, error)
+	Delete(id string) error
+	Restore(id string) (Task, error)
+	Count() (int, error)
+}
+
+// CommentStore persists task comments
+type CommentStore interface {
+	Create(comment Comment) (Comment, error)
+	// ListByTask returns the task's comments, oldest first
+	ListByTask(taskID string) ([]Comment, error)
+}
+
+// HistoryStore persists the status changes of tasks
+type HistoryStore interface {
+	Create(change StatusChange) (StatusChange, error)
+	// ListByTask returns the task's changes in the order they happened
+	ListByTask(taskID string) ([]StatusChange, error)
+}
+
+// WebhookStore persists webhook registrations. Lookups and deletes of
+// missing webhooks return errNotFound; Delete removes the record for good.
+type WebhookStore interface {
+	Create(hook Webhook) (Webhook, error)
+	ListByUser(userID string) ([]Webhook, error)
+	GetByID(id string) (Webhook, error)
+	Delete(id string) error
+}
+
+// IdempotencyStore remembers the responses to requests sent with an
+// Idempotency-Key. Get returns errNotFound for unknown and expired keys;
+// Save replaces any record already stored for the user and key.
+type IdempotencyStore interface {
+	Get(userID, key string) (idempotencyRecord, error)
+	Save(record idempotencyRecord) error
+	// Lock holds the user's key, waiting while another request holds it,
+	// until the returned function is called. It gives up once ctx is done.
+	Lock(ctx context.Context, userID, key string) (func(), error)
+}
+
+// AttachmentStore persists the metadata of task attachments. Lookups of
+// missing attachments return errNotFound.
+type AttachmentStore interface {
+	Create(attachment Attachment) (Attachment, error)
+	// ListByTask returns the task's attachments, oldest first
+	ListByTask(taskID string) ([]Attachment, error)
+	GetByID(id string) (Attachment, error)
+}
+
+// PasswordResetStore persists pending password resets. Create replaces any
+// reset already pending for the user. Consume removes the reset and returns
+// it, so each token works once; unknown and expired tokens return errNotFound.
+type PasswordResetStore interface {
+	Create(reset passwordReset) error
+	Consume(tokenHash string) (passwordReset, error)
+}
+
+// TimeEntryStore persists the time tracked against tasks. Start returns
+// errTimerRunning when the task already has a running entry, and Stop
+// returns errTimerNotRunning when it has none.
+type TimeEntryStore interface {
+	Start(entry TimeEntry) (TimeEntry, error)
+	// Stop ends the task's running entry and returns it
+	Stop(taskID string) (TimeEntry, error)
+	// ListByTask returns the task's entries, oldest first
+	ListByTask(taskID string) ([]TimeEntry, error)
+}
+
+// AuditStore is the append-only audit log; entries are never changed or removed
+type AuditStore interface {
+	Create(entry AuditEntry) (AuditEntry, error)
+	// List returns the matching entries in the order they were recorded
+	List(ctx context.Context, filter auditFilter) ([]AuditEntry, error)
+}
+
+// The set of stores backing the handlers
+type storage struct {
+	users       UserStore
+	tasks       TaskStore
+	comments    CommentStore
+	history     HistoryStore
+	webhooks    WebhookStore
+	idempotency IdempotencyStore
+	audit       AuditStore
+	attachments AttachmentStore
+	timeEntries TimeEntryStore
+	resets      PasswordResetStore
+	revocations RevocationStore
+	// loginFailures backs the login lockout; see lockout.go
+	loginFailures LoginFailureStore
+	// close releases any resources the stores hold
+	close func() error
+}
+
+// Read STORAGE, "memory" (the default), "sqlite" or "redis", and DATABASE_PATH,
+// the file sqlite keeps its data in
+func storageSettings() (kind, dbPath string, err error) {
+	kind = os.Getenv("STORAGE")
+	if kind == "" {
+		kind = "memory"
+	}
+	if kind != "memory" && kind != "sqlite" && kind != "redis" {
+		return "", "", fmt.Errorf("STORAGE %q must be memory, sqlite or redis", kind)
+	}
+	dbPath = os.Getenv("DATABASE_PATH")
+	if dbPath == "" {
+		dbPath = "tasks.db"
+	}
+	return kind, dbPath, nil
+}
+
+// Build the stores of the given kind. Memory stores keep their users and
+// tasks in a snapshot file when snapshots.path is set; see snapshot.go.
+// Redis holds everything, so that several instances can share it; see redis.go.
+func openStores(kind, dbPath string, snapshots snapshotConfig, redisCfg redisConfig) (*storage, error) {
+	switch kind {
+	case "memory":
+		userStore, taskStore := &memoryUserStore{}, &memoryTaskStore{}
+		stores := &storage{
+			users:         userStore,
+			tasks:         taskStore,
+			comments:      &memoryCommentStore{},
+			history:       &memoryHistoryStore{},
+			webhooks:      &memoryWebhookStore{},
+			idempotency:   &memoryIdempotencyStore{},
+			audit:         &memoryAuditStore{},
+			attachments:   &memoryAttachmentStore{},
+			timeEntries:   &memoryTimeEntryStore{},
+			resets:        &memoryPasswordResetStore{},
+			revocations:   &revocationList{},
+			loginFailures: &memoryLoginFailureStore{},
+			close:         func() error { return nil },
+		}
+		if snapshots.path != "" {
+			stores.close = startSnapshots(snapshots, userStore, taskStore).close
+		}
+		return stores, nil
+	case "sqlite":
+		db, err := openSQLite(dbPath)
+		if err != nil {
+			return nil, fmt.Errorf("open database %s: %w", dbPath, err)
+		}
+		return &storage{
+			users:       &sqliteUserStore{db: db},
+			tasks:       &sqliteTaskStore{db: db},
+			comments:    &sqliteCommentStore{db: db},
+			history:     &sqliteHistoryStore{db: db},
+			webhooks:    &sqliteWebhookStore{db: db},
+			idempotency: &sqliteIdempotencyStore{db: db},
+			audit:       &sqliteAuditStore{db: db},
+			attachments: &sqliteAttachmentStore{db: db},
+			timeEntries: &sqliteTimeEntryStore{db: db},
+			resets:      &sqlitePasswordResetStore{db: db},
+			// One process serves the file, so it can keep these in memory
+			revocations:   &revocationList{},
+			loginFailures: &memoryLoginFailureStore{},
+			close:         db.Close,
+		}, nil
+	case "redis":
+		db, err := openRedis(redisCfg)
+		if err != nil {
+			return nil, fmt.Errorf("connect to redis at %s: %w", redisCfg.addr, err)
+		}
+		return &storage{
+			users:         &redisUserStore{db: db},
+			tasks:         &redisTaskStore{db: db},
+			comments:      &redisCommentStore{db: db},
+			history:       &redisHistoryStore{db: db},
+			webhooks:      &redisWebhookStore{db: db},
+			idempotency:   &redisIdempotencyStore{db: db},
+			audit:         &redisAuditStore{db: db},
+			attachments:   &redisAttachmentStore{db: db},
+			timeEntries:   &redisTimeEntryStore{db: db},
+			resets:        &redisPasswordResetStore{db: db},
+			revocations:   &redisRevocationStore{db: db},
+			loginFailures: &redisLoginFailureStore{db: db},
+			close:         db.Close,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q", kind)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check that a task may hang under parentID: the parent must be a live task of the
+// same owner, and taskID (zero for a task not yet created) must not be among its ancestors.
+// Returns the HTTP status and message for a rejected parent, or a store error.
+func parentProblem(taskID, ownerID string, parentID *string) (int, string, error) {
+	if parentID == nil {
+		return 0, "", nil
+	}
+	parent, err := tasks.GetByID(*parentID)
+	if errors.Is(err, errNotFound) || (err == nil && (parent.DeletedAt != nil || parent.UserID != ownerID)) {
+		return http.StatusNotFound, "Parent task not found", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	// Walk up the tree; seen guards against cycles already in the data
+	seen := map[string]bool{}
+	for ancestor := &parent; ancestor != nil && !seen[ancestor.ID]; {
+		if taskID != "" && ancestor.ID == taskID {
+			return http.StatusBadRequest, "A task cannot be its own ancestor", nil
+		}
+		seen[ancestor.ID] = true
+		if ancestor.ParentID == nil {
+			break
+		}
+		next, err := tasks.GetByID(*ancestor.ParentID)
+		if errors.Is(err, errNotFound) {
+			break
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		ancestor = &next
+	}
+	return 0, "", nil
+}
+
+// Respond to a rejected parent. On failure the error response has already been written.
+func checkParent(c *gin.Context, taskID, ownerID string, parentID *string) bool {
+	status, message, err := parentProblem(taskID, ownerID, parentID)
+	if err != nil {
+		respondStoreError(c, err, "Parent task not found")
+		return false
+	}
+	if status == http.StatusBadRequest {
+		respondFieldError(c, "parent_id", message)
+		return false
+	}
+	if status != 0 {
+		respondError(c, status, codeNotFound, message)
+		return false
+	}
+	return true
+}
+
+// Get the live direct children of a task
+func childrenOf(ctx context.Context, id string) ([]Task, error) {
+	list, err := tasks.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filterTasks(list, func(task Task) bool {
+		return task.DeletedAt == nil && task.ParentID != nil && *task.ParentID == id
+	}), nil
+}
+
+// List every live descendant of a task, deepest first
+func liveDescendants(ctx context.Context, id string) ([]Task, error) {
+	children, err := childrenOf(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	var descendants []Task
+	for _, child := range children {
+		below, err := liveDescendants(ctx, child.ID)
+		if err != nil {
+			return nil, err
+		}
+		descendants = append(append(descendants, below...), child)
+	}
+	return descendants, nil
+}
+
+// Soft-delete every live descendant of a task, deepest first
+func deleteDescendants(c *gin.Context, id string) error {
+	descendants, err := liveDescendants(c.Request.Context(), id)
+	if err != nil {
+		return err
+	}
+	for _, task := range descendants {
+		if err := tasks.Delete(task.ID); err != nil {
+			return err
+		}
+		recordAudit(c, AuditDelete, AuditResourceTask, task.ID, task, nil)
+		notifyTaskEvent(EventTaskDeleted, task)
+	}
+	return nil
+}
+
+// List a task's direct subtasks
+func getSubtasks(c *gin.Context) {
+	task, ok := loadVisibleTask(c, false)
+	if !ok {
+		return
+	}
+	children, err := childrenOf(c.Request.Context(), task.ID)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	c.JSON(http.StatusOK, children)
+}
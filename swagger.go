@@ -0,0 +1,37 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed docs/openapi.yaml
+var openAPISpec []byte
+
+// Swagger UI page loading the spec served next to it
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Task API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "openapi.yaml", dom_id: "#swagger-ui"});</script>
+</body>
+</html>`
+
+// Serve the OpenAPI document and a Swagger UI for it under /swagger/
+func swagger(c *gin.Context) {
+	switch c.Param("any") {
+	case "/", "/index.html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUI))
+	case "/openapi.yaml":
+		c.Data(http.StatusOK, "application/yaml", openAPISpec)
+	default:
+		respondError(c, http.StatusNotFound, codeNotFound, "Not found")
+	}
+}
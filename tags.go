@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// Lowercase and dedupe tags, keeping their first-seen order. Blank tags are rejected.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, errors.New("Tags must not be empty")
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized, nil
+}
+
+// Report whether the task carries every one of the wanted tags
+func hasAllTags(task Task, wanted []string) bool {
+	for _, want := range wanted {
+		found := false
+		for _, tag := range task.Tags {
+			if strings.EqualFold(tag, want) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
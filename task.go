@@ -1,216 +1,1238 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"net/mail"
+	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
 )
 
 type User struct {
-	ID        uint      `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"-"`
+	Role     string `json:"role"`
+	// TaskQuota overrides the default limit on the user's tasks; nil uses the default
+	TaskQuota *int `json:"task_quota"`
+	// Timezone is the IANA zone the user's days are counted in; empty means TIMEZONE
+	Timezone string `json:"timezone"`
+	// Active is false for deactivated users, who can't log in or use their tokens
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// PasswordChangedAt is when the password was last changed; tokens issued
+	// before it are refused
+	PasswordChangedAt *time.Time `json:"-"`
 }
 
+// Task is also the body of task creates and updates; the binding tags name
+// the checks in validation.go its fields must pass
 type Task struct {
-	ID          uint      `json:"id"`
-	UserID      uint      `json:"user_id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Title       string     `json:"title" binding:"title" normalize:"collapse"`
+	Description string     `json:"description" binding:"description" normalize:"trim"`
+	Status      string     `json:"status" binding:"omitempty,status"`
+	Priority    string     `json:"priority" binding:"omitempty,priority"`
+	Tags        []string   `json:"tags" binding:"tags"`
+	DueDate     *time.Time `json:"due_date"`
+	AssigneeID  *string    `json:"assignee_id"`
+	// Color is a #RRGGBB hex code, or empty for none
+	Color string `json:"color" binding:"color"`
+	// Recurrence is empty for one-off tasks; see recurrence.go
+	Recurrence string `json:"recurrence" binding:"recurrence"`
+	// ParentID makes this a subtask of another task of the same owner
+	ParentID *string `json:"parent_id"`
+	// BlockedBy lists tasks that must be finished before this one can be done
+	BlockedBy []string `json:"blocked_by"`
+	// Archived tasks are left out of the task list unless asked for
+	Archived bool `json:"archived"`
+	// CompletedAt is when the task last became done, and nil while it isn't
+	CompletedAt *time.Time `json:"completed_at"`
+	// Position orders the owner's tasks for ?sort=position, counting from 1.
+	// New tasks start at 0; only PATCH /tasks/reorder moves them.
+	Position int `json:"position"`
+	// CreatedBy and UpdatedBy are the users who created and last changed the task,
+	// which need not be its owner
+	CreatedBy string `json:"created_by"`
+	UpdatedBy string `json:"updated_by"`
+	// Version starts at 1 and goes up by one on every update
+	Version   int        `json:"version"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// Request body for partially updating a task; nil fields are left untouched
+type taskPatch struct {
+	Title       *string    `json:"title" binding:"title" normalize:"collapse"`
+	Description *string    `json:"description" binding:"description" normalize:"trim"`
+	Status      *string    `json:"status" binding:"status"`
+	Priority    *string    `json:"priority" binding:"priority"`
+	Tags        *[]string  `json:"tags" binding:"tags"`
+	DueDate     *time.Time `json:"due_date"`
+	AssigneeID  *string    `json:"assignee_id"`
+	Color       *string    `json:"color" binding:"color"`
+	Recurrence  *string    `json:"recurrence" binding:"recurrence"`
+	ParentID    *string    `json:"parent_id"`
+	BlockedBy   *[]string  `json:"blocked_by"`
+	// Version, when given, must match the stored version for the patch to apply
+	Version *int `json:"version"`
+}
+
+// Request body for creating or updating a user, since User hides its password from JSON
+type userRequest struct {
+	Name     string `json:"name" binding:"name" normalize:"trim"`
+	Email    string `json:"email" binding:"email_address" normalize:"trim"`
+	Password string `json:"password"`
+	Timezone string `json:"timezone" binding:"timezone"`
+}
+
+// Request body for registering a user: like userRequest, but there is no
+// current password to keep, so one is required
+type signupRequest struct {
+	Name     string `json:"name" binding:"name" normalize:"trim"`
+	Email    string `json:"email" binding:"email_address" normalize:"trim"`
+	Password string `json:"password" binding:"password"`
+	Timezone string `json:"timezone" binding:"timezone"`
+}
+
+// Request body for partially updating a user; nil fields are left untouched
+type userPatch struct {
+	Name     *string `json:"name" binding:"name" normalize:"trim"`
+	Email    *string `json:"email" binding:"email_address" normalize:"trim"`
+	Password *string `json:"password" binding:"password"`
+	Timezone *string `json:"timezone" binding:"timezone"`
+}
+
+// How long to wait for in-flight requests on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// Port used when PORT is not set
+const defaultPort = 8080
+
+// Build the listen address from the optional HOST and PORT environment variables
+func listenAddr() (string, error) {
+	return hostPort("PORT", defaultPort)
+}
+
+// Join the optional HOST with the port in the named variable, or def when it is not set
+func hostPort(name string, def int) (string, error) {
+	port := def
+	if v := os.Getenv(name); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			return "", fmt.Errorf("%s %q is not a number", name, v)
+		}
+		if p < 1 || p > 65535 {
+			return "", fmt.Errorf("%s %d is out of range 1-65535", name, p)
+		}
+		port = p
+	}
+	return net.JoinHostPort(os.Getenv("HOST"), strconv.Itoa(port)), nil
+}
+
+// Stores backing the handlers, opened in main
 var (
-	users []User
-	tasks []Task
+	users    UserStore
+	tasks    TaskStore
+	comments CommentStore
+	history  HistoryStore
+	webhooks WebhookStore
+	// idempotencyKeys remembers responses to requests sent with an Idempotency-Key
+	idempotencyKeys IdempotencyStore
+	audit           AuditStore
+	attachments     AttachmentStore
+	timeEntries     TimeEntryStore
+	passwordResets  PasswordResetStore
 )
 
 func main() {
-	router := gin.Default()
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Middleware for logging
-	router.Use(gin.Logger())
+	stores, err := openStores(cfg.Storage, cfg.DatabasePath, cfg.Snapshots, cfg.Redis)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	defer func() {
+		if err := stores.close(); err != nil {
+			log.Printf("Failed to close storage: %v", err)
+		}
+	}()
+	router, err := newRouter(cfg, stores)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Middleware for recovering from panics
-	router.Use(gin.Recovery())
+	// gRPC for internal callers, on a port of its own
+	grpcListener, err := net.Listen("tcp", cfg.GRPCAddr)
+	if err != nil {
+		log.Fatalf("Failed to listen for gRPC: %v", err)
+	}
+	grpcServer := newGRPCServer()
 
-	// User endpoints
-	userGroup := router.Group("/users")
-	{
-		userGroup.POST("/", createUser)
-		userGroup.GET("/", getUsers)
-		userGroup.GET("/:id", getUserByID)
-		userGroup.PUT("/:id", updateUser)
-		userGroup.DELETE("/:id", deleteUser)
+	srv := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: stripTrailingSlash(router),
 	}
+	// Event streams never finish on their own, so end them when shutdown begins
+	srv.RegisterOnShutdown(streams.close)
 
-	// Task endpoints
-	// Secure task endpoints with OAuth 2
-	taskGroup := router.Group("/tasks")
-	taskGroup.Use(authMiddleware)
-	{
-		taskGroup.POST("", createTask)
-		taskGroup.GET("", getTasks)
-		taskGroup.GET("/:id", getTaskByID)
-		taskGroup.PUT("/:id", updateTask)
-		taskGroup.DELETE("/:id", deleteTask)
+	// Stop accepting connections on Ctrl-C or SIGTERM and let in-flight requests drain
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+	go func() {
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			log.Fatalf("gRPC server failed: %v", err)
+		}
+	}()
+
+	// Reminders of due tasks, until shutdown begins
+	remindersDone := make(chan struct{})
+	go func() {
+		newReminderScheduler(cfg.Reminders, logNotifier{}).run(ctx)
+		close(remindersDone)
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down, waiting for in-flight requests")
+	<-remindersDone
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := shutdownServers(shutdownCtx, srv, grpcServer); err != nil {
+		log.Printf("Shutdown did not complete cleanly: %v", err)
+		return
 	}
+	log.Println("Shutdown complete")
+}
 
-	router.Run(":8080")
+// Drain the HTTP and gRPC servers side by side until ctx is done, then cut
+// off the gRPC calls still running
+func shutdownServers(ctx context.Context, srv *http.Server, grpcServer *grpc.Server) error {
+	grpcDone := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcDone)
+	}()
+	err := srv.Shutdown(ctx)
+	select {
+	case <-grpcDone:
+		return err
+	case <-ctx.Done():
+	}
+	select {
+	case <-grpcDone:
+		return err
+	default:
+	}
+	grpcServer.Stop()
+	<-grpcDone
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("gRPC calls still running: %w", ctx.Err())
 }
 
-// Middleware to authenticate requests
-func authMiddleware(c *gin.Context) {
-	token := c.GetHeader("Authorization")
-	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized: Missing token"})
-		c.Abort()
-		return
+// Point the handlers at the stores and settings and build the router serving the API
+func newRouter(cfg Config, stores *storage) (*gin.Engine, error) {
+	jwtSecret = cfg.JWTSecret
+	users, tasks, comments, history, webhooks = stores.users, stores.tasks, stores.comments, stores.history, stores.webhooks
+	idempotencyKeys, audit, attachments, timeEntries = stores.idempotency, stores.audit, stores.attachments, stores.timeEntries
+	passwordResets, revokedTokens = stores.resets, stores.revocations
+
+	// Check request bodies against their binding tags; see validation.go
+	bodyValidator, err := newRequestValidator()
+	if err != nil {
+		return nil, err
 	}
+	binding.Validator = bodyValidator
+
+	router := gin.New()
+	logger := newJSONLogger(os.Stdout)
 
-	// Validate OAuth 2 token
-	userInfo, err := getUserInfoFromToken(token)
+	// Middleware to tag each request with an ID for tracing
+	router.Use(requestIDMiddleware)
+
+	// Middleware for structured request logging
+	router.Use(loggingMiddleware(logger))
+
+	// Middleware for Prometheus request metrics
+	appMetrics := newMetrics()
+	router.Use(appMetrics.middleware)
+
+	// Middleware for recovering from panics
+	router.Use(recoveryMiddleware(logger))
+
+	// Middleware for cross-origin browser clients
+	router.Use(corsMiddleware(cfg.CORSOrigins))
+
+	// Middleware for compressing large responses, and indenting them on ?pretty=true
+	router.Use(gzipMiddleware, prettyJSONMiddleware)
+
+	// Each upload endpoint applies its own, tighter limit
+	maxUpload := cfg.ImportMaxBytes
+	if cfg.Attachments.maxFileBytes > maxUpload {
+		maxUpload = cfg.Attachments.maxFileBytes
+	}
+
+	// Middleware to stop oversized bodies from exhausting memory
+	router.Use(bodyLimitMiddleware(cfg.MaxBodyBytes, maxUpload))
+
+	// Middleware to stop handlers from running forever
+	router.Use(timeoutMiddleware(cfg.RequestTimeout))
+
+	// Probes for load balancers and orchestrators, outside of authentication
+	router.GET("/health", health)
+	router.GET("/ready", ready(cfg.Storage, cfg.ReadyMaxLatency))
+	router.GET(metricsPath, appMetrics.handler())
+
+	limiter := newRateLimiter(cfg.RateLimitPerMinute)
+	limitByIP := rateLimitMiddleware(limiter, ipRateKey)
+	limitByUser := rateLimitMiddleware(limiter, userRateKey)
+
+	// API documentation
+	router.GET("/swagger/*any", swagger)
+
+	loginAttempts = newLoginTracker(cfg.LoginMaxAttempts, cfg.LoginLockoutWindow, stores.loginFailures)
+	taskQuota = cfg.TaskQuota
+	defaultPageSize, maxPageSize = cfg.DefaultPageSize, cfg.MaxPageSize
+	reminderLeadTime = cfg.Reminders.leadTime
+	timezone = cfg.Timezone
+	emailSender = newEmailSender(cfg.SMTP)
+
+	// Versioned API routes, plus the deprecated unversioned aliases
+	registerAPI(router, routeDeps{
+		limitByIP:   limitByIP,
+		limitByUser: limitByUser,
+		maxImport:   cfg.ImportMaxBytes,
+		attachments: cfg.Attachments,
+		resets:      cfg.PasswordReset,
+		idempotent:  idempotencyMiddleware(cfg.IdempotencyTTL),
+	})
+
+	// GraphQL, alongside the REST API and behind the same authentication.
+	// Its schema evolves in place, so it isn't versioned.
+	schema, err := newGraphQLSchema()
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Unauthorized: %v", err)})
-		c.Abort()
+		return nil, fmt.Errorf("parse GraphQL schema: %w", err)
+	}
+	router.POST("/graphql", authMiddleware, limitByUser, graphqlHandler(schema))
+	registerFallbacks(router)
+	return router, nil
+}
+
+// Parse a user, task or webhook ID into its canonical lowercase form
+func parseUUID(param string) (string, bool) {
+	id, err := uuid.Parse(param)
+	if err != nil {
+		return "", false
+	}
+	return id.String(), true
+}
+
+// Read the :id path parameter of a user, task or webhook. An ID that isn't a UUID is a
+// bad request, unlike a well-formed ID with no record behind it, which callers
+// report as 404. On failure the error response has already been written.
+func idParam(c *gin.Context) (string, bool) {
+	id, ok := parseUUID(c.Param("id"))
+	if !ok {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "Invalid id: must be a UUID")
+	}
+	return id, ok
+}
+
+// Check that an email is a bare, syntactically valid address
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("Invalid email address %q", email)
+	}
+	return nil
+}
+
+// Respond to a failed store call: a missing record is a 404, anything else a 500
+func respondStoreError(c *gin.Context, err error, notFound string) {
+	if errors.Is(err, errNotFound) {
+		respondError(c, http.StatusNotFound, codeNotFound, notFound)
+		return
+	}
+	if errors.Is(err, errVersionConflict) {
+		respondError(c, http.StatusConflict, codeVersionConflict, "Task was modified by someone else; fetch it and retry with the new version")
+		return
+	}
+	if isContextError(err) {
+		// The request timed out or the client left; nobody reads this
+		respondError(c, http.StatusServiceUnavailable, codeTimeout, "Request was cancelled")
 		return
 	}
+	log.Printf("Store error: %v", err)
+	respondError(c, http.StatusInternalServerError, codeInternal, "Internal server error")
+}
+
+// Read ?include_deleted=, which makes soft-deleted records visible.
+// On failure the error response has already been written.
+func includeDeletedParam(c *gin.Context) (bool, bool) {
+	return boolParam(c, "include_deleted")
+}
 
-	// Set user info in the context for downstream handlers to access
-	c.Set("userInfo", userInfo)
+// Read an optional boolean query parameter, false when absent.
+// On failure the error response has already been written.
+func boolParam(c *gin.Context, name string) (bool, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return false, true
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, name+" must be true or false")
+		return false, false
+	}
+	return b, true
+}
 
-	c.Next()
+// Read an optional RFC 3339 timestamp query parameter, nil when absent.
+// On failure the error response has already been written.
+func timeParam(c *gin.Context, name string) (*time.Time, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, name+" must be an RFC 3339 timestamp, like 2006-01-02T15:04:05Z")
+		return nil, false
+	}
+	return &t, true
 }
 
-// Dummy function to validate OAuth 2 token and fetch user info
-func getUserInfoFromToken(token string) (*User, error) {
-	dummyUser := &User{
-		ID:       1,
-		Name:     "John Doe",
-		Email:    "john.doe@example.com",
-		Password: "",
+// Load the user named by :id, treating soft-deleted users as missing unless includeDeleted.
+// On failure the error response has already been written.
+func loadUser(c *gin.Context, includeDeleted bool) (User, bool) {
+	id, ok := idParam(c)
+	if !ok {
+		return User{}, false
+	}
+	user, err := users.GetByID(id)
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return User{}, false
 	}
-	return dummyUser, nil
+	if user.DeletedAt != nil && !includeDeleted {
+		respondError(c, http.StatusNotFound, codeNotFound, "User not found")
+		return User{}, false
+	}
+	return user, true
+}
+
+// Users may read and change their own record; admins may do so for anyone
+func mayAccessUser(caller *User, user User) bool {
+	return caller.ID == user.ID || isAdmin(caller)
 }
 
 // User handlers
+// Respond with 403 unless the caller may access the user.
+// On failure the error response has already been written.
+func checkUserAccess(c *gin.Context, user User) bool {
+	if mayAccessUser(currentUser(c), user) {
+		return true
+	}
+	respondError(c, http.StatusForbidden, codeForbidden, "Forbidden: you may only access your own user")
+	return false
+}
+
 func createUser(c *gin.Context) {
-	var user User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req signupRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, codeInternal, "Failed to hash password")
+		return
+	}
+	user, err := users.Create(User{Name: req.Name, Email: req.Email, Password: hash, Role: roleForEmail(req.Email), Timezone: req.Timezone, Active: true})
+	if err == errEmailTaken {
+		respondError(c, http.StatusConflict, codeEmailTaken, "Email already in use")
 		return
 	}
-	// Assign a unique ID
-	user.ID = uint(len(users) + 1)
-	user.CreatedAt = time.Now()
-	user.UpdatedAt = time.Now()
-	users = append(users, user)
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	recordAudit(c, AuditCreate, AuditResourceUser, user.ID, nil, user)
+	sendWelcomeEmail(user)
 	c.JSON(http.StatusCreated, user)
 }
 
 func getUsers(c *gin.Context) {
-	c.JSON(http.StatusOK, users)
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
+		return
+	}
+	all, err := users.List(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	list := make([]User, 0, len(all))
+	for _, user := range all {
+		if includeDeleted || user.DeletedAt == nil {
+			list = append(list, user)
+		}
+	}
+	setTotalCount(c, len(list))
+	c.JSON(http.StatusOK, newPage(c, paginate(list, limit, offset), len(list), limit, offset))
 }
 
 func getUserByID(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil || id < 1 || id > len(users) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
+		return
+	}
+	user, ok := loadUser(c, includeDeleted)
+	if !ok || !checkUserAccess(c, user) {
 		return
 	}
-	user := users[id-1]
 	c.JSON(http.StatusOK, user)
 }
 
 func updateUser(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil || id < 1 || id > len(users) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	user, ok := loadUser(c, false)
+	if !ok || !checkUserAccess(c, user) {
 		return
 	}
-	var updatedUser User
-	if err := c.ShouldBindJSON(&updatedUser); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	saveUserUpdate(c, user)
+}
+
+// Apply the name, email, password and time zone in the request body to the user,
+// keeping the current password when none is given, and respond with the result
+func saveUserUpdate(c *gin.Context, user User) {
+	var req userRequest
+	if !bindJSON(c, &req) {
 		return
 	}
-	updatedUser.ID = uint(id)
-	updatedUser.CreatedAt = users[id-1].CreatedAt
-	updatedUser.UpdatedAt = time.Now()
-	users[id-1] = updatedUser
+	updatedUser := User{Name: req.Name, Email: req.Email, Password: user.Password, Role: user.Role, TaskQuota: user.TaskQuota, Timezone: req.Timezone, Active: user.Active, PasswordChangedAt: user.PasswordChangedAt}
+	// Only re-hash when a new password is supplied
+	if req.Password != "" {
+		if err := setPassword(&updatedUser, req.Password); err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to hash password")
+			return
+		}
+	}
+	storeUserUpdate(c, user, updatedUser)
+}
+
+// Apply only the fields present in the request body to the user
+func patchUser(c *gin.Context) {
+	user, ok := loadUser(c, false)
+	if !ok || !checkUserAccess(c, user) {
+		return
+	}
+	before := user
+	var patch userPatch
+	if !bindJSON(c, &patch) {
+		return
+	}
+	if patch.Name == nil && patch.Email == nil && patch.Password == nil && patch.Timezone == nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "Patch must set at least one of name, email, password, timezone")
+		return
+	}
+	if patch.Timezone != nil {
+		user.Timezone = *patch.Timezone
+	}
+	if patch.Name != nil {
+		user.Name = *patch.Name
+	}
+	// The email is only checked for uniqueness when it changes
+	if patch.Email != nil && *patch.Email != user.Email {
+		user.Email = *patch.Email
+	}
+	if patch.Password != nil {
+		if err := setPassword(&user, *patch.Password); err != nil {
+			respondError(c, http.StatusInternalServerError, codeInternal, "Failed to hash password")
+			return
+		}
+	}
+	storeUserUpdate(c, before, user)
+}
+
+// Save the changes made to a user and respond with the result, answering 409 for a taken email
+func storeUserUpdate(c *gin.Context, before, user User) {
+	updatedUser, err := users.Update(before.ID, user)
+	if err == errEmailTaken {
+		respondError(c, http.StatusConflict, codeEmailTaken, "Email already in use")
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	var redacted []string
+	if updatedUser.Password != before.Password {
+		redacted = append(redacted, "password")
+	}
+	recordAudit(c, AuditUpdate, AuditResourceUser, before.ID, before, updatedUser, redacted...)
 	c.JSON(http.StatusOK, updatedUser)
 }
 
+// Soft-delete a user along with the tasks they own, unless ?keep_tasks=true
+// leaves the tasks alone. With ?dry_run=true nothing is deleted; what would be
+// is reported instead. The tasks go first and the user last, so a delete that
+// fails partway through can simply be retried.
 func deleteUser(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil || id < 1 || id > len(users) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+	keepTasks, ok := boolParam(c, "keep_tasks")
+	if !ok {
 		return
 	}
-	users = append(users[:id-1], users[id:]...)
-	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+	dryRun, ok := dryRunParam(c)
+	if !ok {
+		return
+	}
+	user, ok := loadUser(c, false)
+	if !ok {
+		return
+	}
+	var owned []Task
+	if !keepTasks {
+		var err error
+		owned, err = liveTasksOf(c.Request.Context(), user.ID)
+		if err != nil {
+			respondStoreError(c, err, "User not found")
+			return
+		}
+	}
+	if dryRun {
+		ids := make([]string, len(owned))
+		for i, task := range owned {
+			ids[i] = task.ID
+		}
+		respondDeletePreview(c, []string{user.ID}, ids)
+		return
+	}
+	deleted := 0
+	for _, task := range owned {
+		err := tasks.Delete(task.ID)
+		if errors.Is(err, errNotFound) {
+			// Someone else deleted it in the meantime
+			continue
+		}
+		if err != nil {
+			respondStoreError(c, err, "User not found")
+			return
+		}
+		deleted++
+		recordAudit(c, AuditDelete, AuditResourceTask, task.ID, task, nil)
+		notifyTaskEvent(EventTaskDeleted, task)
+	}
+	if err := users.Delete(user.ID); err != nil {
+		respondStoreError(c, err, "User not found")
+		return
+	}
+	recordAudit(c, AuditDelete, AuditResourceUser, user.ID, user, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted", "deleted_tasks": deleted})
+}
+
+// List the tasks the user owns that aren't soft-deleted
+func liveTasksOf(ctx context.Context, userID string) ([]Task, error) {
+	all, err := tasks.ListByUser(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	return filterTasks(all, func(task Task) bool {
+		return task.DeletedAt == nil
+	}), nil
+}
+
+// Keep only the tasks matching the given predicate
+func filterTasks(list []Task, keep func(Task) bool) []Task {
+	filtered := make([]Task, 0, len(list))
+	for _, task := range list {
+		if keep(task) {
+			filtered = append(filtered, task)
+		}
+	}
+	return filtered
+}
+
+// A task is overdue once its due date has passed without it being done.
+// Tasks without a due date are never overdue. Due dates are instants, so a
+// task becomes overdue at the same moment in every time zone.
+func isOverdue(task Task, now time.Time) bool {
+	return task.DueDate != nil && task.DueDate.Before(now) && task.Status != StatusDone
+}
+
+// Get the authenticated user set by authMiddleware
+func currentUser(c *gin.Context) *User {
+	userInfo, ok := c.Get("userInfo")
+	if !ok {
+		return nil
+	}
+	user, _ := userInfo.(*User)
+	return user
+}
+
+// List the authenticated user's tasks, skipping soft-deleted ones unless ?include_deleted=true.
+// Admins may pass ?user_id= to list another user's tasks instead.
+// On failure the error response has already been written.
+func listOwnedTasks(c *gin.Context) ([]Task, bool) {
+	return listOwnedTasksIn(c, "")
+}
+
+// listOwnedTasks, keeping only the tasks in status unless it is empty
+func listOwnedTasksIn(c *gin.Context, status string) ([]Task, bool) {
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
+		return nil, false
+	}
+	user := currentUser(c)
+	userID := user.ID
+	if v := c.Query("user_id"); v != "" {
+		id, ok := parseUUID(v)
+		if !ok {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "user_id must be a UUID")
+			return nil, false
+		}
+		if id != user.ID && !isAdmin(user) {
+			respondError(c, http.StatusForbidden, codeForbidden, "Forbidden: admin role required")
+			return nil, false
+		}
+		userID = id
+	}
+	all, err := tasks.ListByUser(c.Request.Context(), userID, status)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return nil, false
+	}
+	return filterTasks(all, func(task Task) bool {
+		return includeDeleted || task.DeletedAt == nil
+	}), true
+}
+
+// List the tasks assigned to the authenticated user, skipping soft-deleted ones
+// unless ?include_deleted=true. On failure the error response has already been written.
+func listAssignedTasks(c *gin.Context) ([]Task, bool) {
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
+		return nil, false
+	}
+	all, err := tasks.List(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return nil, false
+	}
+	inactive, err := inactiveUserIDs(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err, "User not found")
+		return nil, false
+	}
+	userID := currentUser(c).ID
+	return filterTasks(all, func(task Task) bool {
+		return task.AssigneeID != nil && *task.AssigneeID == userID && !inactive[task.UserID] &&
+			(includeDeleted || task.DeletedAt == nil)
+	}), true
+}
+
+// Only the owner, or an admin, may change a task
+func ownsTask(user *User, task Task) bool {
+	return task.UserID == user.ID || isAdmin(user)
+}
+
+// The owner and the assignee may both see a task, though the assignee loses
+// sight of it while the owner is deactivated
+func canViewTask(user *User, task Task) bool {
+	if ownsTask(user, task) {
+		return true
+	}
+	return task.AssigneeID != nil && *task.AssigneeID == user.ID && userActive(task.UserID)
+}
+
+// Load the task named by :id, making sure it belongs to the authenticated user.
+// Soft-deleted tasks are treated as missing unless includeDeleted.
+// On failure the error response has already been written.
+func loadOwnedTask(c *gin.Context, includeDeleted bool) (Task, bool) {
+	return loadTask(c, includeDeleted, ownsTask)
+}
+
+// Like loadOwnedTask, but also lets the assignee through
+func loadVisibleTask(c *gin.Context, includeDeleted bool) (Task, bool) {
+	return loadTask(c, includeDeleted, canViewTask)
+}
+
+func loadTask(c *gin.Context, includeDeleted bool, allowed func(*User, Task) bool) (Task, bool) {
+	id, ok := idParam(c)
+	if !ok {
+		return Task{}, false
+	}
+	task, err := tasks.GetByID(id)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return Task{}, false
+	}
+	if task.DeletedAt != nil && !includeDeleted {
+		respondError(c, http.StatusNotFound, codeNotFound, "Task not found")
+		return Task{}, false
+	}
+	if user := currentUser(c); user == nil || !allowed(user, task) {
+		respondError(c, http.StatusForbidden, codeForbidden, "Forbidden: task belongs to another user")
+		return Task{}, false
+	}
+	return task, true
+}
+
+// Report whether id names an active user; a nil id means unassigned
+func assigneeExists(id *string) (bool, error) {
+	if id == nil {
+		return true, nil
+	}
+	user, err := users.GetByID(*id)
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.DeletedAt == nil && user.Active, nil
+}
+
+// Validate an assignee, writing the error response when it is rejected
+func checkAssignee(c *gin.Context, id *string) bool {
+	ok, err := assigneeExists(id)
+	if err != nil {
+		respondStoreError(c, err, "Assignee not found")
+		return false
+	}
+	if !ok {
+		respondError(c, http.StatusNotFound, codeNotFound, "Assignee not found")
+		return false
+	}
+	return true
+}
+
+// Validate a status change, writing the error response when it is rejected
+func checkStatusChange(c *gin.Context, from, to string) bool {
+	if !isValidStatus(to) {
+		respondFieldError(c, "status", invalidStatusMessage(to))
+		return false
+	}
+	if !canTransition(from, to) {
+		writeError(c, http.StatusUnprocessableEntity, apiError{
+			Code:    codeInvalidTransition,
+			Message: fmt.Sprintf("Invalid status transition from %s to %s", from, to),
+			Details: gin.H{"from": from, "to": to},
+		})
+		return false
+	}
+	return true
+}
+
+// What is wrong with a due date that dueDateInPast reports
+const pastDueDateMessage = "Due date must not be in the past"
+
+// Report whether a save sets a task's due date, current when the task has
+// one, to a time already past. A due date the task already had may have
+// passed since, so only one that is new or changed is checked.
+func dueDateInPast(current, due *time.Time) bool {
+	if due == nil || (current != nil && current.Equal(*due)) {
+		return false
+	}
+	return due.Before(time.Now())
+}
+
+// Fill in defaults for a task about to be created and validate it, reporting
+// every invalid field at once. Tasks that weren't bound from a request body,
+// such as imported ones, get the same checks as those that were.
+func prepareNewTask(task *Task) error {
+	errs := validateFields(task)
+	if dueDateInPast(nil, task.DueDate) {
+		errs["due_date"] = pastDueDateMessage
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	// Only the archive endpoints archive tasks
+	task.Archived = false
+	if task.Status == "" {
+		task.Status = StatusTodo
+	}
+	task.CompletedAt = nil
+	trackCompletion(task, "")
+	task.Position = 0
+	if task.Priority == "" {
+		task.Priority = PriorityMedium
+	}
+	// The tags passed validation, so they normalize cleanly
+	task.Tags, _ = normalizeTags(task.Tags)
+	task.BlockedBy = normalizeBlockers(task.BlockedBy)
+	return nil
 }
 
 // Task handlers
 func createTask(c *gin.Context) {
 	var task Task
-	if err := c.ShouldBindJSON(&task); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &task) {
+		return
+	}
+	task, err := apiCreateTask(c, task)
+	if err != nil {
+		respondAPIError(c, err)
 		return
 	}
-	// Assign a unique ID
-	task.ID = uint(len(tasks) + 1)
-	task.CreatedAt = time.Now()
-	task.UpdatedAt = time.Now()
-	tasks = append(tasks, task)
 	c.JSON(http.StatusCreated, task)
 }
 
+// Get the caller's tasks matching the list filters in the query: overdue,
+// assignee, status, tag, color and the creation and completion windows. Archived
+// tasks are left out unless ?archived=true. On failure the error response has
+// already been written.
+func queryTasks(c *gin.Context) ([]Task, bool) {
+	overdue, ok := boolParam(c, "overdue")
+	if !ok {
+		return nil, false
+	}
+	archived, ok := boolParam(c, "archived")
+	if !ok {
+		return nil, false
+	}
+	createdAfter, ok := timeParam(c, "created_after")
+	if !ok {
+		return nil, false
+	}
+	createdBefore, ok := timeParam(c, "created_before")
+	if !ok {
+		return nil, false
+	}
+	if createdAfter != nil && createdBefore != nil && !createdAfter.Before(*createdBefore) {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "created_after must be before created_before")
+		return nil, false
+	}
+	completedAfter, ok := timeParam(c, "completed_after")
+	if !ok {
+		return nil, false
+	}
+	completedBefore, ok := timeParam(c, "completed_before")
+	if !ok {
+		return nil, false
+	}
+	if completedAfter != nil && completedBefore != nil && !completedAfter.Before(*completedBefore) {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "completed_after must be before completed_before")
+		return nil, false
+	}
+	assignee := c.Query("assignee")
+	if assignee != "" && assignee != "me" {
+		respondError(c, http.StatusBadRequest, codeBadRequest, "assignee must be me")
+		return nil, false
+	}
+	color := c.Query("color")
+	if !isValidColor(color) {
+		respondError(c, http.StatusBadRequest, codeBadRequest, invalidColorMessage(color))
+		return nil, false
+	}
+	status := c.Query("status")
+	wantedTags := c.QueryArray("tag")
+	now := time.Now()
+	var visible []Task
+	if assignee == "me" {
+		// Tasks assigned to the caller, whoever owns them
+		visible, ok = listAssignedTasks(c)
+	} else {
+		// Statuses are stored in lower case, which lets the store's index do the filtering
+		visible, ok = listOwnedTasksIn(c, strings.ToLower(status))
+	}
+	if !ok {
+		return nil, false
+	}
+	return filterTasks(visible, func(task Task) bool {
+		if overdue && !isOverdue(task, now) {
+			return false
+		}
+		if task.Archived && !archived {
+			return false
+		}
+		if !hasAllTags(task, wantedTags) {
+			return false
+		}
+		if color != "" && !strings.EqualFold(task.Color, color) {
+			return false
+		}
+		if createdAfter != nil && !task.CreatedAt.After(*createdAfter) {
+			return false
+		}
+		if createdBefore != nil && !task.CreatedAt.Before(*createdBefore) {
+			return false
+		}
+		// Tasks that aren't done fall outside every completion window
+		if (completedAfter != nil || completedBefore != nil) && task.CompletedAt == nil {
+			return false
+		}
+		if completedAfter != nil && !task.CompletedAt.After(*completedAfter) {
+			return false
+		}
+		if completedBefore != nil && !task.CompletedAt.Before(*completedBefore) {
+			return false
+		}
+		return status == "" || strings.EqualFold(task.Status, status)
+	}), true
+}
+
 func getTasks(c *gin.Context) {
-	c.JSON(http.StatusOK, tasks)
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	order, err := parseSort(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	fields, ok := fieldsParam(c)
+	if !ok {
+		return
+	}
+	// Any ?cursor=, even an empty one, switches to cursor pagination
+	cursorValue, cursorMode := c.GetQuery("cursor")
+	var after *taskCursor
+	if cursorMode {
+		if c.Query("offset") != "" {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "cursor and offset cannot be combined")
+			return
+		}
+		if order.field != "created_at" {
+			respondError(c, http.StatusBadRequest, codeBadRequest, "cursor pagination only supports sort=created_at")
+			return
+		}
+		if after, err = decodeCursor(cursorValue); err != nil {
+			respondError(c, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+	}
+	list, ok := queryTasks(c)
+	if !ok {
+		return
+	}
+	setTotalCount(c, len(list))
+	if cursorMode {
+		data, next := cursorPaginate(list, order.desc, after, limit)
+		p := cursorPage{
+			Data:       selectTasksFields(data, fields),
+			Total:      len(list),
+			Limit:      limit,
+			NextCursor: next,
+			HasNext:    next != nil,
+			HasPrev:    after != nil,
+			Pagination: paginationCursor,
+		}
+		p.Links.Self = pageLink(c, "cursor", cursorValue, limit)
+		if next != nil {
+			link := pageLink(c, "cursor", *next, limit)
+			p.Links.Next = &link
+		}
+		c.JSON(http.StatusOK, p)
+		return
+	}
+	sortTasks(list, order)
+	p := newPage(c, selectTasksFields(paginate(list, limit, offset), fields), len(list), limit, offset)
+	p.Pagination = paginationOffset
+	c.JSON(http.StatusOK, p)
 }
 
 func getTaskByID(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil || id < 1 || id > len(tasks) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	includeDeleted, ok := includeDeletedParam(c)
+	if !ok {
 		return
 	}
-	task := tasks[id-1]
-	c.JSON(http.StatusOK, task)
+	fields, ok := fieldsParam(c)
+	if !ok {
+		return
+	}
+	task, ok := loadVisibleTask(c, includeDeleted)
+	if !ok {
+		return
+	}
+	// The ETag always covers the whole task, whichever fields are returned
+	etag := taskETag(task)
+	setTaskValidators(c, task)
+	// If-Modified-Since only counts without If-None-Match, the more precise of the two
+	match := c.GetHeader("If-None-Match")
+	if (match != "" && etagMatches(match, etag)) || (match == "" && notModifiedSince(c, task)) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	total, err := totalTimeSpent(task.ID)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	c.JSON(http.StatusOK, selectTaskFieldsWithTimeSpent(task, fields, total))
 }
 
 func updateTask(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil || id < 1 || id > len(tasks) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	task, ok := loadOwnedTask(c, false)
+	if !ok || !checkPreconditions(c, task) {
 		return
 	}
 	var updatedTask Task
-	if err := c.ShouldBindJSON(&updatedTask); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &updatedTask) {
+		return
+	}
+	if dueDateInPast(task.DueDate, updatedTask.DueDate) {
+		respondFieldError(c, "due_date", pastDueDateMessage)
+		return
+	}
+	if updatedTask.Status == "" {
+		updatedTask.Status = task.Status
+	}
+	if !checkStatusChange(c, task.Status, updatedTask.Status) {
 		return
 	}
-	updatedTask.ID = uint(id)
-	updatedTask.CreatedAt = tasks[id-1].CreatedAt
-	updatedTask.UpdatedAt = time.Now()
-	tasks[id-1] = updatedTask
-	c.JSON(http.StatusOK, updatedTask)
+	if updatedTask.Priority == "" {
+		updatedTask.Priority = task.Priority
+	}
+	// The tags passed validation when the body was bound, so they normalize cleanly
+	updatedTask.Tags, _ = normalizeTags(updatedTask.Tags)
+	if !checkAssignee(c, updatedTask.AssigneeID) {
+		return
+	}
+	updatedTask.UserID = task.UserID
+	updatedTask.Archived = task.Archived
+	updatedTask.CompletedAt = task.CompletedAt
+	trackCompletion(&updatedTask, task.Status)
+	updatedTask.Position = task.Position
+	updatedTask.CreatedBy = task.CreatedBy
+	updatedTask.UpdatedBy = currentUser(c).ID
+	if !checkParent(c, task.ID, task.UserID, updatedTask.ParentID) {
+		return
+	}
+	updatedTask.BlockedBy = normalizeBlockers(updatedTask.BlockedBy)
+	if !checkBlockers(c, task.ID, task.UserID, updatedTask.BlockedBy) ||
+		!checkCanComplete(c, task.Status, updatedTask) ||
+		!checkOccurrenceQuota(c, task.Status, updatedTask) {
+		return
+	}
+	if updatedTask.Version == 0 {
+		updatedTask.Version = task.Version
+	}
+	updatedTask, err := tasks.Update(task.ID, updatedTask)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	recordStatusChange(c, task.ID, task.Status, updatedTask.Status)
+	recordAudit(c, AuditUpdate, AuditResourceTask, task.ID, task, updatedTask)
+	respondSavedTask(c, task.Status, updatedTask)
 }
 
+func patchTask(c *gin.Context) {
+	task, ok := loadOwnedTask(c, false)
+	if !ok || !checkPreconditions(c, task) {
+		return
+	}
+	var patch taskPatch
+	if !bindJSON(c, &patch) {
+		return
+	}
+	task, next, err := apiPatchTask(c, task, patch, patch.Version)
+	if err != nil {
+		respondAPIError(c, err)
+		return
+	}
+	respondCompletedTask(c, task, next)
+}
+
+// Delete a task. One with live subtasks is refused with 409 unless
+// ?cascade=true, which deletes the whole subtree. With ?dry_run=true the
+// same checks apply, but the tasks that would go are reported instead.
 func deleteTask(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil || id < 1 || id > len(tasks) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+	cascade, ok := boolParam(c, "cascade")
+	if !ok {
+		return
+	}
+	dryRun, ok := dryRunParam(c)
+	if !ok {
+		return
+	}
+	task, ok := loadOwnedTask(c, false)
+	if !ok {
+		return
+	}
+	if dryRun {
+		previewTaskDelete(c, task, cascade)
+		return
+	}
+	if err := apiDeleteTask(c, task, cascade); err != nil {
+		respondAPIError(c, err)
 		return
 	}
-	tasks = append(tasks[:id-1], tasks[id:]...)
 	c.JSON(http.StatusOK, gin.H{"message": "Task deleted"})
 }
+
+// Report the tasks deleteTask would delete, its subtasks first, without touching any
+func previewTaskDelete(c *gin.Context, task Task, cascade bool) {
+	descendants, err := liveDescendants(c.Request.Context(), task.ID)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	if len(descendants) > 0 && !cascade {
+		respondError(c, http.StatusConflict, codeConflict, "Task has subtasks; delete them first or pass cascade=true")
+		return
+	}
+	ids := make([]string, 0, len(descendants)+1)
+	for _, descendant := range descendants {
+		ids = append(ids, descendant.ID)
+	}
+	respondDeletePreview(c, nil, append(ids, task.ID))
+}
+
+// Undo a soft delete
+func restoreTask(c *gin.Context) {
+	task, ok := loadOwnedTask(c, true)
+	if !ok {
+		return
+	}
+	if task.DeletedAt == nil {
+		respondError(c, http.StatusConflict, codeConflict, "Task is not deleted")
+		return
+	}
+	restored, err := tasks.Restore(task.ID)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	recordAudit(c, AuditUpdate, AuditResourceTask, task.ID, task, restored)
+	task = restored
+	notifyTaskEvent(EventTaskUpdated, task)
+	c.JSON(http.StatusOK, task)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeletingATaskLeavesTheOthersIntact(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	var created []Task
+	for i := 1; i <= 3; i++ {
+		created = append(created, srv.createTask(token, gin.H{"title": fmt.Sprintf("Task %d", i)}))
+	}
+	srv.expect(http.StatusOK, http.MethodDelete, "/v1/tasks/"+created[1].ID, token, nil, nil)
+
+	// The third task keeps its ID, not its old position in the list
+	var third Task
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+created[2].ID, token, nil, &third)
+	if third.ID != created[2].ID || third.Title != "Task 3" {
+		t.Errorf("GET the third task = %+v, want %+v", third, created[2])
+	}
+	srv.expect(http.StatusNotFound, http.MethodGet, "/v1/tasks/"+created[1].ID, token, nil, nil)
+
+	// IDs aren't handed out again after a delete
+	fourth := srv.createTask(token, gin.H{"title": "Task 4"})
+	for _, task := range created {
+		if fourth.ID == task.ID {
+			t.Errorf("new task reused ID %v", task.ID)
+		}
+	}
+}
+
+func TestStaleVersionIsRefused(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	task := srv.createTask(token, gin.H{"title": "Original"})
+	if task.Version != 1 {
+		t.Fatalf("new task version = %d, want 1", task.Version)
+	}
+	path := "/v1/tasks/" + task.ID
+
+	var updated Task
+	srv.expect(http.StatusOK, http.MethodPut, path, token, gin.H{"title": "First", "version": 1}, &updated)
+	if updated.Version != 2 {
+		t.Errorf("version after update = %d, want 2", updated.Version)
+	}
+
+	// A second client still holding version 1
+	srv.expect(http.StatusConflict, http.MethodPut, path, token, gin.H{"title": "Second", "version": 1}, nil)
+	srv.expect(http.StatusConflict, http.MethodPatch, path, token, gin.H{"title": "Second", "version": 1}, nil)
+
+	var stored Task
+	srv.expect(http.StatusOK, http.MethodGet, path, token, nil, &stored)
+	if stored.Title != "First" || stored.Version != 2 {
+		t.Errorf("stored task = %q at version %d, want the first update at version 2", stored.Title, stored.Version)
+	}
+}
+
+func TestDeletingAUserDeletesTheirTasks(t *testing.T) {
+	srv := newTestServer(t, "ADMIN_EMAILS", "admin@example.com")
+	_, adminToken := srv.signup("Admin", "admin@example.com")
+	ada, token := srv.signup("Ada", "ada@example.com")
+	_, bobToken := srv.signup("Bob", "bob@example.com")
+	parent := srv.createTask(token, gin.H{"title": "Parent"})
+	srv.createTask(token, gin.H{"title": "Child", "parent_id": parent.ID})
+	bobs := srv.createTask(bobToken, gin.H{"title": "Bob's"})
+
+	var resp struct {
+		DeletedTasks int `json:"deleted_tasks"`
+	}
+	srv.expect(http.StatusOK, http.MethodDelete, "/v1/users/"+ada.ID, adminToken, nil, &resp)
+	if resp.DeletedTasks != 2 {
+		t.Errorf("deleted_tasks = %d, want 2", resp.DeletedTasks)
+	}
+
+	// No live task may be left with a deleted owner
+	all, err := tasks.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range all {
+		if task.DeletedAt != nil {
+			continue
+		}
+		owner, err := users.GetByID(task.UserID)
+		if err != nil || owner.DeletedAt != nil {
+			t.Errorf("task %q outlived its owner %s", task.Title, task.UserID)
+		}
+	}
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/tasks/"+bobs.ID, bobToken, nil, nil)
+}
+
+func TestDeletingAUserCanKeepTheirTasks(t *testing.T) {
+	srv := newTestServer(t, "ADMIN_EMAILS", "admin@example.com")
+	_, adminToken := srv.signup("Admin", "admin@example.com")
+	ada, token := srv.signup("Ada", "ada@example.com")
+	task := srv.createTask(token, gin.H{"title": "Kept"})
+
+	var resp struct {
+		DeletedTasks int `json:"deleted_tasks"`
+	}
+	srv.expect(http.StatusOK, http.MethodDelete, "/v1/users/"+ada.ID+"?keep_tasks=true", adminToken, nil, &resp)
+	if resp.DeletedTasks != 0 {
+		t.Errorf("deleted_tasks = %d, want 0", resp.DeletedTasks)
+	}
+	stored, err := tasks.GetByID(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.DeletedAt != nil {
+		t.Error("?keep_tasks=true deleted the user's task")
+	}
+}
+
+func TestUpdatesRefusePastDueDates(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	tomorrow := time.Now().Add(24 * time.Hour)
+	task := srv.createTask(token, gin.H{"title": "Write report", "due_date": tomorrow})
+	path := "/v1/tasks/" + task.ID
+	yesterday := time.Now().Add(-24 * time.Hour)
+
+	for _, tc := range []struct {
+		method string
+		body   gin.H
+	}{
+		{http.MethodPatch, gin.H{"due_date": yesterday}},
+		{http.MethodPut, gin.H{"title": "Write report", "due_date": yesterday}},
+	} {
+		status, body := srv.do(tc.method, path, token, tc.body)
+		if status != http.StatusBadRequest || responseError(t, body).Fields["due_date"] == "" {
+			t.Errorf("%s with a past due date: status = %d, body %s; want 400 on due_date", tc.method, status, body)
+		}
+	}
+
+	// A due date that has passed since it was set may be sent back as it is
+	stored, err := tasks.GetByID(task.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.DueDate = &yesterday
+	if stored, err = tasks.Update(stored.ID, stored); err != nil {
+		t.Fatal(err)
+	}
+	srv.expect(http.StatusOK, http.MethodPut, path, token, gin.H{"title": "Write the report", "due_date": stored.DueDate}, nil)
+	srv.expect(http.StatusOK, http.MethodPatch, path, token, gin.H{"title": "Write it", "due_date": stored.DueDate}, nil)
+}
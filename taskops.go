@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Task operations shared by the REST, GraphQL and gRPC APIs. They don't write
+// responses: they fail with apiErrors, which each API reports its own way. They
+// take the gin context only to find the caller, record audit entries and stop
+// waiting on the stores once the request is done.
+
+func newAPIError(code, message string) error {
+	return apiError{Code: code, Message: message}
+}
+
+// HTTP statuses of the error codes the task operations fail with
+var httpStatuses = map[string]int{
+	codeBadRequest:         http.StatusBadRequest,
+	codeValidationFailed:   http.StatusBadRequest,
+	codeUnauthorized:       http.StatusUnauthorized,
+	codeForbidden:          http.StatusForbidden,
+	codeAccountDeactivated: http.StatusForbidden,
+	codeNotFound:           http.StatusNotFound,
+	codeConflict:           http.StatusConflict,
+	codeVersionConflict:    http.StatusConflict,
+	codeTaskBlocked:        http.StatusConflict,
+	codeInvalidTransition:  http.StatusUnprocessableEntity,
+	codeQuotaExceeded:      http.StatusForbidden,
+	codeTimeout:            http.StatusServiceUnavailable,
+}
+
+// Write the REST response for an error of a task operation
+func respondAPIError(c *gin.Context, err error) {
+	var e apiError
+	if !errors.As(err, &e) {
+		log.Printf("Task operation failed: %v", err)
+		e = apiError{Code: codeInternal, Message: "Internal server error"}
+	}
+	status, ok := httpStatuses[e.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	writeError(c, status, e)
+}
+
+// The counterpart of respondStoreError
+func apiStoreError(err error, notFound string) error {
+	if errors.Is(err, errNotFound) {
+		return newAPIError(codeNotFound, notFound)
+	}
+	if errors.Is(err, errVersionConflict) {
+		return newAPIError(codeVersionConflict, "Task was modified by someone else; fetch it and retry with the new version")
+	}
+	if isContextError(err) {
+		return newAPIError(codeTimeout, "Request was cancelled")
+	}
+	log.Printf("Store error: %v", err)
+	return newAPIError(codeInternal, "Internal server error")
+}
+
+// The counterpart of respondInvalid
+func apiInvalid(err error) error {
+	var fields fieldErrors
+	if !errors.As(err, &fields) {
+		return newAPIError(codeValidationFailed, err.Error())
+	}
+	return apiError{Code: codeValidationFailed, Message: fields.Error(), Fields: fields}
+}
+
+// The counterpart of checkParent
+func apiCheckParent(taskID, ownerID string, parentID *string) error {
+	status, message, err := parentProblem(taskID, ownerID, parentID)
+	return apiProblem("parent_id", status, message, err)
+}
+
+// The counterpart of checkBlockers
+func apiCheckBlockers(taskID, ownerID string, ids []string) error {
+	status, message, err := blockerProblem(taskID, ownerID, ids)
+	return apiProblem("blocked_by", status, message, err)
+}
+
+// Turn the results of parentProblem or blockerProblem into an error about field
+func apiProblem(field string, status int, message string, err error) error {
+	switch {
+	case err != nil:
+		return apiStoreError(err, "Task not found")
+	case status == http.StatusBadRequest:
+		return apiError{Code: codeValidationFailed, Message: message, Fields: map[string]string{field: message}}
+	case status != 0:
+		return newAPIError(codeNotFound, message)
+	}
+	return nil
+}
+
+// The counterpart of checkAssignee
+func apiCheckAssignee(id *string) error {
+	ok, err := assigneeExists(id)
+	if err != nil {
+		return apiStoreError(err, "Assignee not found")
+	}
+	if !ok {
+		return newAPIError(codeNotFound, "Assignee not found")
+	}
+	return nil
+}
+
+// The counterpart of checkCanComplete
+func apiCheckCanComplete(from string, task Task) error {
+	problem, err := completionProblem(from, task)
+	if err != nil {
+		return apiStoreError(err, "Task not found")
+	}
+	if problem != nil {
+		return *problem
+	}
+	return nil
+}
+
+// The counterpart of checkOccurrenceQuota
+func apiCheckOccurrenceQuota(ctx context.Context, from string, task Task) error {
+	problem, err := occurrenceQuotaProblem(ctx, from, task)
+	if err != nil {
+		return apiStoreError(err, "Task not found")
+	}
+	if problem != nil {
+		return *problem
+	}
+	return nil
+}
+
+// Load a live task the caller is allowed to see or change, like loadTask
+func apiLoadTask(caller *User, id string, allowed func(*User, Task) bool) (Task, error) {
+	taskID, ok := parseUUID(id)
+	if !ok {
+		return Task{}, newAPIError(codeBadRequest, "Invalid id: must be a UUID")
+	}
+	task, err := tasks.GetByID(taskID)
+	if err == nil && task.DeletedAt != nil {
+		err = errNotFound
+	}
+	if err != nil {
+		return Task{}, apiStoreError(err, "Task not found")
+	}
+	if !allowed(caller, task) {
+		return Task{}, newAPIError(codeForbidden, "Forbidden: task belongs to another user")
+	}
+	return task, nil
+}
+
+// The caller's live, unarchived tasks, optionally only those in one status
+func apiListTasks(ctx context.Context, caller *User, status *string) ([]Task, error) {
+	var wanted string
+	if status != nil {
+		wanted = strings.ToLower(*status)
+		if wanted == "" {
+			return []Task{}, nil
+		}
+	}
+	all, err := tasks.ListByUser(ctx, caller.ID, wanted)
+	if err != nil {
+		return nil, apiStoreError(err, "Task not found")
+	}
+	return filterTasks(all, func(task Task) bool {
+		return task.DeletedAt == nil && !task.Archived
+	}), nil
+}
+
+// Create a task owned by the caller
+func apiCreateTask(c *gin.Context, task Task) (Task, error) {
+	caller := currentUser(c)
+	if err := prepareNewTask(&task); err != nil {
+		return Task{}, apiInvalid(err)
+	}
+	if err := apiCheckAssignee(task.AssigneeID); err != nil {
+		return Task{}, err
+	}
+	// The owner always comes from the caller, never from the input
+	task.UserID = caller.ID
+	task.CreatedBy, task.UpdatedBy = caller.ID, caller.ID
+	if err := apiCheckParent("", task.UserID, task.ParentID); err != nil {
+		return Task{}, err
+	}
+	if err := apiCheckBlockers("", task.UserID, task.BlockedBy); err != nil {
+		return Task{}, err
+	}
+	remaining, err := remainingTaskQuota(c.Request.Context(), caller)
+	if err != nil {
+		return Task{}, apiStoreError(err, "Task not found")
+	}
+	if remaining < 1 {
+		return Task{}, quotaExceeded(caller, remaining)
+	}
+	task, err = tasks.Create(task)
+	if err != nil {
+		return Task{}, apiStoreError(err, "Task not found")
+	}
+	recordAudit(c, AuditCreate, AuditResourceTask, task.ID, nil, task)
+	notifyTaskEvent(EventTaskCreated, task)
+	return task, nil
+}
+
+// Apply the set fields of patch to a task. A non-nil version must match the
+// stored one. Returns the saved task and, when the patch completed a recurring
+// task, its next occurrence.
+func apiPatchTask(c *gin.Context, task Task, patch taskPatch, version *int) (Task, *Task, error) {
+	before := task
+	errs := validateFields(&patch)
+	if dueDateInPast(task.DueDate, patch.DueDate) {
+		errs["due_date"] = pastDueDateMessage
+	}
+	if len(errs) > 0 {
+		return Task{}, nil, apiInvalid(errs)
+	}
+	if patch.Title != nil {
+		task.Title = *patch.Title
+	}
+	if patch.Description != nil {
+		task.Description = *patch.Description
+	}
+	if patch.Priority != nil {
+		task.Priority = *patch.Priority
+	}
+	if patch.Color != nil {
+		task.Color = *patch.Color
+	}
+	if patch.Recurrence != nil {
+		task.Recurrence = *patch.Recurrence
+	}
+	if patch.Tags != nil {
+		task.Tags, _ = normalizeTags(*patch.Tags)
+	}
+	if patch.DueDate != nil {
+		task.DueDate = patch.DueDate
+	}
+	if patch.ParentID != nil {
+		if err := apiCheckParent(task.ID, task.UserID, patch.ParentID); err != nil {
+			return Task{}, nil, err
+		}
+		task.ParentID = patch.ParentID
+	}
+	if patch.BlockedBy != nil {
+		blockers := normalizeBlockers(*patch.BlockedBy)
+		if err := apiCheckBlockers(task.ID, task.UserID, blockers); err != nil {
+			return Task{}, nil, err
+		}
+		task.BlockedBy = blockers
+	}
+	if patch.AssigneeID != nil {
+		if err := apiCheckAssignee(patch.AssigneeID); err != nil {
+			return Task{}, nil, err
+		}
+		task.AssigneeID = patch.AssigneeID
+	}
+	if version != nil {
+		task.Version = *version
+	}
+	previousStatus := task.Status
+	if patch.Status != nil {
+		if !canTransition(task.Status, *patch.Status) {
+			return Task{}, nil, apiError{
+				Code:    codeInvalidTransition,
+				Message: "Invalid status transition from " + task.Status + " to " + *patch.Status,
+				Details: gin.H{"from": task.Status, "to": *patch.Status},
+			}
+		}
+		task.Status = *patch.Status
+	}
+	trackCompletion(&task, previousStatus)
+	if err := apiCheckCanComplete(previousStatus, task); err != nil {
+		return Task{}, nil, err
+	}
+	if err := apiCheckOccurrenceQuota(c.Request.Context(), previousStatus, task); err != nil {
+		return Task{}, nil, err
+	}
+	task.UpdatedBy = currentUser(c).ID
+	task, err := tasks.Update(task.ID, task)
+	if err != nil {
+		return Task{}, nil, apiStoreError(err, "Task not found")
+	}
+	recordStatusChange(c, task.ID, previousStatus, task.Status)
+	recordAudit(c, AuditUpdate, AuditResourceTask, task.ID, before, task)
+	notifyTaskEvent(EventTaskUpdated, task)
+	next, err := createNextOccurrence(previousStatus, task)
+	if err != nil {
+		return Task{}, nil, apiStoreError(err, "Task not found")
+	}
+	if next != nil {
+		recordAudit(c, AuditCreate, AuditResourceTask, next.ID, nil, *next)
+		notifyTaskEvent(EventTaskCreated, *next)
+	}
+	return task, next, nil
+}
+
+// Delete a task: one with live subtasks is refused unless cascade is set,
+// which deletes them too
+func apiDeleteTask(c *gin.Context, task Task, cascade bool) error {
+	if cascade {
+		if err := deleteDescendants(c, task.ID); err != nil {
+			return apiStoreError(err, "Task not found")
+		}
+	} else {
+		children, err := childrenOf(c.Request.Context(), task.ID)
+		if err != nil {
+			return apiStoreError(err, "Task not found")
+		}
+		if len(children) > 0 {
+			return newAPIError(codeConflict, "Task has subtasks; delete them first or pass cascade=true")
+		}
+	}
+	if err := tasks.Delete(task.ID); err != nil {
+		return apiStoreError(err, "Task not found")
+	}
+	recordAudit(c, AuditDelete, AuditResourceTask, task.ID, task, nil)
+	notifyTaskEvent(EventTaskDeleted, task)
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long a request may run when REQUEST_TIMEOUT is not set
+const defaultRequestTimeout = 30 * time.Second
+
+// Read REQUEST_TIMEOUT, a Go duration such as 10s
+func requestTimeout() (time.Duration, error) {
+	v := os.Getenv("REQUEST_TIMEOUT")
+	if v == "" {
+		return defaultRequestTimeout, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("REQUEST_TIMEOUT %q must be a positive duration", v)
+	}
+	return d, nil
+}
+
+// Middleware that gives each request a deadline through its context and
+// answers 503 once it passes, if the handler hasn't started its response.
+// Handlers are expected to give up when the context is done; until they do,
+// their writes are discarded. Event streams are meant to stay open, so they
+// have no deadline.
+func timeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasSuffix(c.FullPath(), "/tasks/stream") {
+			c.Next()
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		w := newTimeoutWriter(ctx, c.Writer)
+		c.Writer = w
+		// Read up front: once the handler runs, only it may touch c
+		timeoutError := apiError{
+			Code:      codeTimeout,
+			Message:   fmt.Sprintf("Request took longer than %s", timeout),
+			RequestID: requestID(c),
+		}
+
+		done := make(chan interface{}, 1)
+		go func() {
+			// A panic is handed back so the recovery middleware still sees it
+			defer func() { done <- recover() }()
+			c.Next()
+		}()
+		select {
+		case p := <-done:
+			if p != nil {
+				panic(p)
+			}
+			// A handler that gave up at the deadline returns as it passes, and
+			// its writes were dropped
+			if ctx.Err() == context.DeadlineExceeded {
+				w.timeout(timeoutError)
+				return
+			}
+			// Headers of a response without a body haven't reached the real writer yet
+			w.mu.Lock()
+			w.syncHeader()
+			w.mu.Unlock()
+			return
+		case <-ctx.Done():
+		}
+		w.timeout(timeoutError)
+		// c belongs to the handler until it returns, and gin reuses it afterwards
+		if p := <-done; p != nil {
+			panic(p)
+		}
+	}
+}
+
+// Report whether a store gave up because the request's context is done
+func isContextError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// timeoutWriter lets the handler write until the deadline passes; after that
+// its writes are dropped. The handler sets headers on a copy of its own, so
+// the real ones are only touched under the lock.
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx      context.Context
+	mu       sync.Mutex
+	header   http.Header
+	timedOut bool
+	// started is set once the handler writes, as writers further out such as
+	// gzip's may hold its first bytes back from the real writer
+	started bool
+}
+
+func newTimeoutWriter(ctx context.Context, w gin.ResponseWriter) *timeoutWriter {
+	return &timeoutWriter{ResponseWriter: w, ctx: ctx, header: w.Header().Clone()}
+}
+
+// Report whether the handler's writes are to be dropped, which they are from
+// the deadline on even before the middleware gets to answer.
+// The caller holds the lock.
+func (w *timeoutWriter) expired() bool {
+	if !w.timedOut && w.ctx.Err() == context.DeadlineExceeded {
+		w.timedOut = true
+	}
+	return w.timedOut
+}
+
+// Answer with e unless the handler already started the response, and drop the
+// handler's writes. The answer is flushed with a Content-Length, so the client
+// has all of it while the middleware still waits for the handler to return,
+// and closes the connection, which stays busy until then.
+func (w *timeoutWriter) timeout(e apiError) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timedOut = true
+	if w.started || w.ResponseWriter.Written() {
+		return
+	}
+	body, _ := json.Marshal(gin.H{"error": e})
+	h := w.ResponseWriter.Header()
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	h.Set("Connection", "close")
+	w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	w.ResponseWriter.Write(body)
+	w.ResponseWriter.Flush()
+}
+
+// Bring the real headers in line with the handler's, up until the response starts.
+// The caller holds the lock.
+func (w *timeoutWriter) syncHeader() {
+	if w.ResponseWriter.Written() {
+		return
+	}
+	real := w.ResponseWriter.Header()
+	for name := range real {
+		if _, ok := w.header[name]; !ok {
+			delete(real, name)
+		}
+	}
+	for name, values := range w.header {
+		real[name] = values
+	}
+}
+
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.expired() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.expired() {
+		w.started = true
+		w.syncHeader()
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *timeoutWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.started = true
+	w.syncHeader()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *timeoutWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.expired() {
+		w.started = true
+		w.syncHeader()
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Status()
+}
+
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Written()
+}
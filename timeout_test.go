@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A server whose /slow handler ignores its context and runs for block
+func newSlowServer(t *testing.T, timeout, block time.Duration) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requestIDMiddleware, gzipMiddleware, prettyJSONMiddleware, timeoutMiddleware(timeout))
+	router.GET("/slow", func(c *gin.Context) {
+		time.Sleep(block)
+		c.JSON(http.StatusOK, gin.H{"message": "too late"})
+	})
+	router.GET("/cooperative", func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+		case <-time.After(block):
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "too late"})
+	})
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTimeoutAnswersBeforeTheHandlerReturns(t *testing.T) {
+	const timeout, block = 100 * time.Millisecond, time.Second
+	srv := newSlowServer(t, timeout, block)
+
+	for _, acceptGzip := range []bool{false, true} {
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+"/slow", nil)
+		if acceptGzip {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+		start := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		elapsed := time.Since(start)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed > block/2 {
+			t.Errorf("gzip %v: got the 503 after %s, want it soon after the %s timeout", acceptGzip, elapsed, timeout)
+		}
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("gzip %v: status = %d, want 503", acceptGzip, resp.StatusCode)
+		}
+		var got struct {
+			Error apiError `json:"error"`
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("gzip %v: body %q: %v", acceptGzip, body, err)
+		}
+		if got.Error.Code != codeTimeout || got.Error.RequestID == "" {
+			t.Errorf("gzip %v: error = %+v, want TIMEOUT with a request ID", acceptGzip, got.Error)
+		}
+	}
+}
+
+func TestTimeoutCancelsTheRequestContext(t *testing.T) {
+	srv := newSlowServer(t, 50*time.Millisecond, 5*time.Second)
+
+	start := time.Now()
+	resp, err := http.Get(srv.URL + "/cooperative")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", resp.StatusCode)
+	}
+	// Closing the server waits for the handler, which only returns this soon
+	// if it saw its context end
+	srv.Close()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("handler finished after %s, want it to stop at the timeout", elapsed)
+	}
+}
+
+func TestStoreScansStopWithTheContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	store := &memoryTaskStore{}
+	if _, err := store.List(ctx); !isContextError(err) {
+		t.Errorf("List error = %v, want the context's", err)
+	}
+	if _, err := store.ListByUser(ctx, "someone", ""); !isContextError(err) {
+		t.Errorf("ListByUser error = %v, want the context's", err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// One interval of work on a task. StoppedAt is nil while the timer runs.
+type TimeEntry struct {
+	ID        uint       `json:"id"`
+	TaskID    string     `json:"task_id"`
+	UserID    string     `json:"user_id"`
+	StartedAt time.Time  `json:"started_at"`
+	StoppedAt *time.Time `json:"stopped_at"`
+}
+
+// How long the interval lasted, or has lasted so far when still running
+func (e TimeEntry) duration(now time.Time) time.Duration {
+	if e.StoppedAt != nil {
+		return e.StoppedAt.Sub(e.StartedAt)
+	}
+	return now.Sub(e.StartedAt)
+}
+
+// A task as getTaskByID returns it, with the time tracked against it
+type taskWithTimeSpent struct {
+	Task
+	// TotalTimeSpent is in seconds and includes a running timer
+	TotalTimeSpent int64 `json:"total_time_spent"`
+}
+
+// selectTaskFields plus the task's total_time_spent, which is always included
+func selectTaskFieldsWithTimeSpent(task Task, fields map[string]bool, total int64) interface{} {
+	if fields == nil {
+		return taskWithTimeSpent{Task: task, TotalTimeSpent: total}
+	}
+	selected := selectTaskFields(task, fields)
+	if m, ok := selected.(map[string]json.RawMessage); ok {
+		m["total_time_spent"] = json.RawMessage(strconv.FormatInt(total, 10))
+	}
+	return selected
+}
+
+// The seconds tracked against a task over all its intervals
+func totalTimeSpent(taskID string) (int64, error) {
+	entries, err := timeEntries.ListByTask(taskID)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	var total time.Duration
+	for _, entry := range entries {
+		total += entry.duration(now)
+	}
+	return int64(total / time.Second), nil
+}
+
+// Start the task's timer; a task has at most one running timer
+func startTimer(c *gin.Context) {
+	task, ok := loadVisibleTask(c, false)
+	if !ok {
+		return
+	}
+	entry, err := timeEntries.Start(TimeEntry{TaskID: task.ID, UserID: currentUser(c).ID})
+	if errors.Is(err, errTimerRunning) {
+		respondError(c, http.StatusConflict, codeConflict, "Timer is already running for this task")
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	c.JSON(http.StatusCreated, entry)
+}
+
+// Stop the task's running timer
+func stopTimer(c *gin.Context) {
+	task, ok := loadVisibleTask(c, false)
+	if !ok {
+		return
+	}
+	entry, err := timeEntries.Stop(task.ID)
+	if errors.Is(err, errTimerNotRunning) {
+		respondError(c, http.StatusConflict, codeConflict, "Timer is not running for this task")
+		return
+	}
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// List a task's time entries, oldest first
+func getTimeEntries(c *gin.Context) {
+	task, ok := loadVisibleTask(c, false)
+	if !ok {
+		return
+	}
+	list, err := timeEntries.ListByTask(task.ID)
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+	// Zone names resolve even on hosts without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// The zone that decides which day it is for users who haven't set their own,
+// from TIMEZONE
+var timezone = time.Local
+
+// Read TIMEZONE, the IANA name of the zone days are counted in, such as
+// Europe/Berlin. The server's local zone is used when it is not set.
+func timezoneSetting() (*time.Location, error) {
+	v := os.Getenv("TIMEZONE")
+	if v == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(v)
+	if err != nil {
+		return nil, fmt.Errorf("TIMEZONE %q must be an IANA time zone such as Europe/Berlin", v)
+	}
+	return loc, nil
+}
+
+// A user's time zone is empty, meaning TIMEZONE, or an IANA name. "Local" is
+// refused: it names the server's zone, which users have no way of knowing.
+func isValidTimezone(name string) bool {
+	if name == "" {
+		return true
+	}
+	if name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// Error message shared by handlers that reject a time zone
+func invalidTimezoneMessage(name string) string {
+	return fmt.Sprintf("Invalid time zone %q: must be an IANA name such as Europe/Berlin", name)
+}
+
+// The zone the user's days are counted in
+func userLocation(user User) *time.Location {
+	if user.Timezone == "" {
+		return timezone
+	}
+	loc, err := time.LoadLocation(user.Timezone)
+	if err != nil {
+		// Only valid names are stored, so this is a zone the tzdata no longer knows
+		return timezone
+	}
+	return loc
+}
+
+// The midnight that starts the day t falls on in loc, and the one that ends it.
+// The end is found on the calendar rather than by adding 24 hours, so days
+// that daylight saving time makes 23 or 25 hours long come out right.
+func dayBounds(t time.Time, loc *time.Location) (start, end time.Time) {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc), time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+}
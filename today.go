@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List the tasks owned by or assigned to the caller that are due today in the
+// caller's time zone and still open, most pressing first and then by due time.
+// A task due exactly at midnight belongs to the day that midnight starts.
+func getTasksToday(c *gin.Context) {
+	list, err := tasks.List(c.Request.Context())
+	if err != nil {
+		respondStoreError(c, err, "Task not found")
+		return
+	}
+	user := currentUser(c)
+	start, end := dayBounds(time.Now(), userLocation(*user))
+	due := filterTasks(list, func(task Task) bool {
+		if !canViewTask(user, task) || task.DeletedAt != nil || task.Archived {
+			return false
+		}
+		if task.Status == StatusDone || task.Status == StatusCancelled {
+			return false
+		}
+		return task.DueDate != nil && !task.DueDate.Before(start) && task.DueDate.Before(end)
+	})
+	sort.SliceStable(due, func(i, j int) bool {
+		a, b := due[i], due[j]
+		if priorityRank[a.Priority] != priorityRank[b.Priority] {
+			return priorityRank[a.Priority] > priorityRank[b.Priority]
+		}
+		return a.DueDate.Before(*b.DueDate)
+	})
+	c.JSON(http.StatusOK, due)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Length bounds of task text fields, in characters
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 2000
+)
+
+// fieldErrors maps each invalid field to what is wrong with it
+type fieldErrors map[string]string
+
+func (f fieldErrors) Error() string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ": " + f[name]
+	}
+	return strings.Join(parts, "; ")
+}
+
+// The checks behind the binding tags of request bodies, by tag. Each is given
+// the field's value, a string or []string, and says what is wrong with it, or
+// returns "" when it is fine.
+var fieldChecks = map[string]func(value interface{}) string{
+	"title": func(value interface{}) string {
+		title := value.(string)
+		if strings.TrimSpace(title) == "" {
+			return "is required"
+		}
+		if utf8.RuneCountInString(title) > maxTitleLength {
+			return fmt.Sprintf("must be at most %d characters", maxTitleLength)
+		}
+		return ""
+	},
+	"description": func(value interface{}) string {
+		if utf8.RuneCountInString(value.(string)) > maxDescriptionLength {
+			return fmt.Sprintf("must be at most %d characters", maxDescriptionLength)
+		}
+		return ""
+	},
+	"status": func(value interface{}) string {
+		if status := value.(string); !isValidStatus(status) {
+			return invalidStatusMessage(status)
+		}
+		return ""
+	},
+	"priority": func(value interface{}) string {
+		if priority := value.(string); !isValidPriority(priority) {
+			return invalidPriorityMessage(priority)
+		}
+		return ""
+	},
+	"tags": func(value interface{}) string {
+		if _, err := normalizeTags(value.([]string)); err != nil {
+			return err.Error()
+		}
+		return ""
+	},
+	"color": func(value interface{}) string {
+		if color := value.(string); !isValidColor(color) {
+			return invalidColorMessage(color)
+		}
+		return ""
+	},
+	"recurrence": func(value interface{}) string {
+		if recurrence := value.(string); !isValidRecurrence(recurrence) {
+			return invalidRecurrenceMessage(recurrence)
+		}
+		return ""
+	},
+	"name": func(value interface{}) string {
+		if strings.TrimSpace(value.(string)) == "" {
+			return "is required"
+		}
+		return ""
+	},
+	"email_address": func(value interface{}) string {
+		if err := validateEmail(value.(string)); err != nil {
+			return err.Error()
+		}
+		return ""
+	},
+	"timezone": func(value interface{}) string {
+		if name := value.(string); !isValidTimezone(name) {
+			return invalidTimezoneMessage(name)
+		}
+		return ""
+	},
+	"password": func(value interface{}) string {
+		if value.(string) == "" {
+			return "must not be empty"
+		}
+		return ""
+	},
+}
+
+// The whitespace normalizations of request body fields, by the name given in
+// their normalize tags: trim strips leading and trailing whitespace, and
+// collapse also turns each run of whitespace inside into a single space, so
+// that values differing only by spaces come out the same
+var normalizers = map[string]func(string) string{
+	"trim": strings.TrimSpace,
+	"collapse": func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	},
+}
+
+// Apply the normalize tags of the struct v points to, to its string and
+// *string fields
+func normalizeFields(v interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return
+	}
+	rv = rv.Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		normalize, ok := normalizers[rv.Type().Field(i).Tag.Get("normalize")]
+		if !ok {
+			continue
+		}
+		field := rv.Field(i)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.String && field.CanSet() {
+			field.SetString(normalize(field.String()))
+		}
+	}
+}
+
+// requestValidator is gin's default validator with fieldChecks registered and
+// fields named as they are in JSON. It normalizes fields before checking
+// them, so whitespace-only values count as empty. It leaves array bodies to
+// their handlers, which validate each element and say which one failed.
+type requestValidator struct {
+	binding.StructValidator
+}
+
+func newRequestValidator() (binding.StructValidator, error) {
+	engine := binding.Validator.Engine().(*validator.Validate)
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	})
+	for tag, check := range fieldChecks {
+		check := check
+		// Nil pointers, the fields a patch leaves out, reach the check undereferenced
+		err := engine.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+			return fl.Field().Kind() == reflect.Ptr || check(fl.Field().Interface()) == ""
+		}, true)
+		if err != nil {
+			return nil, fmt.Errorf("register %s validation: %w", tag, err)
+		}
+	}
+	return requestValidator{binding.Validator}, nil
+}
+
+func (v requestValidator) ValidateStruct(obj interface{}) error {
+	normalizeFields(obj)
+	if kind := reflect.Indirect(reflect.ValueOf(obj)).Kind(); kind == reflect.Slice || kind == reflect.Array {
+		return nil
+	}
+	return v.StructValidator.ValidateStruct(obj)
+}
+
+// Normalize v and check it against its binding tags, returning every
+// invalid field at once
+func validateFields(v interface{}) fieldErrors {
+	var invalid validator.ValidationErrors
+	if !errors.As(binding.Validator.ValidateStruct(v), &invalid) {
+		return fieldErrors{}
+	}
+	return validationFieldErrors(invalid)
+}
+
+// Say what is wrong with each field that failed validation
+func validationFieldErrors(invalid validator.ValidationErrors) fieldErrors {
+	errs := fieldErrors{}
+	for _, fe := range invalid {
+		message := "is invalid"
+		if check, ok := fieldChecks[fe.Tag()]; ok {
+			message = check(fe.Value())
+		}
+		errs[fe.Field()] = message
+	}
+	return errs
+}
+
+// Answer 400 for a validation error, listing the invalid fields when there are any
+func respondInvalid(c *gin.Context, err error) {
+	var fields fieldErrors
+	if !errors.As(err, &fields) {
+		respondError(c, http.StatusBadRequest, codeValidationFailed, err.Error())
+		return
+	}
+	writeError(c, http.StatusBadRequest, apiError{
+		Code:    codeValidationFailed,
+		Message: fields.Error(),
+		Fields:  fields,
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response header naming the API version that served the request
+const apiVersionHeader = "API-Version"
+
+// Shared pieces the versioned route tables are built from
+type routeDeps struct {
+	limitByIP   gin.HandlerFunc
+	limitByUser gin.HandlerFunc
+	maxImport   int64
+	attachments attachmentConfig
+	resets      passwordResetConfig
+	// idempotent replays responses to retried requests with an Idempotency-Key
+	idempotent gin.HandlerFunc
+}
+
+// A published version of the API, mounted under /<name>
+type apiVersion struct {
+	name     string
+	register func(api *gin.RouterGroup, deps routeDeps)
+}
+
+// Every published version, oldest first. The unversioned routes are
+// deprecated aliases of legacyVersion.
+var (
+	apiVersions = []apiVersion{
+		{name: "v1", register: registerV1},
+	}
+	legacyVersion = apiVersions[0]
+)
+
+// Mount every API version on the router, plus the deprecated unversioned aliases
+func registerAPI(router *gin.Engine, deps routeDeps) {
+	for _, v := range apiVersions {
+		v.register(router.Group("/"+v.name, versionMiddleware(v.name)), deps)
+	}
+	legacy := router.Group("", versionMiddleware(legacyVersion.name), deprecatedMiddleware(legacyVersion.name))
+	legacyVersion.register(legacy, deps)
+}
+
+// Serve paths with a trailing slash as if it weren't there, so /tasks/ and
+// /tasks are the same route. Routes are registered without one; only the
+// Swagger UI, which lives under /swagger/, keeps its slash.
+func stripTrailingSlash(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p := r.URL.Path; len(p) > 1 && strings.HasSuffix(p, "/") && !strings.HasPrefix(p, "/swagger/") {
+			r.URL.Path = strings.TrimRight(p, "/")
+			if r.URL.Path == "" {
+				r.URL.Path = "/"
+			}
+			if r.URL.RawPath != "" {
+				r.URL.RawPath = strings.TrimRight(r.URL.RawPath, "/")
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Middleware to report which API version served the request
+func versionMiddleware(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(apiVersionHeader, name)
+		c.Next()
+	}
+}
+
+// Middleware to flag an unversioned alias as deprecated, pointing at the
+// same route under the given version
+func deprecatedMiddleware(successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		c.Header("Link", "</"+successor+c.Request.URL.Path+`>; rel="successor-version"`)
+		c.Next()
+	}
+}
+
+// The v1 routes
+func registerV1(api *gin.RouterGroup, deps routeDeps) {
+	limitByIP, limitByUser := deps.limitByIP, deps.limitByUser
+
+	// Authentication endpoints
+	api.POST("/login", limitByIP, login)
+	api.POST("/refresh", limitByIP, refresh)
+	api.POST("/logout", limitByIP, logout)
+	api.POST("/password-reset/request", limitByIP, requestPasswordReset(deps.resets))
+	api.POST("/password-reset/confirm", limitByIP, confirmPasswordReset)
+
+	// User endpoints
+	userGroup := api.Group("/users")
+	{
+		userGroup.POST("", limitByIP, createUser)
+		// Registration is the only user route open to anonymous clients
+		authed := userGroup.Group("", authMiddleware, limitByUser)
+		authed.GET("", adminOnly, getUsers)
+		authed.GET("/count", countUsers)
+		authed.GET("/search", adminOnly, searchUsers)
+		authed.GET("/:id", getUserByID)
+		authed.PUT("/:id", updateUser)
+		authed.PATCH("/:id", patchUser)
+		authed.PUT("/:id/role", adminOnly, updateUserRole)
+		authed.PUT("/:id/quota", adminOnly, updateUserQuota)
+		authed.POST("/:id/deactivate", deactivateUser)
+		authed.POST("/:id/activate", activateUser)
+		authed.DELETE("/:id", adminOnly, deleteUser)
+	}
+
+	// The caller's own profile
+	meGroup := api.Group("/me", authMiddleware, limitByUser)
+	{
+		meGroup.GET("", getMe)
+		meGroup.PUT("", updateMe)
+	}
+
+	// Task endpoints
+	// Secure task endpoints with a token from /login
+	taskGroup := api.Group("/tasks")
+	taskGroup.Use(authMiddleware, limitByUser)
+	{
+		taskGroup.POST("", deps.idempotent, createTask)
+		taskGroup.POST("/bulk", createTasksBulk)
+		taskGroup.PATCH("/bulk", updateTasksStatusBulk)
+		taskGroup.PATCH("/reorder", reorderTasks)
+		taskGroup.POST("/batch-get", getTasksBatch)
+		taskGroup.POST("/batch-delete", deleteTasksBatch)
+		taskGroup.GET("", getTasks)
+		// HEAD answers with the same status and headers as GET, without the body
+		taskGroup.HEAD("", getTasks)
+		taskGroup.GET("/search", searchTasks)
+		taskGroup.GET("/count", countTasks)
+		taskGroup.GET("/stats", getTaskStats)
+		taskGroup.GET("/export", exportTasks)
+		taskGroup.GET("/stream", streamTasks)
+		taskGroup.GET("/reminders", getReminders)
+		taskGroup.GET("/today", getTasksToday)
+		taskGroup.POST("/import", importTasks(deps.maxImport))
+		taskGroup.GET("/:id", getTaskByID)
+		taskGroup.HEAD("/:id", getTaskByID)
+		taskGroup.PUT("/:id", updateTask)
+		taskGroup.PATCH("/:id", patchTask)
+		taskGroup.DELETE("/:id", deleteTask)
+		taskGroup.POST("/:id/restore", restoreTask)
+		taskGroup.POST("/:id/archive", archiveTask)
+		taskGroup.POST("/:id/unarchive", unarchiveTask)
+		taskGroup.POST("/:id/duplicate", duplicateTask)
+		taskGroup.POST("/:id/comments", createComment)
+		taskGroup.GET("/:id/comments", getComments)
+		taskGroup.GET("/:id/history", getTaskHistory)
+		taskGroup.POST("/:id/start", startTimer)
+		taskGroup.POST("/:id/stop", stopTimer)
+		taskGroup.GET("/:id/time-entries", getTimeEntries)
+		taskGroup.GET("/:id/subtasks", getSubtasks)
+		taskGroup.GET("/:id/blockers", getBlockers)
+		taskGroup.POST("/:id/attachments", uploadAttachment(deps.attachments))
+		taskGroup.GET("/:id/attachments", getAttachments)
+		taskGroup.GET("/:id/attachments/:aid", downloadAttachment(deps.attachments))
+	}
+
+	// The audit log of every change to users and tasks
+	api.GET("/audit", authMiddleware, limitByUser, adminOnly, getAuditLog)
+
+	webhookGroup := api.Group("/webhooks")
+	webhookGroup.Use(authMiddleware, limitByUser)
+	{
+		webhookGroup.POST("", createWebhook)
+		webhookGroup.GET("", getWebhooks)
+		webhookGroup.DELETE("/:id", deleteWebhook)
+	}
+}
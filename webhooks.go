@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Task lifecycle events delivered to webhooks
+const (
+	EventTaskCreated = "task.created"
+	EventTaskUpdated = "task.updated"
+	EventTaskDeleted = "task.deleted"
+)
+
+// Delivery settings: each attempt times out on its own, and failed attempts
+// are retried after a delay that doubles every time
+const (
+	webhookTimeout    = 5 * time.Second
+	webhookAttempts   = 3
+	webhookRetryDelay = time.Second
+)
+
+// Header carrying the hex HMAC-SHA256 of the request body, keyed by the webhook's secret
+const webhookSignatureHeader = "X-Webhook-Signature"
+
+var webhookClient = newWebhookClient()
+
+// Build the client deliveries are made with. It only connects to public
+// addresses, checked once the receiver's name has been resolved so that DNS
+// can't point an accepted webhook at the server's own network later, and it
+// never follows redirects, which could lead anywhere.
+func newWebhookClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Through a proxy, the address checked would be the proxy's
+	transport.Proxy = nil
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: checkWebhookDial}
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Report whether webhooks may target ip: loopback, private, link-local and
+// unspecified addresses are refused, so webhooks can't reach the server
+// itself or the network it runs in
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsUnspecified()
+}
+
+// Refuse connections to addresses that aren't public. Called by the dialer
+// with the resolved address about to be connected to.
+func checkWebhookDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("webhook target %s is not a public address", host)
+	}
+	return nil
+}
+
+// Say what keeps the host of a webhook URL from receiving deliveries: it
+// must be or resolve to public addresses only. Returns "" when it's fine.
+func webhookHostProblem(ctx context.Context, host string) string {
+	if ip := net.ParseIP(host); ip != nil {
+		if !isPublicIP(ip) {
+			return "url must not point to a loopback, private or link-local address"
+		}
+		return ""
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Sprintf("url host %s does not resolve", host)
+	}
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return "url must not point to a loopback, private or link-local address"
+		}
+	}
+	return ""
+}
+
+// A URL that receives the task events of its owner
+type Webhook struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	URL    string `json:"url"`
+	// Secret signs deliveries; it is only shown when the webhook is created
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type webhookRequest struct {
+	URL string `json:"url"`
+}
+
+// Register a webhook for the caller's task events. Its URL must point to a
+// public address; see webhookHostProblem.
+func createWebhook(c *gin.Context) {
+	var req webhookRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		respondFieldError(c, "url", "url must be an absolute http or https URL")
+		return
+	}
+	if problem := webhookHostProblem(c.Request.Context(), u.Hostname()); problem != "" {
+		respondFieldError(c, "url", problem)
+		return
+	}
+	hook, err := webhooks.Create(Webhook{
+		UserID: currentUser(c).ID,
+		URL:    req.URL,
+		Secret: hex.EncodeToString(mustRandomBytes(32)),
+	})
+	if err != nil {
+		respondStoreError(c, err, "Webhook not found")
+		return
+	}
+	c.JSON(http.StatusCreated, hook)
+}
+
+// List the caller's webhooks, without their secrets
+func getWebhooks(c *gin.Context) {
+	list, err := webhooks.ListByUser(currentUser(c).ID)
+	if err != nil {
+		respondStoreError(c, err, "Webhook not found")
+		return
+	}
+	for i := range list {
+		list[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Remove one of the caller's webhooks. Other users' webhooks are answered
+// with 404, so their IDs can't be probed.
+func deleteWebhook(c *gin.Context) {
+	id, ok := idParam(c)
+	if !ok {
+		return
+	}
+	hook, err := webhooks.GetByID(id)
+	if err == nil && hook.UserID != currentUser(c).ID {
+		err = errNotFound
+	}
+	if err != nil {
+		respondStoreError(c, err, "Webhook not found")
+		return
+	}
+	if err := webhooks.Delete(id); err != nil {
+		respondStoreError(c, err, "Webhook not found")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// Send a task event to every webhook in store of the task's owner. Called in
+// the background by notifyTaskEvent so handlers never wait on a receiver.
+func deliverToWebhooks(store WebhookStore, event taskEvent) {
+	hooks, err := store.ListByUser(event.Task.UserID)
+	if err != nil {
+		log.Printf("Failed to list webhooks of user %s: %v", event.Task.UserID, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", event.Event, err)
+		return
+	}
+	for _, hook := range hooks {
+		go deliverWebhook(hook, event.Event, body)
+	}
+}
+
+// POST one event to a webhook, retrying on network errors and non-2xx responses
+func deliverWebhook(hook Webhook, event string, body []byte) {
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := postWebhook(hook, event, body)
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			log.Printf("Giving up on webhook %s after %d attempts: %v", hook.ID, attempt, err)
+			return
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func postWebhook(hook Webhook, event string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(hook.Secret, body))
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return nil
+}
+
+// Hex HMAC-SHA256 of body, which receivers recompute to check a delivery
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
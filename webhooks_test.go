@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWebhooksAreKeptToTheirOwners(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	_, bobToken := srv.signup("Bob", "bob@example.com")
+
+	var hook Webhook
+	srv.expect(http.StatusCreated, http.MethodPost, "/v1/webhooks", token, gin.H{"url": "https://203.0.113.10/hooks"}, &hook)
+	if _, ok := parseUUID(hook.ID); !ok || hook.Secret == "" {
+		t.Fatalf("created webhook = %+v, want a UUID and a secret", hook)
+	}
+	path := "/v1/webhooks/" + hook.ID
+
+	// Bob can't tell Ada's webhook from one that doesn't exist
+	srv.expect(http.StatusNotFound, http.MethodDelete, path, bobToken, nil, nil)
+	srv.expect(http.StatusNotFound, http.MethodDelete, "/v1/webhooks/"+newID(), bobToken, nil, nil)
+	srv.expect(http.StatusBadRequest, http.MethodDelete, "/v1/webhooks/1", bobToken, nil, nil)
+
+	var list []Webhook
+	srv.expect(http.StatusOK, http.MethodGet, "/v1/webhooks", token, nil, &list)
+	if len(list) != 1 || list[0].ID != hook.ID || list[0].Secret != "" {
+		t.Fatalf("webhooks = %+v, want only %s without its secret", list, hook.ID)
+	}
+	srv.expect(http.StatusOK, http.MethodDelete, path, token, nil, nil)
+	srv.expect(http.StatusNotFound, http.MethodDelete, path, token, nil, nil)
+}
+
+func TestWebhooksMustTargetPublicAddresses(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.signup("Ada", "ada@example.com")
+	for _, target := range []string{
+		"http://127.0.0.1/hooks",
+		"http://localhost:8080/hooks",
+		"http://[::1]/hooks",
+		"http://10.0.0.5/hooks",
+		"http://192.168.1.1/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hooks",
+	} {
+		status, body := srv.do(http.MethodPost, "/v1/webhooks", token, gin.H{"url": target})
+		if status != http.StatusBadRequest || responseError(t, body).Fields["url"] == "" {
+			t.Errorf("registering %s: status = %d, body %s; want 400 on url", target, status, body)
+		}
+	}
+}
+
+func TestWebhookDeliveriesOnlyReachPublicAddresses(t *testing.T) {
+	reached := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer receiver.Close()
+
+	// As if DNS had pointed an accepted webhook at a loopback address since
+	err := postWebhook(Webhook{ID: newID(), URL: receiver.URL, Secret: "secret"}, EventTaskCreated, []byte(`{}`))
+	if err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("delivering to %s: error = %v, want the address refused", receiver.URL, err)
+	}
+	if reached {
+		t.Error("the delivery reached the loopback receiver")
+	}
+	if webhookClient.CheckRedirect(nil, nil) != http.ErrUseLastResponse {
+		t.Error("deliveries follow redirects")
+	}
+}